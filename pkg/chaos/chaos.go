@@ -0,0 +1,157 @@
+// Package chaos injects latency, errors and dropped messages at named points
+// of a service. Faults come from a Source, usually a feature flag, and are
+// off unless configured.
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"rxw1/logging"
+)
+
+// Points shared by the services. Config keys are "<service>.<point>" or just
+// "<point>" to hit every service.
+const (
+	Resolver = "resolver"
+	Publish  = "publish"
+	Handler  = "handler"
+	DB       = "db"
+)
+
+var (
+	ErrInjected = errors.New("chaos: injected error")
+	ErrDropped  = errors.New("chaos: message dropped")
+)
+
+// Config maps point names to faults.
+type Config map[string]Fault
+
+// Fault describes what happens at a point. Probabilities are in [0, 1].
+type Fault struct {
+	Latency *Latency `json:"latency,omitempty"`
+	Error   float64  `json:"error,omitempty"`
+	Drop    float64  `json:"drop,omitempty"`
+}
+
+// Latency delays a call with the given probability. Distribution is
+// "uniform" (default) between Min and Max, "exponential" with Mean above Min
+// capped at Max, or "fixed" at Min.
+type Latency struct {
+	Probability  float64  `json:"probability"`
+	Distribution string   `json:"distribution,omitempty"`
+	Min          Duration `json:"min,omitempty"`
+	Max          Duration `json:"max,omitempty"`
+	Mean         Duration `json:"mean,omitempty"`
+}
+
+// Duration reads "250ms"-style strings from JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Source returns the current config; it is called on every Inject.
+type Source func(ctx context.Context) Config
+
+// Injector injects faults for one service. A nil *Injector injects nothing.
+type Injector struct {
+	service string
+	source  Source
+	float   func() float64
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+func New(service string, source Source) *Injector {
+	return &Injector{
+		service: service,
+		source:  source,
+		float:   rand.Float64,
+		sleep:   sleep,
+	}
+}
+
+// Inject applies the fault configured for point: it may sleep, then return
+// ErrDropped or ErrInjected. Callers skip the message on ErrDropped and fail
+// the call on any other error.
+func (in *Injector) Inject(ctx context.Context, point string) error {
+	if in == nil || in.source == nil {
+		return nil
+	}
+	cfg := in.source(ctx)
+	f, ok := cfg[in.service+"."+point]
+	if !ok {
+		f, ok = cfg[point]
+	}
+	if !ok {
+		return nil
+	}
+
+	if l := f.Latency; l != nil && in.hit(l.Probability) {
+		d := in.latency(l)
+		logging.From(ctx).Debug("chaos latency", "point", point, "delay", d)
+		if err := in.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+	if in.hit(f.Drop) {
+		logging.From(ctx).Debug("chaos drop", "point", point)
+		return ErrDropped
+	}
+	if in.hit(f.Error) {
+		logging.From(ctx).Debug("chaos error", "point", point)
+		return ErrInjected
+	}
+	return nil
+}
+
+func (in *Injector) hit(p float64) bool {
+	return p > 0 && in.float() < p
+}
+
+func (in *Injector) latency(l *Latency) time.Duration {
+	lo, hi := time.Duration(l.Min), time.Duration(l.Max)
+	var d time.Duration
+	switch l.Distribution {
+	case "fixed":
+		return lo
+	case "exponential":
+		// Inverse transform sampling, u in [0, 1).
+		d = lo + time.Duration(-math.Log(1-in.float())*float64(l.Mean))
+	default:
+		d = lo + time.Duration(in.float()*float64(hi-lo))
+	}
+	if hi > 0 && d > hi {
+		d = hi
+	}
+	return d
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
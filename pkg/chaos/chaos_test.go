@@ -0,0 +1,95 @@
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func fixedSource(cfg Config) Source {
+	return func(context.Context) Config { return cfg }
+}
+
+// newTest returns an injector whose random numbers are always u and which
+// records sleeps instead of sleeping.
+func newTest(cfg Config, u float64, slept *time.Duration) *Injector {
+	in := New("svc", fixedSource(cfg))
+	in.float = func() float64 { return u }
+	in.sleep = func(_ context.Context, d time.Duration) error {
+		*slept += d
+		return nil
+	}
+	return in
+}
+
+func TestInjector_Inject(t *testing.T) {
+	ms := func(n int) Duration { return Duration(time.Duration(n) * time.Millisecond) }
+
+	tests := []struct {
+		name      string
+		cfg       Config
+		u         float64
+		wantErr   error
+		wantSleep time.Duration
+	}{
+		{"no config", nil, 0, nil, 0},
+		{"other point", Config{DB: {Error: 1}}, 0, nil, 0},
+		{"error", Config{Publish: {Error: 1}}, 0.5, ErrInjected, 0},
+		{"error missed", Config{Publish: {Error: 0.1}}, 0.5, nil, 0},
+		{"drop before error", Config{Publish: {Error: 1, Drop: 1}}, 0.5, ErrDropped, 0},
+		{"service key wins", Config{Publish: {Error: 1}, "svc.publish": {}}, 0, nil, 0},
+		{"other service ignored", Config{"other.publish": {Error: 1}}, 0, nil, 0},
+		{"uniform", Config{Publish: {Latency: &Latency{Probability: 1, Min: ms(100), Max: ms(300)}}}, 0.5, nil, 200 * time.Millisecond},
+		{"fixed", Config{Publish: {Latency: &Latency{Probability: 1, Distribution: "fixed", Min: ms(100), Max: ms(300)}}}, 0.5, nil, 100 * time.Millisecond},
+		{"exponential", Config{Publish: {Latency: &Latency{Probability: 1, Distribution: "exponential", Min: ms(10), Mean: ms(100)}}}, 1 - 1/math.E, nil, 110 * time.Millisecond},
+		{"exponential capped", Config{Publish: {Latency: &Latency{Probability: 1, Distribution: "exponential", Mean: ms(100), Max: ms(50)}}}, 0.99, nil, 50 * time.Millisecond},
+		{"latency missed", Config{Publish: {Latency: &Latency{Probability: 0.5, Min: ms(100)}}}, 0.5, nil, 0},
+		{"latency then error", Config{Publish: {Error: 1, Latency: &Latency{Probability: 1, Distribution: "fixed", Min: ms(5)}}}, 0.5, ErrInjected, 5 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var slept time.Duration
+			in := newTest(tt.cfg, tt.u, &slept)
+			if err := in.Inject(context.Background(), Publish); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Inject() error = %v, want %v", err, tt.wantErr)
+			}
+			if d := slept - tt.wantSleep; d < -time.Microsecond || d > time.Microsecond {
+				t.Errorf("slept %v, want %v", slept, tt.wantSleep)
+			}
+		})
+	}
+}
+
+func TestInjector_Nil(t *testing.T) {
+	var in *Injector
+	if err := in.Inject(context.Background(), DB); err != nil {
+		t.Fatalf("nil Injector: %v", err)
+	}
+}
+
+func TestInjector_SleepHonorsContext(t *testing.T) {
+	in := New("svc", fixedSource(Config{DB: {Latency: &Latency{Probability: 1, Distribution: "fixed", Min: Duration(time.Hour)}}}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := in.Inject(ctx, DB); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Inject() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestConfig_JSON(t *testing.T) {
+	raw := `{"gatewaysvc.publish":{"latency":{"probability":0.5,"min":"10ms","max":"1s"},"error":0.1}}`
+	var cfg Config
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	l := cfg["gatewaysvc.publish"].Latency
+	if l == nil || time.Duration(l.Min) != 10*time.Millisecond || time.Duration(l.Max) != time.Second {
+		t.Fatalf("Latency = %+v", l)
+	}
+	if err := json.Unmarshal([]byte(`{"db":{"latency":{"min":"soon"}}}`), &cfg); err == nil {
+		t.Fatal("invalid duration accepted")
+	}
+}
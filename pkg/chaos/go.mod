@@ -0,0 +1,3 @@
+module rxw1/chaos
+
+go 1.25.0
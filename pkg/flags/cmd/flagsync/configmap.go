@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+const configMapKey = "  flags.json: |\n"
+
+// renderConfigMap replaces the flags.json block of the configmap with the
+// definition file, keeping everything before it.
+func renderConfigMap(cm, flagsJSON []byte) []byte {
+	var buf bytes.Buffer
+	if i := bytes.Index(cm, []byte(configMapKey)); i >= 0 {
+		buf.Write(cm[:i])
+	} else {
+		buf.WriteString(configMapHeader)
+	}
+	buf.WriteString(configMapKey)
+	for line := range strings.Lines(string(flagsJSON)) {
+		if strings.TrimSpace(line) != "" {
+			buf.WriteString("    ")
+		}
+		buf.WriteString(strings.TrimRight(line, " \t\n") + "\n")
+	}
+	return buf.Bytes()
+}
+
+const configMapHeader = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: flagd-config
+  labels:
+    app: flagd
+data:
+`
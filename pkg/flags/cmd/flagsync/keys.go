@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"unicode"
+)
+
+// keyTypes maps a flag kind to the key type in package flags.
+var keyTypes = map[kind]string{
+	kindBool:   "Key[bool]",
+	kindString: "Key[string]",
+	kindInt:    "Key[int64]",
+	kindFloat:  "Key[float64]",
+	kindObject: "ObjectKey",
+}
+
+// renderKeys writes a typed key constant for every flag.
+func renderKeys(defs []flagDef) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by flagsync from %s; DO NOT EDIT.\n\n", flagsFile)
+	buf.WriteString("package flags\n\nconst (\n")
+	for _, d := range defs {
+		fmt.Fprintf(&buf, "\t// %s defaults to variant %q.\n", ident(d.Name), d.DefaultVariant)
+		fmt.Fprintf(&buf, "\t%s %s = %q\n", ident(d.Name), keyTypes[d.Kind], d.Name)
+	}
+	buf.WriteString(")\n")
+	return format.Source(buf.Bytes())
+}
+
+// ident turns a flag key such as "redisCacheEnabled" or "new-checkout" into
+// an exported Go identifier.
+func ident(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
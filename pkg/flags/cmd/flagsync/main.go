@@ -0,0 +1,145 @@
+// Command flagsync keeps the flagd definitions and their copies in sync.
+//
+//	flagsync validate   check infra/flagd/flags.json against the flagd schema
+//	flagsync generate   rewrite pkg/flags/keys_gen.go and the flagd configmap
+//	flagsync check      validate, and fail if the generated files are stale,
+//	                    code uses an unknown flag or a flag with the wrong
+//	                    type, or a flag is never used
+//
+// Paths are relative to -root, the repository root.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	flagsFile     = "infra/flagd/flags.json"
+	configMapFile = "infra/flagd/chart/templates/configmap-flags.yaml"
+	keysFile      = "pkg/flags/keys_gen.go"
+)
+
+// sourceDirs are scanned for flag usage.
+var sourceDirs = []string{"pkg", "services"}
+
+func main() {
+	root := flag.String("root", ".", "repository root")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: flagsync [-root dir] validate|generate|check")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var problems []error
+	switch flag.Arg(0) {
+	case "validate":
+		_, problems = load(*root)
+	case "generate":
+		problems = generate(*root)
+	case "check":
+		problems = check(*root)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+func load(root string) ([]flagDef, []error) {
+	b, err := os.ReadFile(filepath.Join(root, flagsFile))
+	if err != nil {
+		return nil, []error{err}
+	}
+	defs, errs := parse(b)
+	for i, err := range errs {
+		errs[i] = fmt.Errorf("%s: %w", flagsFile, err)
+	}
+	return defs, errs
+}
+
+func generate(root string) []error {
+	defs, errs := load(root)
+	if len(errs) > 0 {
+		return errs
+	}
+	b, err := os.ReadFile(filepath.Join(root, flagsFile))
+	if err != nil {
+		return []error{err}
+	}
+	cm, err := os.ReadFile(filepath.Join(root, configMapFile))
+	if err != nil {
+		return []error{err}
+	}
+	keys, err := renderKeys(defs)
+	if err != nil {
+		return []error{err}
+	}
+	if err := os.WriteFile(filepath.Join(root, keysFile), keys, 0o644); err != nil {
+		return []error{err}
+	}
+	if err := os.WriteFile(filepath.Join(root, configMapFile), renderConfigMap(cm, b), 0o644); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+func check(root string) []error {
+	defs, errs := load(root)
+	if len(errs) > 0 {
+		return errs
+	}
+	b, err := os.ReadFile(filepath.Join(root, flagsFile))
+	if err != nil {
+		return []error{err}
+	}
+
+	keys, err := renderKeys(defs)
+	if err != nil {
+		return []error{err}
+	}
+	if err := unchanged(root, keysFile, keys); err != nil {
+		errs = append(errs, err)
+	}
+	if cm, err := os.ReadFile(filepath.Join(root, configMapFile)); err != nil {
+		errs = append(errs, err)
+	} else if err := unchanged(root, configMapFile, renderConfigMap(cm, b)); err != nil {
+		errs = append(errs, err)
+	}
+
+	var dirs []string
+	for _, d := range sourceDirs {
+		dirs = append(dirs, filepath.Join(root, d))
+	}
+	refs, err := scan(dirs...)
+	if err != nil {
+		return append(errs, err)
+	}
+	return append(errs, verify(defs, refs)...)
+}
+
+var errStale = errors.New("stale, run flagsync generate")
+
+func unchanged(root, name string, want []byte) error {
+	got, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("%s: %w", name, errStale)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// kind is the value type shared by a flag's variants.
+type kind string
+
+const (
+	kindBool   kind = "boolean"
+	kindString kind = "string"
+	kindInt    kind = "integer"
+	kindFloat  kind = "number"
+	kindObject kind = "object"
+)
+
+type flagDef struct {
+	Name           string
+	DefaultVariant string
+	Kind           kind
+}
+
+// parse checks a flag definition file against the rules of the flagd v0
+// schema (https://flagd.dev/schema/v0/flags.json) and returns the flags
+// sorted by name. It reports every problem, not just the first.
+func parse(b []byte) ([]flagDef, []error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(b, &top); err != nil {
+		return nil, []error{err}
+	}
+
+	var errs []error
+	for k := range top {
+		switch k {
+		case "$schema", "$evaluators", "metadata", "flags":
+		default:
+			errs = append(errs, fmt.Errorf("unknown property %q", k))
+		}
+	}
+	if raw, ok := top["$evaluators"]; ok && !isObject(raw) {
+		errs = append(errs, fmt.Errorf("$evaluators must be an object"))
+	}
+	if raw, ok := top["metadata"]; ok {
+		errs = append(errs, checkMetadata("metadata", raw)...)
+	}
+
+	raw, ok := top["flags"]
+	if !ok {
+		return nil, append(errs, fmt.Errorf("missing flags"))
+	}
+	var flags map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &flags); err != nil {
+		return nil, append(errs, fmt.Errorf("flags: must be an object"))
+	}
+
+	var defs []flagDef
+	for name, raw := range flags {
+		def, ferrs := parseFlag(name, raw)
+		for _, err := range ferrs {
+			errs = append(errs, fmt.Errorf("flag %s: %w", name, err))
+		}
+		if len(ferrs) == 0 {
+			defs = append(defs, def)
+		}
+	}
+	slices.SortFunc(defs, func(a, b flagDef) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	slices.SortFunc(errs, func(a, b error) int {
+		return cmp.Compare(a.Error(), b.Error())
+	})
+	return defs, errs
+}
+
+func parseFlag(name string, raw json.RawMessage) (flagDef, []error) {
+	def := flagDef{Name: name}
+	if name == "" {
+		return def, []error{fmt.Errorf("empty flag key")}
+	}
+	var f map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return def, []error{fmt.Errorf("must be an object")}
+	}
+
+	var errs []error
+	for k := range f {
+		switch k {
+		case "state", "variants", "defaultVariant", "targeting", "metadata":
+		default:
+			errs = append(errs, fmt.Errorf("unknown property %q", k))
+		}
+	}
+
+	var state string
+	if err := json.Unmarshal(f["state"], &state); err != nil || (state != "ENABLED" && state != "DISABLED") {
+		errs = append(errs, fmt.Errorf("state must be ENABLED or DISABLED"))
+	}
+
+	var variants map[string]json.RawMessage
+	if err := json.Unmarshal(f["variants"], &variants); err != nil || len(variants) == 0 {
+		errs = append(errs, fmt.Errorf("variants must be a non-empty object"))
+	}
+	names := make([]string, 0, len(variants))
+	for v := range variants {
+		names = append(names, v)
+	}
+	slices.Sort(names)
+	for _, v := range names {
+		k, err := variantKind(variants[v])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("variant %s: %w", v, err))
+			continue
+		}
+		switch {
+		case def.Kind == "", def.Kind == k:
+			def.Kind = k
+		case numeric(def.Kind) && numeric(k):
+			def.Kind = kindFloat
+		default:
+			errs = append(errs, fmt.Errorf("variant %s is %s, others are %s", v, k, def.Kind))
+		}
+	}
+
+	if err := json.Unmarshal(f["defaultVariant"], &def.DefaultVariant); err != nil {
+		errs = append(errs, fmt.Errorf("defaultVariant must be a string"))
+	} else if _, ok := variants[def.DefaultVariant]; !ok && len(variants) > 0 {
+		errs = append(errs, fmt.Errorf("defaultVariant %q is not a variant", def.DefaultVariant))
+	}
+
+	if raw, ok := f["targeting"]; ok && !isObject(raw) {
+		errs = append(errs, fmt.Errorf("targeting must be an object"))
+	}
+	if raw, ok := f["metadata"]; ok {
+		errs = append(errs, checkMetadata("metadata", raw)...)
+	}
+	return def, errs
+}
+
+func variantKind(raw json.RawMessage) (kind, error) {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case bool:
+		return kindBool, nil
+	case string:
+		return kindString, nil
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return kindInt, nil
+		}
+		return kindFloat, nil
+	case map[string]any:
+		return kindObject, nil
+	default:
+		return "", fmt.Errorf("unsupported value %s", raw)
+	}
+}
+
+// checkMetadata enforces the schema's flat metadata: primitive values only.
+func checkMetadata(path string, raw json.RawMessage) []error {
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return []error{fmt.Errorf("%s must be an object", path)}
+	}
+	var errs []error
+	for k, v := range m {
+		switch v.(type) {
+		case bool, string, float64:
+		default:
+			errs = append(errs, fmt.Errorf("%s.%s must be a boolean, string or number", path, k))
+		}
+	}
+	return errs
+}
+
+func isObject(raw json.RawMessage) bool {
+	var m map[string]json.RawMessage
+	return json.Unmarshal(raw, &m) == nil && m != nil
+}
+
+func numeric(k kind) bool {
+	return k == kindInt || k == kindFloat
+}
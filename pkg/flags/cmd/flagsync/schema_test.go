@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want []flagDef
+		errs []string // substrings, one per expected problem
+	}{
+		{
+			name: "valid",
+			json: `{"$schema": "x", "flags": {
+				"b": {"state": "ENABLED", "defaultVariant": "on", "variants": {"on": true, "off": false}},
+				"a": {"state": "DISABLED", "defaultVariant": "lo", "variants": {"lo": 1, "hi": 2.5}, "targeting": {}}
+			}}`,
+			want: []flagDef{
+				{Name: "a", DefaultVariant: "lo", Kind: kindFloat},
+				{Name: "b", DefaultVariant: "on", Kind: kindBool},
+			},
+		},
+		{
+			name: "missing flags",
+			json: `{}`,
+			errs: []string{"missing flags"},
+		},
+		{
+			name: "bad state and default",
+			json: `{"flags": {"x": {"state": "ON", "defaultVariant": "nope", "variants": {"on": true}}}}`,
+			errs: []string{`defaultVariant "nope" is not a variant`, "state must be ENABLED or DISABLED"},
+		},
+		{
+			name: "mixed variant types",
+			json: `{"flags": {"x": {"state": "ENABLED", "defaultVariant": "a", "variants": {"a": true, "b": "no"}}}}`,
+			errs: []string{"variant b is string, others are boolean"},
+		},
+		{
+			name: "unknown property",
+			json: `{"flags": {"x": {"state": "ENABLED", "defaultVariant": "a", "variants": {"a": "s"}, "default": "a"}}}`,
+			errs: []string{`unknown property "default"`},
+		},
+		{
+			name: "no variants",
+			json: `{"flags": {"x": {"state": "ENABLED", "defaultVariant": "a", "variants": {}}}}`,
+			errs: []string{"variants must be a non-empty object"},
+		},
+		{
+			name: "nested metadata",
+			json: `{"flags": {}, "metadata": {"owner": {"team": "orders"}}}`,
+			errs: []string{"metadata.owner must be a boolean, string or number"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := parse([]byte(tt.json))
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("parse() errors = %v, want %d", errs, len(tt.errs))
+			}
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), tt.errs[i]) {
+					t.Errorf("error %d = %q, want %q", i, err, tt.errs[i])
+				}
+			}
+			if tt.want != nil && !equalDefs(got, tt.want) {
+				t.Errorf("parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderConfigMap(t *testing.T) {
+	cm := "kind: ConfigMap\ndata:\n  flags.json: |\n    {}\n"
+	got := string(renderConfigMap([]byte(cm), []byte("{\n  \"flags\": {}\n}\n")))
+	want := "kind: ConfigMap\ndata:\n  flags.json: |\n    {\n      \"flags\": {}\n    }\n"
+	if got != want {
+		t.Errorf("renderConfigMap() = %q, want %q", got, want)
+	}
+}
+
+func equalDefs(a, b []flagDef) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
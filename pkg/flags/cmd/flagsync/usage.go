@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const flagsImport = "rxw1/flags"
+
+// ref is one use of a flag in code, either through a generated key constant
+// (Const) or a string literal passed to an accessor (Name). Kind is what the
+// accessor evaluates, empty for keys passed to anything else.
+type ref struct {
+	Pos   token.Position
+	Const string
+	Name  string
+	Kind  kind
+}
+
+// accessors maps the flags methods taking a key to the kind they evaluate.
+var accessors = map[string]kind{
+	"Bool":   kindBool,
+	"Set":    kindBool,
+	"String": kindString,
+	"Int":    kindInt,
+	"Float":  kindFloat,
+}
+
+// scan collects flag references from the non-test Go files under dirs. It
+// works on syntax alone, so literal keys are only found in direct calls.
+func scan(dirs ...string) ([]ref, error) {
+	fset := token.NewFileSet()
+	var refs []ref
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if d.Name() == "node_modules" || d.Name() == "testdata" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") || filepath.Base(path) == filepath.Base(keysFile) {
+				return nil
+			}
+			f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, fileRefs(fset, f)...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+func fileRefs(fset *token.FileSet, f *ast.File) []ref {
+	// Inside package flags keys are bare identifiers; elsewhere they are
+	// selectors on the import name.
+	local := f.Name.Name == "flags"
+	pkg := ""
+	for _, imp := range f.Imports {
+		if p, _ := strconv.Unquote(imp.Path.Value); p == flagsImport {
+			pkg = "flags"
+			if imp.Name != nil {
+				pkg = imp.Name.Name
+			}
+		}
+	}
+	if !local && pkg == "" {
+		return nil
+	}
+
+	// keyName returns the constant named by e, if e can name one.
+	keyName := func(e ast.Expr) string {
+		switch e := e.(type) {
+		case *ast.Ident:
+			if local {
+				return e.Name
+			}
+		case *ast.SelectorExpr:
+			if x, ok := e.X.(*ast.Ident); ok && x.Name == pkg {
+				return e.Sel.Name
+			}
+		}
+		return ""
+	}
+
+	var refs []ref
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+
+		var arg ast.Expr
+		var k kind
+		fun := call.Fun
+		if ix, ok := fun.(*ast.IndexExpr); ok {
+			fun = ix.X
+		}
+		if keyName(fun) == "Object" && len(call.Args) == 4 {
+			arg, k = call.Args[2], kindObject
+		} else if sel, ok := fun.(*ast.SelectorExpr); ok && len(call.Args) >= 3 {
+			if k, ok = accessors[sel.Sel.Name]; ok {
+				arg = call.Args[1]
+			}
+		}
+
+		for _, a := range call.Args {
+			r := ref{Pos: fset.Position(a.Pos())}
+			if a == arg {
+				r.Kind = k
+				if lit, ok := a.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					r.Name, _ = strconv.Unquote(lit.Value)
+				}
+			}
+			if r.Name == "" {
+				// Keys passed along to other functions still count as uses.
+				if r.Const = keyName(a); r.Const == "" {
+					continue
+				}
+			}
+			refs = append(refs, r)
+		}
+		return true
+	})
+	return refs
+}
+
+// verify reports references to unknown flags or with the wrong type, and
+// flags that are never referenced.
+func verify(defs []flagDef, refs []ref) []error {
+	byName := map[string]flagDef{}
+	byConst := map[string]flagDef{}
+	for _, d := range defs {
+		byName[d.Name] = d
+		byConst[ident(d.Name)] = d
+	}
+
+	var errs []error
+	used := map[string]bool{}
+	for _, r := range refs {
+		d, ok := byName[r.Name]
+		if r.Const != "" {
+			d, ok = byConst[r.Const]
+			if !ok {
+				// Not a key constant, e.g. a local variable.
+				continue
+			}
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown flag %q", r.Pos, r.Name))
+			continue
+		}
+		used[d.Name] = true
+		if r.Kind != "" && !compatible(d.Kind, r.Kind) {
+			errs = append(errs, fmt.Errorf("%s: flag %s is %s, used as %s", r.Pos, d.Name, d.Kind, r.Kind))
+		}
+	}
+	for _, d := range defs {
+		if !used[d.Name] {
+			errs = append(errs, fmt.Errorf("%s: flag %s is never used", flagsFile, d.Name))
+		}
+	}
+	return errs
+}
+
+// compatible reports whether a flag of kind def can be evaluated as use.
+// Integer flags may be read as floats.
+func compatible(def, use kind) bool {
+	return def == use || (def == kindInt && use == kindFloat)
+}
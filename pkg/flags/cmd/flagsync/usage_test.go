@@ -0,0 +1,63 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	defs := []flagDef{
+		{Name: "redisCacheEnabled", Kind: kindBool},
+		{Name: "maxItems", Kind: kindInt},
+		{Name: "chaos", Kind: kindObject},
+		{Name: "banner", Kind: kindString},
+	}
+	src := `package svc
+
+import ff "rxw1/flags"
+
+func f(ctx context.Context, f *ff.Flags) {
+	f.Bool(ctx, ff.RedisCacheEnabled, false)
+	f.Float(ctx, "maxItems", 1)
+	f.String(ctx, "maxItems", "")
+	f.Bool(ctx, "missing", false)
+	_ = ff.Object[map[string]any](ctx, f, ff.Chaos, nil)
+	slog.String("banner", "x")
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "svc.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := verify(defs, fileRefs(fset, file))
+	want := []string{
+		"svc.go:8:16: flag maxItems is integer, used as string",
+		`svc.go:9:14: unknown flag "missing"`,
+		"flag banner is never used",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("verify() = %v, want %d errors", errs, len(want))
+	}
+	for i, err := range errs {
+		if !strings.Contains(err.Error(), want[i]) {
+			t.Errorf("error %d = %q, want %q", i, err, want[i])
+		}
+	}
+}
+
+func TestIdent(t *testing.T) {
+	tests := map[string]string{
+		"redisCacheEnabled": "RedisCacheEnabled",
+		"new-checkout":      "NewCheckout",
+		"v2_pricing":        "V2Pricing",
+	}
+	for in, want := range tests {
+		if got := ident(in); got != want {
+			t.Errorf("ident(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
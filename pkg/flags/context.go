@@ -0,0 +1,58 @@
+package flags
+
+import (
+	"context"
+
+	of "github.com/open-feature/go-sdk/openfeature"
+)
+
+type targetKey struct{}
+
+// target is who a flag is evaluated for. It travels in the request context so
+// call sites deep in a service need not thread it through.
+type target struct {
+	userID    string
+	requestID string
+}
+
+// WithUserID makes evaluations under ctx target the given user.
+func WithUserID(ctx context.Context, id string) context.Context {
+	t := targetFrom(ctx)
+	t.userID = id
+	return context.WithValue(ctx, targetKey{}, t)
+}
+
+// WithRequestID records the request ID for evaluations under ctx.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	t := targetFrom(ctx)
+	t.requestID = id
+	return context.WithValue(ctx, targetKey{}, t)
+}
+
+func targetFrom(ctx context.Context) target {
+	t, _ := ctx.Value(targetKey{}).(target)
+	return t
+}
+
+// evalContext builds the OpenFeature context for ctx. The targeting key is
+// the user so percentage rollouts are sticky; anonymous callers fall back to
+// the request ID.
+func (f *Flags) evalContext(ctx context.Context) of.EvaluationContext {
+	t := targetFrom(ctx)
+	attrs := map[string]any{"service": f.service}
+	if f.environment != "" {
+		attrs["environment"] = f.environment
+	}
+	if t.userID != "" {
+		attrs["userId"] = t.userID
+	}
+	if t.requestID != "" {
+		attrs["requestId"] = t.requestID
+	}
+
+	key := t.userID
+	if key == "" {
+		key = t.requestID
+	}
+	return of.NewEvaluationContext(key, attrs)
+}
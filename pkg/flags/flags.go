@@ -1,7 +1,11 @@
 package flags
 
+//go:generate go run ./cmd/flagsync -root ../.. generate
+
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
 
 	"rxw1/logging"
@@ -9,32 +13,168 @@ import (
 	of "github.com/open-feature/go-sdk/openfeature"
 )
 
+// Key names a flag whose variants are of type T. The constants in
+// keys_gen.go are generated from infra/flagd/flags.json.
+type Key[T any] string
+
+// ObjectKey names a flag whose variants are JSON objects; see Object.
+type ObjectKey string
+
 type Flags struct {
-	client *of.Client
+	client      *of.Client
+	service     string
+	environment string
+	overrides   *Overrides
+}
+
+type Option func(*Flags)
+
+// WithOverrides makes runtime overrides take precedence over flagd for
+// boolean flags and enables Set.
+func WithOverrides(o *Overrides) Option {
+	return func(f *Flags) { f.overrides = o }
 }
 
-func New(clientName string) *Flags {
-	return &Flags{
-		client: of.NewClient(clientName),
+// WithEnvironment adds an environment attribute to every evaluation.
+func WithEnvironment(env string) Option {
+	return func(f *Flags) { f.environment = env }
+}
+
+// New returns flags evaluated by the provider registered for clientName,
+// which doubles as the service attribute of the evaluation context.
+func New(clientName string, opts ...Option) *Flags {
+	f := &Flags{
+		client:  of.NewClient(clientName),
+		service: clientName,
+	}
+	for _, opt := range opts {
+		opt(f)
 	}
+	return f
 }
 
 func (f *Flags) RedisEnabled(ctx context.Context) bool {
-	val, err := f.client.BooleanValue(ctx, "redisCacheEnabled", false, of.EvaluationContext{})
+	return f.Bool(ctx, RedisCacheEnabled, false)
+}
+
+func (f *Flags) ThrottleEnabled(ctx context.Context) bool {
+	return f.Bool(ctx, ThrottleEnabled, false)
+}
+
+var ErrReadOnly = errors.New("flags: no override store configured")
+
+// Set overrides a boolean flag for every instance sharing the override store.
+func (f *Flags) Set(ctx context.Context, key Key[bool], value bool, by string) (Change, error) {
+	if f.overrides == nil {
+		return Change{}, ErrReadOnly
+	}
+	return f.overrides.Set(ctx, string(key), value, by)
+}
+
+// Clear removes the override of a boolean flag, so flagd decides its value
+// again.
+func (f *Flags) Clear(ctx context.Context, key Key[bool], by string) (Change, error) {
+	if f.overrides == nil {
+		return Change{}, ErrReadOnly
+	}
+	return f.overrides.Clear(ctx, string(key), by)
+}
+
+// Changes streams flag overrides until ctx is done.
+func (f *Flags) Changes(ctx context.Context) (<-chan Change, error) {
+	if f.overrides == nil {
+		return nil, ErrReadOnly
+	}
+	return f.overrides.Watch(ctx), nil
+}
+
+// Bool evaluates key for the caller in ctx. Overrides win over flagd.
+func (f *Flags) Bool(ctx context.Context, key Key[bool], def bool) bool {
+	name := string(key)
+	if f.overrides != nil {
+		if val, ok := f.overrides.Bool(name); ok {
+			logging.From(ctx).Debug("flag",
+				slog.String("name", name),
+				slog.Bool("value", val),
+				slog.Bool("override", true),
+			)
+			return val
+		}
+	}
+
+	val, err := f.client.BooleanValue(ctx, name, def, f.evalContext(ctx))
+	return result(ctx, name, val, def, err)
+}
+
+func (f *Flags) String(ctx context.Context, key Key[string], def string) string {
+	val, err := f.client.StringValue(ctx, string(key), def, f.evalContext(ctx))
+	return result(ctx, string(key), val, def, err)
+}
+
+func (f *Flags) Int(ctx context.Context, key Key[int64], def int64) int64 {
+	val, err := f.client.IntValue(ctx, string(key), def, f.evalContext(ctx))
+	return result(ctx, string(key), val, def, err)
+}
+
+func (f *Flags) Float(ctx context.Context, key Key[float64], def float64) float64 {
+	val, err := f.client.FloatValue(ctx, string(key), def, f.evalContext(ctx))
+	return result(ctx, string(key), val, def, err)
+}
+
+// Object decodes the object flag key into a T. It returns def if the flag is
+// missing or does not decode.
+func Object[T any](ctx context.Context, f *Flags, key ObjectKey, def T) T {
+	name := string(key)
+	val, err := f.client.ObjectValue(ctx, name, nil, f.evalContext(ctx))
 	logging.From(ctx).Debug("flag",
-		slog.String("name", "redisCacheEnabled"),
-		slog.Bool("value", val),
+		slog.String("name", name),
+		slog.Any("value", val),
 		slog.Any("error", err),
 	)
-	return err == nil && val
+	if err != nil || val == nil {
+		return def
+	}
+
+	// flagd hands out decoded JSON; round-trip it into the typed value.
+	b, err := json.Marshal(val)
+	if err != nil {
+		return def
+	}
+	var out T
+	if err := json.Unmarshal(b, &out); err != nil {
+		logging.From(ctx).Warn("invalid object flag", "name", name, "error", err)
+		return def
+	}
+	return out
 }
 
-func (f *Flags) ThrottleEnabled(ctx context.Context) bool {
-	val, err := f.client.BooleanValue(ctx, "throttleEnabled", false, of.EvaluationContext{})
+func result[T any](ctx context.Context, name string, val, def T, err error) T {
 	logging.From(ctx).Debug("flag",
-		slog.String("name", "throttleEnabled"),
-		slog.Bool("value", val),
+		slog.String("name", name),
+		slog.Any("value", val),
 		slog.Any("error", err),
 	)
-	return err == nil && val
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+// RateLimit is a token bucket: Burst requests at once, refilled at PerMinute.
+type RateLimit struct {
+	PerMinute int `json:"perMinute"`
+	Burst     int `json:"burst"`
+}
+
+// DefaultRateLimits apply when the rateLimits flag is missing. Keys are root
+// field names; "*" applies to every field without its own entry.
+var DefaultRateLimits = map[string]RateLimit{
+	"createOrder": {PerMinute: 30, Burst: 10},
+	"placeOrder":  {PerMinute: 30, Burst: 10},
+	"cancelOrder": {PerMinute: 30, Burst: 10},
+	"*":           {PerMinute: 600, Burst: 100},
+}
+
+func (f *Flags) RateLimits(ctx context.Context) map[string]RateLimit {
+	return Object(ctx, f, RateLimits, DefaultRateLimits)
 }
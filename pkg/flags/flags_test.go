@@ -2,26 +2,144 @@ package flags_test
 
 import (
 	"context"
+	"encoding/json"
+	"os"
+	"reflect"
 	"testing"
 
 	"rxw1/flags"
+	"rxw1/flags/flagstest"
+
+	of "github.com/open-feature/go-sdk/openfeature"
 )
 
 func TestFlags_RedisEnabled(t *testing.T) {
 	tests := []struct {
-		name string // description of this test case
-		want bool
+		name   string // description of this test case
+		values map[string]any
+		want   bool
 	}{
-		// TODO: Add test cases.
+		{"enabled", map[string]any{"redisCacheEnabled": true}, true},
+		{"disabled", map[string]any{"redisCacheEnabled": false}, false},
+		{"missing flag", map[string]any{}, false},
+		{"wrong type", map[string]any{"redisCacheEnabled": "yes"}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			f := flags.New("test-client")
+			f, _ := flagstest.New(t, tt.values)
 			got := f.RedisEnabled(context.Background())
-			// TODO: update the condition below to compare got with tt.want.
-			if true {
+			if got != tt.want {
 				t.Errorf("RedisEnabled() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestFlags_TypedDefaults(t *testing.T) {
+	ctx := context.Background()
+	f, p := flagstest.New(t, nil)
+
+	if got := f.String(ctx, "banner", "none"); got != "none" {
+		t.Errorf("String() = %q, want default", got)
+	}
+	if got := f.Int(ctx, "maxItems", 5); got != 5 {
+		t.Errorf("Int() = %d, want default", got)
+	}
+
+	p.Set("banner", "sale")
+	p.Set("maxItems", int64(20))
+	p.Set("ratio", 0.25)
+	if got := f.String(ctx, "banner", "none"); got != "sale" {
+		t.Errorf("String() = %q, want sale", got)
+	}
+	if got := f.Int(ctx, "maxItems", 5); got != 20 {
+		t.Errorf("Int() = %d, want 20", got)
+	}
+	if got := f.Float(ctx, "ratio", 1); got != 0.25 {
+		t.Errorf("Float() = %v, want 0.25", got)
+	}
+}
+
+func TestObject(t *testing.T) {
+	ctx := context.Background()
+	f, p := flagstest.New(t, nil)
+
+	if got := f.RateLimits(ctx); got["*"] != flags.DefaultRateLimits["*"] {
+		t.Errorf("RateLimits() = %v, want defaults", got)
+	}
+
+	p.Set("rateLimits", map[string]any{
+		"createOrder": map[string]any{"perMinute": 1, "burst": 2},
+	})
+	got := f.RateLimits(ctx)
+	if len(got) != 1 || got["createOrder"] != (flags.RateLimit{PerMinute: 1, Burst: 2}) {
+		t.Errorf("RateLimits() = %v", got)
+	}
+
+	p.Set("rateLimits", map[string]any{"createOrder": "fast"})
+	if got := f.RateLimits(ctx); got["*"] != flags.DefaultRateLimits["*"] {
+		t.Errorf("RateLimits() = %v, want defaults for undecodable value", got)
+	}
+}
+
+// TestDefaultRateLimits keeps the fallback limits in step with the default
+// variant flagd serves, so order mutations are limited the same either way.
+func TestDefaultRateLimits(t *testing.T) {
+	b, err := os.ReadFile("../../infra/flagd/flags.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var defs struct {
+		Flags struct {
+			RateLimits struct {
+				Variants map[string]map[string]flags.RateLimit
+			} `json:"rateLimits"`
+		}
+	}
+	if err := json.Unmarshal(b, &defs); err != nil {
+		t.Fatal(err)
+	}
+	if got := defs.Flags.RateLimits.Variants["default"]; !reflect.DeepEqual(got, flags.DefaultRateLimits) {
+		t.Errorf("flags.json rateLimits default = %v, want DefaultRateLimits %v", got, flags.DefaultRateLimits)
+	}
+	for _, field := range []string{"placeOrder", "cancelOrder"} {
+		if got, want := flags.DefaultRateLimits[field], flags.DefaultRateLimits["createOrder"]; got.PerMinute == 0 || got.PerMinute > want.PerMinute || got.Burst > want.Burst {
+			t.Errorf("DefaultRateLimits[%s] = %+v, want at most createOrder's %+v", field, got, want)
+		}
+	}
+}
+
+func TestEvaluationContext(t *testing.T) {
+	var seen of.FlattenedContext
+	f, _ := flagstest.New(t, map[string]any{
+		"throttleEnabled": flagstest.Rule(func(ec of.FlattenedContext) any {
+			seen = ec
+			return ec["userId"] == "u1"
+		}),
+	}, flags.WithEnvironment("test"))
+
+	ctx := flags.WithRequestID(context.Background(), "r1")
+	if f.ThrottleEnabled(ctx) {
+		t.Error("ThrottleEnabled() = true for anonymous caller")
+	}
+	if seen[of.TargetingKey] != "r1" {
+		t.Errorf("targeting key = %v, want request ID", seen[of.TargetingKey])
+	}
+
+	ctx = flags.WithUserID(ctx, "u1")
+	if !f.ThrottleEnabled(ctx) {
+		t.Error("ThrottleEnabled() = false for u1")
+	}
+	want := map[string]any{
+		of.TargetingKey: "u1",
+		"userId":        "u1",
+		"requestId":     "r1",
+		"environment":   "test",
+		"service":       "flagstest/" + t.Name(),
+	}
+	for k, v := range want {
+		if seen[k] != v {
+			t.Errorf("context[%s] = %v, want %v", k, seen[k], v)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package flagstest provides an in-memory OpenFeature provider so tests can
+// pin flag values without a running flagd.
+package flagstest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"rxw1/flags"
+
+	of "github.com/open-feature/go-sdk/openfeature"
+)
+
+// Rule computes a flag value from the flattened evaluation context, for tests
+// that exercise per-user or per-service targeting.
+type Rule func(ec of.FlattenedContext) any
+
+// Provider serves flag values from a map. Values are Rules or plain values of
+// the exact evaluated type (int64 for Int, float64 for Float); anything else
+// is a type mismatch and flags that are not set resolve to FLAG_NOT_FOUND.
+type Provider struct {
+	mu     sync.RWMutex
+	values map[string]any
+}
+
+func NewProvider(values map[string]any) *Provider {
+	p := &Provider{values: map[string]any{}}
+	for k, v := range values {
+		p.values[k] = v
+	}
+	return p
+}
+
+// Set changes a flag for subsequent evaluations.
+func (p *Provider) Set(flag string, value any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.values[flag] = value
+}
+
+// New registers a fresh provider under a client name unique to t and returns
+// flags bound to it, so parallel tests do not see each other's values.
+func New(t testing.TB, values map[string]any, opts ...flags.Option) (*flags.Flags, *Provider) {
+	t.Helper()
+	p := NewProvider(values)
+	name := fmt.Sprintf("flagstest/%s", t.Name())
+	if err := of.SetNamedProviderAndWait(name, p); err != nil {
+		t.Fatalf("flagstest: %v", err)
+	}
+	return flags.New(name, opts...), p
+}
+
+func (p *Provider) Metadata() of.Metadata {
+	return of.Metadata{Name: "flagstest"}
+}
+
+func (p *Provider) Hooks() []of.Hook {
+	return nil
+}
+
+func (p *Provider) BooleanEvaluation(_ context.Context, flag string, def bool, ec of.FlattenedContext) of.BoolResolutionDetail {
+	v, detail := resolve(p, flag, def, ec)
+	return of.BoolResolutionDetail{Value: v, ProviderResolutionDetail: detail}
+}
+
+func (p *Provider) StringEvaluation(_ context.Context, flag string, def string, ec of.FlattenedContext) of.StringResolutionDetail {
+	v, detail := resolve(p, flag, def, ec)
+	return of.StringResolutionDetail{Value: v, ProviderResolutionDetail: detail}
+}
+
+func (p *Provider) FloatEvaluation(_ context.Context, flag string, def float64, ec of.FlattenedContext) of.FloatResolutionDetail {
+	v, detail := resolve(p, flag, def, ec)
+	return of.FloatResolutionDetail{Value: v, ProviderResolutionDetail: detail}
+}
+
+func (p *Provider) IntEvaluation(_ context.Context, flag string, def int64, ec of.FlattenedContext) of.IntResolutionDetail {
+	v, detail := resolve(p, flag, def, ec)
+	return of.IntResolutionDetail{Value: v, ProviderResolutionDetail: detail}
+}
+
+func (p *Provider) ObjectEvaluation(_ context.Context, flag string, def any, ec of.FlattenedContext) of.InterfaceResolutionDetail {
+	v, detail := resolve(p, flag, def, ec)
+	return of.InterfaceResolutionDetail{Value: v, ProviderResolutionDetail: detail}
+}
+
+func resolve[T any](p *Provider, flag string, def T, ec of.FlattenedContext) (T, of.ProviderResolutionDetail) {
+	p.mu.RLock()
+	v, ok := p.values[flag]
+	p.mu.RUnlock()
+	if !ok {
+		return def, of.ProviderResolutionDetail{
+			ResolutionError: of.NewFlagNotFoundResolutionError(flag),
+			Reason:          of.ErrorReason,
+		}
+	}
+
+	reason := of.StaticReason
+	if rule, ok := v.(Rule); ok {
+		v, reason = rule(ec), of.TargetingMatchReason
+	}
+	typed, ok := v.(T)
+	if !ok {
+		return def, of.ProviderResolutionDetail{
+			ResolutionError: of.NewTypeMismatchResolutionError(fmt.Sprintf("%s is %T", flag, v)),
+			Reason:          of.ErrorReason,
+		}
+	}
+	return typed, of.ProviderResolutionDetail{Reason: reason}
+}
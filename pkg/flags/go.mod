@@ -2,10 +2,18 @@ module rxw1/flags
 
 go 1.25.0
 
-require github.com/open-feature/go-sdk v1.15.1
+require (
+	github.com/nats-io/nats.go v1.45.0
+	github.com/open-feature/go-sdk v1.15.1
+)
 
 require (
 	github.com/go-logr/logr v1.4.3 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/nats-io/nkeys v0.4.11 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
 	go.uber.org/mock v0.6.0 // indirect
+	golang.org/x/crypto v0.42.0 // indirect
+	golang.org/x/sys v0.36.0 // indirect
 	golang.org/x/text v0.29.0 // indirect
 )
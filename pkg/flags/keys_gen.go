@@ -0,0 +1,14 @@
+// Code generated by flagsync from infra/flagd/flags.json; DO NOT EDIT.
+
+package flags
+
+const (
+	// Chaos defaults to variant "off".
+	Chaos ObjectKey = "chaos"
+	// RateLimits defaults to variant "default".
+	RateLimits ObjectKey = "rateLimits"
+	// RedisCacheEnabled defaults to variant "on".
+	RedisCacheEnabled Key[bool] = "redisCacheEnabled"
+	// ThrottleEnabled defaults to variant "off".
+	ThrottleEnabled Key[bool] = "throttleEnabled"
+)
@@ -0,0 +1,180 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"rxw1/logging"
+
+	"github.com/nats-io/nats.go"
+)
+
+// OverridesBucket is the NATS KV bucket holding flag overrides. Its history
+// doubles as the audit log of who changed which flag.
+const OverridesBucket = "flags"
+
+// Change is one override of a boolean flag, or its removal when Cleared is
+// set.
+type Change struct {
+	Flag    string    `json:"flag"`
+	Value   bool      `json:"value"`
+	Cleared bool      `json:"cleared,omitempty"`
+	By      string    `json:"by"`
+	At      time.Time `json:"at"`
+}
+
+// Overrides layers boolean flag values written at runtime over flagd. Values
+// live in a NATS KV bucket so every instance sees the same state; each
+// instance keeps a local copy updated by a watcher.
+type Overrides struct {
+	kv nats.KeyValue
+
+	mu      sync.RWMutex
+	values  map[string]Change
+	watches map[chan Change]struct{}
+}
+
+// NewOverrides opens (or creates) the overrides bucket and watches it until
+// ctx is done.
+func NewOverrides(ctx context.Context, nc *nats.Conn) (*Overrides, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	kv, err := js.KeyValue(OverridesBucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      OverridesBucket,
+			Description: "feature flag overrides",
+			History:     64,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := kv.WatchAll(nats.Context(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOverrides()
+	o.kv = kv
+	go o.watch(ctx, w)
+	return o, nil
+}
+
+func newOverrides() *Overrides {
+	return &Overrides{
+		values:  map[string]Change{},
+		watches: map[chan Change]struct{}{},
+	}
+}
+
+// watch applies the bucket's updates until ctx is done. If the watch ends
+// before that, the local copy stops changing, so that is logged.
+func (o *Overrides) watch(ctx context.Context, w nats.KeyWatcher) {
+	defer w.Stop()
+	defer func() {
+		if ctx.Err() == nil {
+			logging.From(ctx).Error("flag override watch ended, overrides are no longer updated")
+		}
+	}()
+	for e := range w.Updates() {
+		if e == nil { // initial values replayed
+			continue
+		}
+		if e.Operation() != nats.KeyValuePut {
+			o.remove(e.Key())
+			continue
+		}
+		var c Change
+		if err := json.Unmarshal(e.Value(), &c); err != nil {
+			logging.From(ctx).Error("invalid flag override", "flag", e.Key(), "error", err)
+			continue
+		}
+		o.apply(c)
+	}
+}
+
+func (o *Overrides) apply(c Change) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if c.Cleared {
+		delete(o.values, c.Flag)
+	} else {
+		o.values[c.Flag] = c
+	}
+	for ch := range o.watches {
+		select {
+		case ch <- c:
+		default: // slow watcher, drop
+		}
+	}
+}
+
+func (o *Overrides) remove(flag string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.values, flag)
+}
+
+// Bool returns the override for flag, if any.
+func (o *Overrides) Bool(flag string) (value, ok bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	c, ok := o.values[flag]
+	return c.Value, ok
+}
+
+// Set overrides flag for all instances and records who changed it.
+func (o *Overrides) Set(ctx context.Context, flag string, value bool, by string) (Change, error) {
+	c := Change{Flag: flag, Value: value, By: by, At: time.Now().UTC()}
+	if err := o.put(c); err != nil {
+		return Change{}, err
+	}
+	logging.From(ctx).Info("flag changed", "flag", flag, "value", value, "by", by, "at", c.At)
+	return c, nil
+}
+
+// Clear removes the override of flag for all instances, so flagd decides
+// its value again, and records who cleared it.
+func (o *Overrides) Clear(ctx context.Context, flag string, by string) (Change, error) {
+	c := Change{Flag: flag, Cleared: true, By: by, At: time.Now().UTC()}
+	if err := o.put(c); err != nil {
+		return Change{}, err
+	}
+	logging.From(ctx).Info("flag override cleared", "flag", flag, "by", by, "at", c.At)
+	return c, nil
+}
+
+// put writes c rather than deleting the key on Clear, so the bucket history
+// keeps who made every change.
+func (o *Overrides) put(c Change) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = o.kv.Put(c.Flag, b)
+	return err
+}
+
+// Watch streams changes until ctx is done.
+func (o *Overrides) Watch(ctx context.Context) <-chan Change {
+	ch := make(chan Change, 8)
+	o.mu.Lock()
+	o.watches[ch] = struct{}{}
+	o.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		o.mu.Lock()
+		delete(o.watches, ch)
+		o.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
@@ -0,0 +1,96 @@
+package flags
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"rxw1/logging"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestOverrides_ApplyAndWatch(t *testing.T) {
+	o := newOverrides()
+	if _, ok := o.Bool("throttleEnabled"); ok {
+		t.Fatal("unexpected override before apply")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := o.Watch(ctx)
+
+	want := Change{Flag: "throttleEnabled", Value: true, By: "u1", At: time.Now()}
+	o.apply(want)
+
+	if v, ok := o.Bool("throttleEnabled"); !ok || !v {
+		t.Fatalf("Bool() = %v, %v, want true, true", v, ok)
+	}
+	select {
+	case got := <-ch:
+		if got.Flag != want.Flag || got.By != want.By || !got.Value {
+			t.Errorf("Watch() got %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no change delivered")
+	}
+
+	o.apply(Change{Flag: "throttleEnabled", Cleared: true, By: "u2", At: time.Now()})
+	if _, ok := o.Bool("throttleEnabled"); ok {
+		t.Fatal("override still present after clear")
+	}
+	select {
+	case got := <-ch:
+		if !got.Cleared || got.By != "u2" {
+			t.Errorf("Watch() got %+v, want the clear by u2", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("clear not delivered")
+	}
+
+	o.apply(want)
+	<-ch
+	o.remove("throttleEnabled")
+	if _, ok := o.Bool("throttleEnabled"); ok {
+		t.Fatal("override still present after remove")
+	}
+
+	cancel()
+	select {
+	case _, open := <-ch:
+		if open {
+			t.Fatal("unexpected change after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch channel not closed after cancel")
+	}
+}
+
+// watcher is a nats.KeyWatcher whose updates the test sends.
+type watcher struct {
+	nats.KeyWatcher
+	updates chan nats.KeyValueEntry
+}
+
+func (w watcher) Updates() <-chan nats.KeyValueEntry { return w.updates }
+func (w watcher) Stop() error                        { return nil }
+
+func TestOverrides_WatchEnded(t *testing.T) {
+	for _, canceled := range []bool{false, true} {
+		var buf bytes.Buffer
+		ctx, cancel := context.WithCancel(logging.Into(context.Background(), slog.New(slog.NewTextHandler(&buf, nil))))
+		if canceled {
+			cancel()
+		}
+		w := watcher{updates: make(chan nats.KeyValueEntry)}
+		close(w.updates)
+		newOverrides().watch(ctx, w)
+		cancel()
+
+		if logged := strings.Contains(buf.String(), "flag override watch ended"); logged == canceled {
+			t.Errorf("canceled %v: logged %v, want %v:\n%s", canceled, logged, !canceled, buf.String())
+		}
+	}
+}
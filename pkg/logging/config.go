@@ -12,4 +12,7 @@ type Config struct {
 	Environment string
 	SetDefault  bool
 	TimeFormat  string
+
+	// Sampling, when set, wraps the handler in a SamplingHandler.
+	Sampling *SamplingOptions
 }
@@ -40,6 +40,9 @@ func New(cfg Config) (*slog.Logger, error) {
 	} else {
 		handler = slog.NewTextHandler(w, hopts)
 	}
+	if cfg.Sampling != nil {
+		handler = NewSamplingHandler(handler, *cfg.Sampling)
+	}
 
 	base := slog.New(handler)
 	// if cfg.Service != "" || cfg.Version != "" || cfg.Environment != "" {
@@ -36,7 +36,10 @@ func NewTint(cfg Config) (*slog.Logger, error) {
 		},
 	}
 
-	handler := tint.NewHandler(w, hopts)
+	var handler slog.Handler = tint.NewHandler(w, hopts)
+	if cfg.Sampling != nil {
+		handler = NewSamplingHandler(handler, *cfg.Sampling)
+	}
 	base := slog.New(handler)
 
 	// if cfg.Service != "" || cfg.Version != "" || cfg.Environment != "" {
@@ -0,0 +1,224 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SamplingOptions configures a SamplingHandler.
+//
+// Records are grouped by message. Within each Interval the first Initial
+// records of a group are passed through, after that only every
+// Thereafter-th one. Dropped records are counted per message and reported
+// at most once per ReportInterval: with the next record handled once it is
+// due, or by a timer if none comes. The same timer prunes the counters of
+// messages whose Interval has ended, whether or not any were dropped.
+type SamplingOptions struct {
+	Initial    int
+	Thereafter int
+	Interval   time.Duration
+
+	// Records at or above this level are never sampled. Nil samples all
+	// levels.
+	Exempt slog.Leveler
+
+	// ReportInterval defaults to Interval when zero.
+	ReportInterval time.Duration
+}
+
+// DefaultSampling logs the first 100 records per message and second, then
+// every 100th. Warnings and errors are never dropped.
+func DefaultSampling() *SamplingOptions {
+	return &SamplingOptions{
+		Initial:    100,
+		Thereafter: 100,
+		Interval:   time.Second,
+		Exempt:     slog.LevelWarn,
+	}
+}
+
+// SamplingHandler wraps a slog.Handler and drops repetitive records on hot
+// paths.
+type SamplingHandler struct {
+	next  slog.Handler
+	opts  SamplingOptions
+	state *samplingState
+}
+
+// samplingState is shared between a handler and all handlers derived from it
+// via WithAttrs/WithGroup, so that sampling is per message and not per child
+// logger.
+type samplingState struct {
+	mu         sync.Mutex
+	root       slog.Handler
+	now        func() time.Time
+	after      func(time.Duration, func()) // time.AfterFunc
+	counters   map[string]*sampleCounter
+	dropped    map[string]uint64
+	lastReport time.Time
+	scheduled  bool // a timer will report the drops and prune counters
+}
+
+type sampleCounter struct {
+	start time.Time
+	n     int
+}
+
+// NewSamplingHandler returns a handler that samples records before passing
+// them on to next.
+func NewSamplingHandler(next slog.Handler, opts SamplingOptions) *SamplingHandler {
+	if opts.ReportInterval <= 0 {
+		opts.ReportInterval = opts.Interval
+	}
+	return &SamplingHandler{
+		next: next,
+		opts: opts,
+		state: &samplingState{
+			root:     next,
+			now:      time.Now,
+			after:    func(d time.Duration, f func()) { time.AfterFunc(d, f) },
+			counters: make(map[string]*sampleCounter),
+			dropped:  make(map[string]uint64),
+		},
+	}
+}
+
+func (h *SamplingHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l)
+}
+
+func (h *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	exempt := h.opts.Exempt != nil && r.Level >= h.opts.Exempt.Level()
+	keep, report := h.state.sample(r.Message, h.opts, exempt)
+	for _, rec := range report {
+		_ = h.state.root.Handle(ctx, rec)
+	}
+	if !keep {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{next: h.next.WithAttrs(attrs), opts: h.opts, state: h.state}
+}
+
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{next: h.next.WithGroup(name), opts: h.opts, state: h.state}
+}
+
+// sample decides whether a record with message msg is kept and returns the
+// drop reports that are due. Exempt records are always kept.
+func (s *samplingState) sample(msg string, opts SamplingOptions, exempt bool) (bool, []slog.Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.lastReport.IsZero() {
+		s.lastReport = now
+	}
+
+	keep := true
+	if !exempt {
+		c, ok := s.counters[msg]
+		if !ok || now.Sub(c.start) >= opts.Interval {
+			c = &sampleCounter{start: now}
+			s.counters[msg] = c
+		}
+		c.n++
+
+		keep = c.n <= opts.Initial ||
+			(opts.Thereafter > 0 && (c.n-opts.Initial)%opts.Thereafter == 0)
+		if !keep {
+			s.dropped[msg]++
+		}
+	}
+
+	if len(s.dropped) == 0 {
+		if len(s.counters) > 0 {
+			s.schedule(opts.ReportInterval, opts)
+		}
+		return keep, nil
+	}
+	if wait := opts.ReportInterval - now.Sub(s.lastReport); wait > 0 {
+		s.schedule(wait, opts)
+		return keep, nil
+	}
+	return keep, s.report(now, opts)
+}
+
+// schedule starts a timer that reports the drops or prunes counters after
+// wait, unless one is running.
+func (s *samplingState) schedule(wait time.Duration, opts SamplingOptions) {
+	if s.scheduled {
+		return
+	}
+	s.scheduled = true
+	s.after(wait, func() { s.flush(opts) })
+}
+
+// flush reports the drops from the timer, or schedules it again if a record
+// reported them in the meantime and new ones are not due yet. With nothing
+// dropped it only prunes counters, and keeps ticking while any are left.
+func (s *samplingState) flush(opts SamplingOptions) {
+	s.mu.Lock()
+	s.scheduled = false
+	now := s.now()
+	var report []slog.Record
+	if len(s.dropped) > 0 {
+		if wait := opts.ReportInterval - now.Sub(s.lastReport); wait > 0 {
+			s.schedule(wait, opts)
+		} else {
+			report = s.report(now, opts)
+		}
+	} else {
+		s.prune(now, opts)
+	}
+	if len(s.counters) > 0 {
+		s.schedule(opts.ReportInterval, opts)
+	}
+	s.mu.Unlock()
+
+	for _, rec := range report {
+		_ = s.root.Handle(context.Background(), rec)
+	}
+}
+
+// report turns the drop counters into log records and resets them. Counters
+// of messages whose interval has ended are pruned with them.
+func (s *samplingState) report(now time.Time, opts SamplingOptions) []slog.Record {
+	msgs := make([]string, 0, len(s.dropped))
+	for m := range s.dropped {
+		msgs = append(msgs, m)
+	}
+	sort.Strings(msgs)
+
+	recs := make([]slog.Record, 0, len(msgs))
+	for _, m := range msgs {
+		r := slog.NewRecord(now, slog.LevelInfo, "log records dropped by sampling", 0)
+		r.AddAttrs(
+			slog.String("sampled_msg", m),
+			slog.Uint64("dropped", s.dropped[m]),
+			slog.Duration("period", now.Sub(s.lastReport)),
+		)
+		recs = append(recs, r)
+	}
+
+	s.dropped = make(map[string]uint64)
+	s.prune(now, opts)
+	s.lastReport = now
+	return recs
+}
+
+// prune drops the counters of messages whose interval has ended; the next
+// record with that message starts a new one anyway.
+func (s *samplingState) prune(now time.Time, opts SamplingOptions) {
+	for m, c := range s.counters {
+		if now.Sub(c.start) >= opts.Interval {
+			delete(s.counters, m)
+		}
+	}
+}
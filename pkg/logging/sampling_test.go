@@ -0,0 +1,228 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSampler(buf *bytes.Buffer, opts SamplingOptions) (*slog.Logger, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := NewSamplingHandler(slog.NewTextHandler(buf, nil), opts)
+	h.state.now = func() time.Time { return now }
+	h.state.after = func(time.Duration, func()) {} // reports only on Handle
+	return slog.New(h), &now
+}
+
+func TestSamplingHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		initial    int
+		thereafter int
+		logs       int
+		want       int
+	}{
+		{"below initial", 5, 0, 3, 3},
+		{"initial only", 2, 0, 10, 2},
+		{"initial then every third", 2, 3, 11, 5}, // 1,2,5,8,11
+		{"every record", 0, 1, 4, 4},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l, _ := newTestSampler(&buf, SamplingOptions{
+				Initial:    c.initial,
+				Thereafter: c.thereafter,
+				Interval:   time.Second,
+			})
+			for range c.logs {
+				l.Info("event")
+			}
+			if got := strings.Count(buf.String(), " msg=event"); got != c.want {
+				t.Fatalf("logged %d records; want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSamplingHandler_PerMessage(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := newTestSampler(&buf, SamplingOptions{Initial: 1, Interval: time.Second})
+
+	l.Info("a")
+	l.Info("a")
+	l.With("k", "v").Info("b")
+
+	out := buf.String()
+	if strings.Count(out, " msg=a") != 1 || strings.Count(out, " msg=b") != 1 {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
+
+func TestSamplingHandler_IntervalReset(t *testing.T) {
+	var buf bytes.Buffer
+	l, now := newTestSampler(&buf, SamplingOptions{Initial: 1, Interval: time.Second})
+
+	l.Info("event")
+	l.Info("event")
+	*now = now.Add(time.Second)
+	l.Info("event")
+
+	if got := strings.Count(buf.String(), " msg=event"); got != 2 {
+		t.Fatalf("logged %d records; want 2", got)
+	}
+}
+
+func TestSamplingHandler_Exempt(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := newTestSampler(&buf, SamplingOptions{
+		Initial:  1,
+		Interval: time.Second,
+		Exempt:   slog.LevelWarn,
+	})
+
+	for range 3 {
+		l.Warn("event")
+		l.Error("event")
+		l.Info("event")
+	}
+
+	out := buf.String()
+	if got := strings.Count(out, "level=WARN msg=event"); got != 3 {
+		t.Fatalf("logged %d warnings; want 3", got)
+	}
+	if got := strings.Count(out, "level=ERROR msg=event"); got != 3 {
+		t.Fatalf("logged %d errors; want 3", got)
+	}
+	if got := strings.Count(out, "level=INFO msg=event"); got != 1 {
+		t.Fatalf("logged %d infos; want 1", got)
+	}
+}
+
+func TestSamplingHandler_ReportsDrops(t *testing.T) {
+	var buf bytes.Buffer
+	l, now := newTestSampler(&buf, SamplingOptions{
+		Initial:        1,
+		Interval:       time.Minute,
+		ReportInterval: time.Second,
+	})
+
+	for range 4 {
+		l.Info("event")
+	}
+	if strings.Contains(buf.String(), "dropped") {
+		t.Fatalf("reported drops too early:\n%s", buf.String())
+	}
+
+	*now = now.Add(time.Second)
+	l.Info("event")
+
+	out := buf.String()
+	if !strings.Contains(out, "sampled_msg=event dropped=4") {
+		t.Fatalf("missing drop report:\n%s", out)
+	}
+
+	buf.Reset()
+	*now = now.Add(time.Second)
+	l.Info("other")
+	if strings.Contains(buf.String(), "dropped") {
+		t.Fatalf("drop counters were not reset:\n%s", buf.String())
+	}
+}
+
+func TestSamplingHandler_ReportsDropsWhenQuiet(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := NewSamplingHandler(slog.NewTextHandler(&buf, nil), SamplingOptions{
+		Initial:        1,
+		Interval:       time.Second,
+		ReportInterval: time.Minute,
+		Exempt:         slog.LevelWarn,
+	})
+	h.state.now = func() time.Time { return now }
+	var timers []func()
+	h.state.after = func(d time.Duration, f func()) {
+		if d != time.Minute {
+			t.Errorf("timer set for %v, want 1m", d)
+		}
+		timers = append(timers, f)
+	}
+	l := slog.New(h)
+
+	for range 3 {
+		l.Info("event")
+	}
+	if len(timers) != 1 {
+		t.Fatalf("started %d timers, want 1", len(timers))
+	}
+
+	// Nothing else is logged; the timer reports the drops.
+	now = now.Add(time.Minute)
+	timers[0]()
+	if out := buf.String(); !strings.Contains(out, "sampled_msg=event dropped=2") {
+		t.Fatalf("missing drop report:\n%s", out)
+	}
+	if len(h.state.counters) != 0 || len(h.state.dropped) != 0 {
+		t.Errorf("counters %v, dropped %v after the report, want none", h.state.counters, h.state.dropped)
+	}
+
+	// A record reported the drops first; the timer finds nothing to do.
+	buf.Reset()
+	l.Info("event")
+	l.Info("event")
+	now = now.Add(time.Minute)
+	l.Warn("other")
+	if !strings.Contains(buf.String(), "sampled_msg=event dropped=1") {
+		t.Fatalf("exempt record did not report drops:\n%s", buf.String())
+	}
+	buf.Reset()
+	timers[1]()
+	if buf.Len() != 0 {
+		t.Errorf("timer reported again:\n%s", buf.String())
+	}
+}
+
+func TestSamplingHandler_PrunesWithoutDrops(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := NewSamplingHandler(slog.NewTextHandler(&buf, nil), SamplingOptions{
+		Initial:  100,
+		Interval: time.Second,
+	})
+	h.state.now = func() time.Time { return now }
+	var timers []func()
+	h.state.after = func(_ time.Duration, f func()) { timers = append(timers, f) }
+	l := slog.New(h)
+
+	l.Info("a")
+	now = now.Add(500 * time.Millisecond)
+	l.Info("b")
+	if len(timers) != 1 {
+		t.Fatalf("started %d timers, want 1", len(timers))
+	}
+
+	// a's interval has ended, b's has not; the timer runs again for b.
+	now = now.Add(500 * time.Millisecond)
+	timers[0]()
+	if _, ok := h.state.counters["a"]; ok || len(h.state.counters) != 1 {
+		t.Fatalf("counters %v, want only b", h.state.counters)
+	}
+	if len(timers) != 2 {
+		t.Fatalf("started %d timers, want 2", len(timers))
+	}
+
+	now = now.Add(time.Second)
+	timers[1]()
+	if len(h.state.counters) != 0 {
+		t.Errorf("counters %v, want none", h.state.counters)
+	}
+	if len(timers) != 2 {
+		t.Errorf("started %d timers with no counters left, want 2", len(timers))
+	}
+	if strings.Contains(buf.String(), "dropped") {
+		t.Errorf("reported drops that did not happen:\n%s", buf.String())
+	}
+}
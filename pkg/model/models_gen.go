@@ -2,16 +2,66 @@
 
 package model
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// An override of a boolean feature flag, as recorded in the audit log.
+type FlagChange struct {
+	Flag      string    `json:"flag"`
+	Enabled   bool      `json:"enabled"`
+	Cleared   bool      `json:"cleared"`
+	ChangedBy string    `json:"changedBy"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
 type Mutation struct {
 }
 
 type Order struct {
-	ID        string `json:"id"`
+	ID        string       `json:"id"`
+	Qty       int32        `json:"qty"`
+	ProductID string       `json:"productId"`
+	EventID   string       `json:"eventId"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Price     *int32       `json:"price,omitempty"`
+	UserID    string       `json:"userId"`
+	Status    OrderStatus  `json:"status"`
+	Items     []*OrderItem `json:"items"`
+	Total     *int32       `json:"total,omitempty"`
+}
+
+// One change to an order, as appended to ordersvc's order_events.
+type OrderEvent struct {
+	Seq     int32          `json:"seq"`
+	Type    OrderEventType `json:"type"`
+	EventID string         `json:"eventId"`
+	At      time.Time      `json:"at"`
+	Reason  *string        `json:"reason,omitempty"`
+}
+
+type OrderInput struct {
+	Items          []*OrderItemInput `json:"items"`
+	IdempotencyKey *string           `json:"idempotencyKey,omitempty"`
+}
+
+// A product in an order, at the name and unit price it had when the order
+// was placed.
+type OrderItem struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	Price     *int32 `json:"price,omitempty"`
 	Qty       int32  `json:"qty"`
+	Subtotal  *int32 `json:"subtotal,omitempty"`
+}
+
+type OrderItemInput struct {
 	ProductID string `json:"productId"`
-	EventID   string `json:"eventId"`
-	CreatedAt string `json:"createdAt"`
-	Price     int32  `json:"price"`
+	Qty       int32  `json:"qty"`
 }
 
 type Product struct {
@@ -27,11 +77,184 @@ type Subscription struct {
 }
 
 type Time struct {
-	UnixTime  int32  `json:"unixTime"`
-	TimeStamp string `json:"timeStamp"`
+	UnixTime  int32     `json:"unixTime"`
+	TimeStamp time.Time `json:"timeStamp"`
 }
 
 type User struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
 }
+
+type OrderEventType string
+
+const (
+	OrderEventTypeCreated   OrderEventType = "CREATED"
+	OrderEventTypeConfirmed OrderEventType = "CONFIRMED"
+	OrderEventTypeRejected  OrderEventType = "REJECTED"
+	OrderEventTypeCanceled  OrderEventType = "CANCELED"
+)
+
+var AllOrderEventType = []OrderEventType{
+	OrderEventTypeCreated,
+	OrderEventTypeConfirmed,
+	OrderEventTypeRejected,
+	OrderEventTypeCanceled,
+}
+
+func (e OrderEventType) IsValid() bool {
+	switch e {
+	case OrderEventTypeCreated, OrderEventTypeConfirmed, OrderEventTypeRejected, OrderEventTypeCanceled:
+		return true
+	}
+	return false
+}
+
+func (e OrderEventType) String() string {
+	return string(e)
+}
+
+func (e *OrderEventType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderEventType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderEventType", str)
+	}
+	return nil
+}
+
+func (e OrderEventType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *OrderEventType) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e OrderEventType) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type OrderStatus string
+
+const (
+	OrderStatusCreated   OrderStatus = "CREATED"
+	OrderStatusConfirmed OrderStatus = "CONFIRMED"
+	OrderStatusRejected  OrderStatus = "REJECTED"
+	OrderStatusCanceled  OrderStatus = "CANCELED"
+)
+
+var AllOrderStatus = []OrderStatus{
+	OrderStatusCreated,
+	OrderStatusConfirmed,
+	OrderStatusRejected,
+	OrderStatusCanceled,
+}
+
+func (e OrderStatus) IsValid() bool {
+	switch e {
+	case OrderStatusCreated, OrderStatusConfirmed, OrderStatusRejected, OrderStatusCanceled:
+		return true
+	}
+	return false
+}
+
+func (e OrderStatus) String() string {
+	return string(e)
+}
+
+func (e *OrderStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderStatus", str)
+	}
+	return nil
+}
+
+func (e OrderStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *OrderStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e OrderStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type Role string
+
+const (
+	RoleAdmin Role = "ADMIN"
+	RoleUser  Role = "USER"
+)
+
+var AllRole = []Role{
+	RoleAdmin,
+	RoleUser,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleAdmin, RoleUser:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *Role) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e Role) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
@@ -9,6 +9,14 @@ const config: CodegenConfig = {
   generates: {
     './src/app/__generated__/': {
       preset: 'client',
+      config: {
+        // Custom gateway scalars, typed as what they are on the wire.
+        scalars: {
+          DateTime: 'string',
+          ULID: 'string',
+          Money: '{ amount: number; currency: string }',
+        },
+      },
     },
   },
 }
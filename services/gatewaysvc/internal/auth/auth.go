@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// User is the authenticated caller as derived from the token claims.
+type User struct {
+	ID    string
+	Name  string
+	Roles []string
+}
+
+// HasRole reports whether u carries role. Roles compare case-insensitively.
+func (u *User) HasRole(role string) bool {
+	return slices.ContainsFunc(u.Roles, func(r string) bool {
+		return strings.EqualFold(r, role)
+	})
+}
+
+type ctxKey struct{}
+
+// WithUser attaches u to ctx.
+func WithUser(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, ctxKey{}, u)
+}
+
+// UserFrom returns the authenticated user from ctx, if any.
+func UserFrom(ctx context.Context) (*User, bool) {
+	u, ok := ctx.Value(ctxKey{}).(*User)
+	return u, ok && u != nil
+}
+
+// MustUser returns the authenticated user or ErrUnauthenticated.
+func MustUser(ctx context.Context) (*User, error) {
+	u, ok := UserFrom(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return u, nil
+}
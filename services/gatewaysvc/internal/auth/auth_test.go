@@ -0,0 +1,67 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rxw1/gatewaysvc/internal/auth"
+)
+
+func TestUser_HasRole(t *testing.T) {
+	u := &auth.User{ID: "u1", Roles: []string{"admin", "USER"}}
+
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{"ADMIN", true},
+		{"user", true},
+		{"AUDITOR", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := u.HasRole(tt.role); got != tt.want {
+			t.Errorf("HasRole(%q) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestMustUser(t *testing.T) {
+	if _, err := auth.MustUser(context.Background()); !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("MustUser() error = %v, want ErrUnauthenticated", err)
+	}
+
+	ctx := auth.WithUser(context.Background(), &auth.User{ID: "u1"})
+	if u, err := auth.MustUser(ctx); err != nil || u.ID != "u1" {
+		t.Fatalf("MustUser() = %v, %v", u, err)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name string
+		user *auth.User
+		want int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"missing role", &auth.User{ID: "u1", Roles: []string{"USER"}}, http.StatusForbidden},
+		{"admin", &auth.User{ID: "u1", Roles: []string{"ADMIN"}}, http.StatusOK},
+	}
+	h := auth.RequireRole("ADMIN")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/debug/cache", nil)
+			if tt.user != nil {
+				r = r.WithContext(auth.WithUser(r.Context(), tt.user))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rxw1/gatewaysvc/internal/auth"
+)
+
+var secret = []byte("test-secret")
+
+func sign(t *testing.T, hdr, claims map[string]any, signer func([]byte) []byte) string {
+	t.Helper()
+	h, _ := json.Marshal(hdr)
+	c, _ := json.Marshal(claims)
+	s := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return s + "." + base64.RawURLEncoding.EncodeToString(signer([]byte(s)))
+}
+
+func hs256(key []byte) func([]byte) []byte {
+	return func(b []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(b)
+		return mac.Sum(nil)
+	}
+}
+
+func rs256(key *rsa.PrivateKey) func([]byte) []byte {
+	return func(b []byte) []byte {
+		sum := sha256.Sum256(b)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		return sig
+	}
+}
+
+func claims(extra map[string]any) map[string]any {
+	c := map[string]any{
+		"sub":   "u1",
+		"name":  "Alice",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"ADMIN"},
+	}
+	for k, v := range extra {
+		c[k] = v
+	}
+	return c
+}
+
+func TestVerifier_HS256(t *testing.T) {
+	v, err := auth.NewVerifier(auth.Config{HMACSecret: secret, Issuer: "demo", Audience: "gateway"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := map[string]any{"alg": "HS256", "typ": "JWT"}
+	good := map[string]any{"iss": "demo", "aud": "gateway"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", sign(t, hdr, claims(good), hs256(secret)), false},
+		{"audience array", sign(t, hdr, claims(map[string]any{"iss": "demo", "aud": []string{"x", "gateway"}}), hs256(secret)), false},
+		{"wrong secret", sign(t, hdr, claims(good), hs256([]byte("nope"))), true},
+		{"expired", sign(t, hdr, claims(map[string]any{"iss": "demo", "aud": "gateway", "exp": time.Now().Add(-time.Hour).Unix()}), hs256(secret)), true},
+		{"not yet valid", sign(t, hdr, claims(map[string]any{"iss": "demo", "aud": "gateway", "nbf": time.Now().Add(time.Hour).Unix()}), hs256(secret)), true},
+		{"wrong issuer", sign(t, hdr, claims(map[string]any{"iss": "other", "aud": "gateway"}), hs256(secret)), true},
+		{"wrong audience", sign(t, hdr, claims(map[string]any{"iss": "demo", "aud": "other"}), hs256(secret)), true},
+		{"alg none", sign(t, map[string]any{"alg": "none"}, claims(good), func([]byte) []byte { return nil }), true},
+		{"RS256 not configured", sign(t, map[string]any{"alg": "RS256"}, claims(good), hs256(secret)), true},
+		{"malformed", "a.b", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := v.Verify(tt.token)
+			if err != nil {
+				if !tt.wantErr {
+					t.Fatalf("Verify() failed: %v", err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("Verify() succeeded unexpectedly")
+			}
+			if u := c.User(); u.ID != "u1" || u.Name != "Alice" || len(u.Roles) != 1 {
+				t.Errorf("User() = %+v", u)
+			}
+		})
+	}
+}
+
+func TestVerifier_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, _ := json.Marshal(map[string]any{
+		"keys": []map[string]any{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := auth.NewVerifier(auth.Config{JWKSFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Verify(sign(t, map[string]any{"alg": "RS256", "kid": "k1"}, claims(nil), rs256(key))); err != nil {
+		t.Errorf("valid token: %v", err)
+	}
+	if _, err := v.Verify(sign(t, map[string]any{"alg": "RS256"}, claims(nil), rs256(key))); err != nil {
+		t.Errorf("single key without kid: %v", err)
+	}
+	if _, err := v.Verify(sign(t, map[string]any{"alg": "RS256", "kid": "k1"}, claims(nil), rs256(other))); err == nil {
+		t.Error("token signed with other key verified")
+	}
+	if _, err := v.Verify(sign(t, map[string]any{"alg": "RS256", "kid": "k2"}, claims(nil), rs256(key))); err == nil {
+		t.Error("token with unknown kid verified")
+	}
+	if _, err := v.Verify(sign(t, map[string]any{"alg": "HS256"}, claims(nil), hs256(nil))); err == nil {
+		t.Error("HS256 token verified without secret")
+	}
+}
+
+func TestVerifier_Authenticate(t *testing.T) {
+	v, _ := auth.NewVerifier(auth.Config{HMACSecret: secret})
+	token := sign(t, map[string]any{"alg": "HS256"}, claims(nil), hs256(secret))
+
+	ctx, err := v.Authenticate(context.Background(), "")
+	if err != nil {
+		t.Fatalf("anonymous: %v", err)
+	}
+	if _, ok := auth.UserFrom(ctx); ok {
+		t.Fatal("anonymous context has a user")
+	}
+
+	ctx, err = v.Authenticate(context.Background(), "Bearer "+token)
+	if err != nil {
+		t.Fatalf("bearer: %v", err)
+	}
+	if u, ok := auth.UserFrom(ctx); !ok || u.ID != "u1" {
+		t.Fatalf("UserFrom() = %v, %v", u, ok)
+	}
+
+	if _, err := v.Authenticate(context.Background(), "Basic Zm9vOmJhcg=="); err == nil {
+		t.Fatal("non-bearer header accepted")
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"rxw1/logging"
+)
+
+// Authenticate verifies the bearer token in an Authorization header value and
+// returns a context carrying the user. An empty header yields an anonymous
+// context and no error.
+func (v *Verifier) Authenticate(ctx context.Context, header string) (context.Context, error) {
+	if header == "" {
+		return ctx, nil
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		token, ok = strings.CutPrefix(header, "bearer ")
+	}
+	if !ok || token == "" {
+		return ctx, ErrInvalidToken
+	}
+
+	c, err := v.Verify(strings.TrimSpace(token))
+	if err != nil {
+		return ctx, err
+	}
+
+	ctx = WithUser(ctx, c.User())
+	return logging.With(ctx, "userID", c.Subject), nil
+}
+
+// Middleware authenticates HTTP requests. Requests without an Authorization
+// header pass through anonymously; requests with an invalid token are
+// rejected with 401.
+func Middleware(v *Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := v.Authenticate(r.Context(), r.Header.Get("Authorization"))
+			if err != nil {
+				logging.From(ctx).Warn("rejected token", "error", err)
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "invalid token", "UNAUTHENTICATED")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireRole rejects requests whose user, set by Middleware, lacks role.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, err := MustUser(r.Context())
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, err.Error(), "UNAUTHENTICATED")
+				return
+			}
+			if !u.HasRole(role) {
+				writeError(w, http.StatusForbidden, ErrForbidden.Error(), "FORBIDDEN")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeError responds in the GraphQL error shape so clients handle HTTP and
+// resolver errors alike.
+func writeError(w http.ResponseWriter, status int, msg, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]any{{
+			"message":    msg,
+			"extensions": map[string]any{"code": code},
+		}},
+	})
+}
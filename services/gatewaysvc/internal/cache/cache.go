@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrMiss is returned by Get for keys that do not exist or have expired.
+var ErrMiss = errors.New("cache: miss")
+
+// Cache is a string key/value store with per-key expiry. A ttl of 0 means
+// no expiration; every implementation expires keys the same way.
+type Cache interface {
+	// Get returns ErrMiss if k does not exist.
+	Get(ctx context.Context, k string) (string, error)
+	Set(ctx context.Context, k, v string, ttl time.Duration) error
+	// SetNX sets k only if it does not exist and reports whether it did.
+	SetNX(ctx context.Context, k, v string, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, k string) error
+}
+
+type Backend string
+
+const (
+	BackendRedis  Backend = "redis"
+	BackendNATS   Backend = "nats"
+	BackendMemory Backend = "memory"
+)
+
+type Config struct {
+	Backend Backend // default redis
+
+	Redis RedisConfig // redis
+
+	NC     *nats.Conn    // nats, needs JetStream
+	Bucket string        // nats, default "cache"
+	MaxAge time.Duration // nats, entries are dropped this long after they are written; 0 for never
+
+	Size int // memory, max entries, default 10000
+}
+
+// New returns the cache selected by cfg.Backend.
+func New(cfg Config) (Cache, error) {
+	switch cfg.Backend {
+	case "", BackendRedis:
+		return NewRedis(cfg.Redis)
+	case BackendNATS:
+		if cfg.NC == nil {
+			return nil, errors.New("cache: nats backend needs a connection")
+		}
+		bucket := cfg.Bucket
+		if bucket == "" {
+			bucket = "cache"
+		}
+		return NewKV(cfg.NC, bucket, cfg.MaxAge)
+	case BackendMemory:
+		size := cfg.Size
+		if size <= 0 {
+			size = 10000
+		}
+		return NewLRU(size), nil
+	default:
+		return nil, fmt.Errorf("cache: unknown backend %q", cfg.Backend)
+	}
+}
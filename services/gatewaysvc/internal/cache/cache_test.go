@@ -0,0 +1,332 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"rxw1/gatewaysvc/internal/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+// backend builds a fresh cache and moves its clock forward by d.
+type backend struct {
+	name    string
+	new     func(t *testing.T) cache.Cache
+	advance func(d time.Duration)
+}
+
+// ttl is short so the wall-clock backends expire quickly.
+const ttl = 100 * time.Millisecond
+
+func backends(t *testing.T) []backend {
+	mr := miniredis.RunT(t)
+	return []backend{
+		{
+			name: "memory",
+			new: func(t *testing.T) cache.Cache {
+				return cache.NewLRU(100)
+			},
+			advance: time.Sleep,
+		},
+		{
+			name: "redis",
+			new: func(t *testing.T) cache.Cache {
+				mr.FlushAll()
+				return newRedis(t, mr.Addr())
+			},
+			advance: mr.FastForward,
+		},
+		{
+			name: "nats",
+			new: func(t *testing.T) cache.Cache {
+				nc := runNATS(t)
+				c, err := cache.NewKV(nc, "cache", time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return c
+			},
+			advance: time.Sleep,
+		},
+	}
+}
+
+func newRedis(t *testing.T, addr string) *cache.Redis {
+	t.Helper()
+	c, err := cache.NewRedis(cache.RedisConfig{Addrs: []string{addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func runNATS(t *testing.T) *nats.Conn {
+	t.Helper()
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	s := natsserver.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+func TestConformance(t *testing.T) {
+	ctx := context.Background()
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			t.Run("miss", func(t *testing.T) {
+				c := b.new(t)
+				if _, err := c.Get(ctx, "product:1"); !errors.Is(err, cache.ErrMiss) {
+					t.Errorf("Get() error = %v, want ErrMiss", err)
+				}
+			})
+
+			t.Run("set get del", func(t *testing.T) {
+				c := b.new(t)
+				if err := c.Set(ctx, "product:1", `{"id":"1"}`, 0); err != nil {
+					t.Fatal(err)
+				}
+				if got, err := c.Get(ctx, "product:1"); err != nil || got != `{"id":"1"}` {
+					t.Errorf("Get() = %q, %v", got, err)
+				}
+				if err := c.Set(ctx, "product:1", "v2", 0); err != nil {
+					t.Fatal(err)
+				}
+				if got, _ := c.Get(ctx, "product:1"); got != "v2" {
+					t.Errorf("Get() after overwrite = %q, want v2", got)
+				}
+				if err := c.Del(ctx, "product:1"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := c.Get(ctx, "product:1"); !errors.Is(err, cache.ErrMiss) {
+					t.Errorf("Get() after Del error = %v, want ErrMiss", err)
+				}
+				if err := c.Del(ctx, "product:1"); err != nil {
+					t.Errorf("Del() of missing key = %v", err)
+				}
+			})
+
+			t.Run("ttl", func(t *testing.T) {
+				c := b.new(t)
+				if err := c.Set(ctx, "short", "v", ttl); err != nil {
+					t.Fatal(err)
+				}
+				if err := c.Set(ctx, "forever", "v", 0); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := c.Get(ctx, "short"); err != nil {
+					t.Errorf("Get() before expiry = %v", err)
+				}
+				b.advance(2 * ttl)
+				if _, err := c.Get(ctx, "short"); !errors.Is(err, cache.ErrMiss) {
+					t.Errorf("Get() after expiry error = %v, want ErrMiss", err)
+				}
+				if _, err := c.Get(ctx, "forever"); err != nil {
+					t.Errorf("Get() without ttl = %v", err)
+				}
+			})
+
+			t.Run("setnx", func(t *testing.T) {
+				c := b.new(t)
+				if ok, err := c.SetNX(ctx, "idem:k", "first", ttl); err != nil || !ok {
+					t.Fatalf("SetNX() = %v, %v, want true", ok, err)
+				}
+				if ok, err := c.SetNX(ctx, "idem:k", "second", ttl); err != nil || ok {
+					t.Errorf("SetNX() on existing key = %v, %v, want false", ok, err)
+				}
+				if got, _ := c.Get(ctx, "idem:k"); got != "first" {
+					t.Errorf("Get() = %q, want first", got)
+				}
+
+				b.advance(2 * ttl)
+				if ok, err := c.SetNX(ctx, "idem:k", "third", 0); err != nil || !ok {
+					t.Errorf("SetNX() on expired key = %v, %v, want true", ok, err)
+				}
+				if got, _ := c.Get(ctx, "idem:k"); got != "third" {
+					t.Errorf("Get() = %q, want third", got)
+				}
+			})
+
+			t.Run("setnx race", func(t *testing.T) {
+				c := b.new(t)
+				var wg sync.WaitGroup
+				wins := make(chan string, 8)
+				for i := range 8 {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if ok, err := c.SetNX(ctx, "race", fmt.Sprint(i), 0); err == nil && ok {
+							wins <- fmt.Sprint(i)
+						}
+					}()
+				}
+				wg.Wait()
+				close(wins)
+				if n := len(wins); n != 1 {
+					t.Errorf("%d SetNX calls won, want 1", n)
+				}
+			})
+		})
+	}
+}
+
+func TestLRU_Evicts(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU(2)
+	_ = c.Set(ctx, "a", "1", 0)
+	_ = c.Set(ctx, "b", "2", 0)
+	_, _ = c.Get(ctx, "a") // b is now least recently used
+	_ = c.Set(ctx, "c", "3", 0)
+
+	if _, err := c.Get(ctx, "b"); !errors.Is(err, cache.ErrMiss) {
+		t.Errorf("Get(b) error = %v, want evicted", err)
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, err := c.Get(ctx, k); err != nil {
+			t.Errorf("Get(%s) = %v", k, err)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+}
+
+func TestKV_MaxAge(t *testing.T) {
+	nc := runNATS(t)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A bucket created without a max age gets one when it is opened.
+	if _, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "cache", History: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, maxAge := range []time.Duration{time.Hour, 2 * time.Hour} {
+		if _, err := cache.NewKV(nc, "cache", maxAge); err != nil {
+			t.Fatal(err)
+		}
+		info, err := js.StreamInfo("KV_cache")
+		if err != nil || info.Config.MaxAge != maxAge {
+			t.Errorf("after NewKV(%v) bucket max age = %+v, %v", maxAge, info, err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := cache.New(cache.Config{Backend: "memcached"}); err == nil {
+		t.Error("New() with unknown backend succeeded")
+	}
+	if _, err := cache.New(cache.Config{Backend: cache.BackendNATS}); err == nil {
+		t.Error("New() for nats without a connection succeeded")
+	}
+	c, err := cache.New(cache.Config{Backend: cache.BackendMemory})
+	if _, ok := c.(*cache.LRU); err != nil || !ok {
+		t.Errorf("New(memory) = %T, %v", c, err)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	var failures int
+	c := cache.Fallback{
+		Primary:   newRedis(t, mr.Addr()),
+		Secondary: cache.NewLRU(10),
+		OnError:   func(context.Context, error) { failures++ },
+	}
+
+	if err := c.Set(ctx, "k", "redis", 0); err != nil {
+		t.Fatal(err)
+	}
+	mr.Close()
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, cache.ErrMiss) {
+		t.Errorf("Get() during outage error = %v, want ErrMiss from secondary", err)
+	}
+	if ok, err := c.SetNX(ctx, "k", "memory", 0); err != nil || !ok {
+		t.Errorf("SetNX() during outage = %v, %v", ok, err)
+	}
+	if v, err := c.Get(ctx, "k"); err != nil || v != "memory" {
+		t.Errorf("Get() during outage = %q, %v, want memory", v, err)
+	}
+	if failures != 3 {
+		t.Errorf("OnError called %d times, want 3", failures)
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	// go-redis backs off dialing for a second after repeated failures.
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		v, _ := c.Get(ctx, "k")
+		if v == "redis" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Get() after recovery = %q, want redis", v)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// down is a Cache that always fails and counts the calls it gets.
+type down struct{ calls int }
+
+var errDown = errors.New("connection refused")
+
+func (d *down) Get(context.Context, string) (string, error) { d.calls++; return "", errDown }
+func (d *down) Set(context.Context, string, string, time.Duration) error {
+	d.calls++
+	return errDown
+}
+func (d *down) SetNX(context.Context, string, string, time.Duration) (bool, error) {
+	d.calls++
+	return false, errDown
+}
+func (d *down) Del(context.Context, string) error { d.calls++; return errDown }
+
+func TestFallback_Breaker(t *testing.T) {
+	ctx := context.Background()
+	primary := &down{}
+	b := &cache.Breaker{Cooldown: 50 * time.Millisecond}
+	c := cache.Fallback{Primary: primary, Secondary: cache.NewLRU(10), Breaker: b}
+
+	if err := c.Set(ctx, "k", "memory", 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get(ctx, "k"); err != nil || v != "memory" {
+		t.Errorf("Get() = %q, %v, want memory", v, err)
+	}
+	if ok, err := c.SetNX(ctx, "k", "other", 0); err != nil || ok {
+		t.Errorf("SetNX() = %v, %v, want false from secondary", ok, err)
+	}
+	if err := c.Del(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if primary.calls != 1 || !b.Open() {
+		t.Errorf("primary called %d times, breaker open %v, want 1 and true", primary.calls, b.Open())
+	}
+
+	time.Sleep(b.Cooldown)
+	if b.Open() {
+		t.Fatal("breaker still open after its cooldown")
+	}
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, cache.ErrMiss) || primary.calls != 2 {
+		t.Errorf("Get() after cooldown = %v with %d primary calls, want ErrMiss after retrying primary", err, primary.calls)
+	}
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Breaker remembers that a backend failed, so callers skip it for Cooldown
+// instead of waiting for its timeout on every call. A nil Breaker never
+// opens.
+type Breaker struct {
+	Cooldown time.Duration
+	until    atomic.Int64 // unix nanoseconds
+}
+
+// Open reports whether the backend failed less than Cooldown ago.
+func (b *Breaker) Open() bool {
+	return b != nil && time.Now().UnixNano() < b.until.Load()
+}
+
+// Trip records a failure of the backend.
+func (b *Breaker) Trip() {
+	if b != nil {
+		b.until.Store(time.Now().Add(b.Cooldown).UnixNano())
+	}
+}
+
+// Fallback serves from Secondary while Primary fails, e.g. an in-process LRU
+// while Redis is down. After a failure it skips Primary until Breaker closes
+// again; values written during the outage stay in Secondary only.
+type Fallback struct {
+	Primary, Secondary Cache
+	Breaker            *Breaker
+	OnError            func(ctx context.Context, err error)
+}
+
+func (f Fallback) Get(ctx context.Context, k string) (string, error) {
+	if f.Breaker.Open() {
+		return f.Secondary.Get(ctx, k)
+	}
+	v, err := f.Primary.Get(ctx, k)
+	if err == nil || errors.Is(err, ErrMiss) {
+		return v, err
+	}
+	f.failed(ctx, err)
+	return f.Secondary.Get(ctx, k)
+}
+
+func (f Fallback) Set(ctx context.Context, k, v string, ttl time.Duration) error {
+	if f.Breaker.Open() {
+		return f.Secondary.Set(ctx, k, v, ttl)
+	}
+	if err := f.Primary.Set(ctx, k, v, ttl); err != nil {
+		f.failed(ctx, err)
+		return f.Secondary.Set(ctx, k, v, ttl)
+	}
+	return nil
+}
+
+func (f Fallback) SetNX(ctx context.Context, k, v string, ttl time.Duration) (bool, error) {
+	if f.Breaker.Open() {
+		return f.Secondary.SetNX(ctx, k, v, ttl)
+	}
+	ok, err := f.Primary.SetNX(ctx, k, v, ttl)
+	if err != nil {
+		f.failed(ctx, err)
+		return f.Secondary.SetNX(ctx, k, v, ttl)
+	}
+	return ok, nil
+}
+
+func (f Fallback) Del(ctx context.Context, k string) error {
+	if f.Breaker.Open() {
+		return f.Secondary.Del(ctx, k)
+	}
+	if err := f.Primary.Del(ctx, k); err != nil {
+		f.failed(ctx, err)
+		return f.Secondary.Del(ctx, k)
+	}
+	return nil
+}
+
+func (f Fallback) failed(ctx context.Context, err error) {
+	f.Breaker.Trip()
+	if f.OnError != nil {
+		f.OnError(ctx, err)
+	}
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"rxw1/logging"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNotFound is returned by a load func for values that do not exist. The
+// Loader caches it for MissTTL and returns it from Get.
+var ErrNotFound = errors.New("cache: not found")
+
+// Loader reads through a Cache. Concurrent misses for a key share one load,
+// stale values are served while a single background load refreshes them,
+// and not-found results are cached briefly.
+type Loader struct {
+	Cache   Cache
+	TTL     time.Duration // values are fresh for TTL
+	Stale   time.Duration // then served stale for up to Stale more
+	MissTTL time.Duration // not-found results are cached this long, 0 for never
+	Jitter  float64       // TTLs are shortened by up to this fraction to spread expiry
+
+	group singleflight.Group
+}
+
+// entry is what the Loader keeps in the cache.
+type entry struct {
+	Value   string `json:"v,omitempty"`
+	Missing bool   `json:"m,omitempty"`
+	Fresh   int64  `json:"f"` // Unix milliseconds
+}
+
+// Get returns the value for key, calling load if it is missing or stale.
+func (l *Loader) Get(ctx context.Context, key string, load func(context.Context) (string, error)) (string, error) {
+	s, err := l.Cache.Get(ctx, key)
+	if err != nil && !errors.Is(err, ErrMiss) {
+		logging.From(ctx).Warn("cache get failed, loading", "key", key, "error", err)
+	}
+	// Values the Loader did not write, which have no Fresh time, are
+	// loaded again and replaced.
+	var e entry
+	if err == nil && json.Unmarshal([]byte(s), &e) == nil && e.Fresh != 0 {
+		if time.Now().UnixMilli() >= e.Fresh {
+			l.refresh(ctx, key, load)
+		}
+		if e.Missing {
+			return "", ErrNotFound
+		}
+		return e.Value, nil
+	}
+
+	// Waiters share the load, so it must not die with the first caller.
+	v, err, _ := l.group.Do(key, func() (any, error) {
+		return l.load(context.WithoutCancel(ctx), key, load)
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// refresh reloads key in the background unless a load is already running.
+func (l *Loader) refresh(ctx context.Context, key string, load func(context.Context) (string, error)) {
+	ctx = context.WithoutCancel(ctx)
+	l.group.DoChan(key, func() (any, error) {
+		v, err := l.load(ctx, key, load)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			logging.From(ctx).Warn("cache refresh failed", "key", key, "error", err)
+		}
+		return v, err
+	})
+}
+
+func (l *Loader) load(ctx context.Context, key string, load func(context.Context) (string, error)) (string, error) {
+	v, err := load(ctx)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if l.MissTTL > 0 {
+			ttl := l.jitter(l.MissTTL)
+			l.store(ctx, key, entry{Missing: true, Fresh: time.Now().Add(ttl).UnixMilli()}, ttl)
+		}
+		return "", err
+	case err != nil:
+		return "", err
+	}
+
+	ttl := l.jitter(l.TTL)
+	l.store(ctx, key, entry{Value: v, Fresh: time.Now().Add(ttl).UnixMilli()}, ttl+l.Stale)
+	return v, nil
+}
+
+func (l *Loader) store(ctx context.Context, key string, e entry, ttl time.Duration) {
+	b, _ := json.Marshal(e)
+	if err := l.Cache.Set(ctx, key, string(b), ttl); err != nil {
+		logging.From(ctx).Warn("cache set failed", "key", key, "error", err)
+	}
+}
+
+func (l *Loader) jitter(d time.Duration) time.Duration {
+	if l.Jitter <= 0 {
+		return d
+	}
+	return d - time.Duration(rand.Float64()*l.Jitter*float64(d))
+}
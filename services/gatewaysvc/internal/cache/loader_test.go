@@ -0,0 +1,134 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rxw1/gatewaysvc/internal/cache"
+)
+
+func TestLoader_CoalescesMisses(t *testing.T) {
+	ctx := context.Background()
+	l := &cache.Loader{Cache: cache.NewLRU(10), TTL: time.Minute}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "v", nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := l.Get(ctx, "product:1", load); err != nil || v != "v" {
+				t.Errorf("Get() = %q, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond) // let the callers pile up
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("load called %d times, want 1", n)
+	}
+	if _, err := l.Get(ctx, "product:1", load); err != nil || calls.Load() != 1 {
+		t.Errorf("Get() after load = %v, calls %d, want cached", err, calls.Load())
+	}
+}
+
+func TestLoader_StaleWhileRevalidate(t *testing.T) {
+	ctx := context.Background()
+	l := &cache.Loader{Cache: cache.NewLRU(10), TTL: 20 * time.Millisecond, Stale: time.Minute}
+
+	var calls atomic.Int32
+	refreshed := make(chan struct{}, 1)
+	load := func(context.Context) (string, error) {
+		if calls.Add(1) == 1 {
+			return "old", nil
+		}
+		defer func() { refreshed <- struct{}{} }()
+		return "new", nil
+	}
+
+	if v, _ := l.Get(ctx, "k", load); v != "old" {
+		t.Fatalf("Get() = %q, want old", v)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if v, _ := l.Get(ctx, "k", load); v != "old" {
+		t.Errorf("stale Get() = %q, want old served while refreshing", v)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("no background refresh")
+	}
+	// The refresh stores after returning; give it a moment.
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := l.Get(ctx, "k", load); v != "new" {
+		t.Errorf("Get() after refresh = %q, want new", v)
+	}
+}
+
+func TestLoader_NegativeCaching(t *testing.T) {
+	ctx := context.Background()
+	l := &cache.Loader{Cache: cache.NewLRU(10), TTL: time.Minute, MissTTL: 30 * time.Millisecond}
+
+	var calls atomic.Int32
+	load := func(context.Context) (string, error) {
+		calls.Add(1)
+		return "", cache.ErrNotFound
+	}
+
+	for range 3 {
+		if _, err := l.Get(ctx, "product:missing", load); !errors.Is(err, cache.ErrNotFound) {
+			t.Fatalf("Get() error = %v, want ErrNotFound", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("load called %d times, want 1", n)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	_, _ = l.Get(ctx, "product:missing", load)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("load called %d times after MissTTL, want 2", n)
+	}
+}
+
+func TestLoader_ErrorsAreNotCached(t *testing.T) {
+	ctx := context.Background()
+	l := &cache.Loader{Cache: cache.NewLRU(10), TTL: time.Minute, MissTTL: time.Minute}
+
+	boom := errors.New("boom")
+	if _, err := l.Get(ctx, "k", func(context.Context) (string, error) { return "", boom }); !errors.Is(err, boom) {
+		t.Fatalf("Get() error = %v, want boom", err)
+	}
+	if v, err := l.Get(ctx, "k", func(context.Context) (string, error) { return "v", nil }); err != nil || v != "v" {
+		t.Errorf("Get() after failure = %q, %v", v, err)
+	}
+}
+
+func TestLoader_ReplacesForeignValues(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU(10)
+	l := &cache.Loader{Cache: c, TTL: time.Minute}
+
+	// A product cached as plain JSON, before the Loader wrapped values.
+	if err := c.Set(ctx, "product:1", `{"id":"1","name":"Widget","price":100}`, 0); err != nil {
+		t.Fatal(err)
+	}
+	v, err := l.Get(ctx, "product:1", func(context.Context) (string, error) { return "v", nil })
+	if err != nil || v != "v" {
+		t.Errorf("Get() = %q, %v, want the loaded value", v, err)
+	}
+}
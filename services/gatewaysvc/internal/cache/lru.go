@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LRU is an in-process cache holding at most size entries, evicting the
+// least recently used one when full.
+type LRU struct {
+	size int
+	now  func() time.Time
+
+	mu    sync.Mutex
+	ll    *list.List // front is most recently used
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	value    string
+	deadline time.Time // zero for none
+}
+
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:  size,
+		now:   time.Now,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (c *LRU) Get(ctx context.Context, k string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el := c.live(k)
+	if el == nil {
+		return "", ErrMiss
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry).value, nil
+}
+
+func (c *LRU) Set(ctx context.Context, k, v string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(k, v, ttl)
+	return nil
+}
+
+func (c *LRU) SetNX(ctx context.Context, k, v string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.live(k) != nil {
+		return false, nil
+	}
+	c.set(k, v, ttl)
+	return true, nil
+}
+
+func (c *LRU) Del(ctx context.Context, k string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[k]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Entry is a snapshot of one LRU entry.
+type Entry struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+// Entries returns the live entries whose key starts with prefix, most
+// recently used first.
+func (c *LRU) Entries(prefix string) []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	var out []Entry
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*lruEntry)
+		if !strings.HasPrefix(e.key, prefix) || (!e.deadline.IsZero() && !now.Before(e.deadline)) {
+			continue
+		}
+		out = append(out, Entry{Key: e.key, Value: e.value, ExpiresAt: e.deadline})
+	}
+	return out
+}
+
+// live returns the element for k, dropping it if it has expired.
+func (c *LRU) live(k string) *list.Element {
+	el, ok := c.items[k]
+	if !ok {
+		return nil
+	}
+	if d := el.Value.(*lruEntry).deadline; !d.IsZero() && !c.now().Before(d) {
+		c.remove(el)
+		return nil
+	}
+	return el
+}
+
+func (c *LRU) set(k, v string, ttl time.Duration) {
+	var deadline time.Time
+	if ttl > 0 {
+		deadline = c.now().Add(ttl)
+	}
+	if el, ok := c.items[k]; ok {
+		e := el.Value.(*lruEntry)
+		e.value, e.deadline = v, deadline
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[k] = c.ll.PushFront(&lruEntry{key: k, value: v, deadline: deadline})
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *LRU) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry).key)
+}
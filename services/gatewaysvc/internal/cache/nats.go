@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// KV is a cache in a NATS JetStream key/value bucket. JetStream only expires
+// entries by age, so each value carries its own deadline and expired entries
+// read as misses and are deleted lazily. Entries that are never read again
+// are dropped by the bucket's max age.
+type KV struct {
+	kv  nats.KeyValue
+	now func() time.Time
+}
+
+// NewKV opens bucket, creating it if needed, and sets its max age: entries
+// are dropped maxAge after they were written, whatever their TTL. maxAge must
+// be at least the longest TTL the cache is used with; 0 keeps entries until
+// they are read after expiring.
+func NewKV(nc *nats.Conn, bucket string, maxAge time.Duration) (*KV, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	kv, err := js.KeyValue(bucket)
+	switch {
+	case errors.Is(err, nats.ErrBucketNotFound):
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "gateway cache",
+			History:     1,
+			TTL:         maxAge,
+		})
+	case err == nil:
+		err = setMaxAge(js, "KV_"+bucket, maxAge)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &KV{kv: kv, now: time.Now}, nil
+}
+
+// setMaxAge updates the max age of the stream behind an existing bucket.
+func setMaxAge(js nats.JetStreamContext, stream string, maxAge time.Duration) error {
+	info, err := js.StreamInfo(stream)
+	if err != nil {
+		return err
+	}
+	if info.Config.MaxAge == maxAge {
+		return nil
+	}
+	cfg := info.Config
+	cfg.MaxAge = maxAge
+	_, err = js.UpdateStream(&cfg)
+	return err
+}
+
+func (c *KV) Get(ctx context.Context, k string) (string, error) {
+	e, err := c.get(k)
+	if err != nil {
+		return "", err
+	}
+	v, _ := c.decode(e.Value())
+	return v, nil
+}
+
+func (c *KV) Set(ctx context.Context, k, v string, ttl time.Duration) error {
+	_, err := c.kv.Put(kvKey(k), c.encode(v, ttl))
+	return err
+}
+
+func (c *KV) SetNX(ctx context.Context, k, v string, ttl time.Duration) (bool, error) {
+	_, err := c.kv.Create(kvKey(k), c.encode(v, ttl))
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, nats.ErrKeyExists) {
+		return false, err
+	}
+
+	// The key exists but may have expired; take it over unless someone else
+	// wrote it since we looked.
+	e, err := c.kv.Get(kvKey(k))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return c.SetNX(ctx, k, v, ttl)
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, live := c.decode(e.Value()); live {
+		return false, nil
+	}
+	_, err = c.kv.Update(kvKey(k), c.encode(v, ttl), e.Revision())
+	if errors.Is(err, nats.ErrKeyExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *KV) Del(ctx context.Context, k string) error {
+	return c.kv.Delete(kvKey(k))
+}
+
+func (c *KV) get(k string) (nats.KeyValueEntry, error) {
+	e, err := c.kv.Get(kvKey(k))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, ErrMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, live := c.decode(e.Value()); !live {
+		// Only delete the revision we saw, not a newer write.
+		_ = c.kv.Delete(kvKey(k), nats.LastRevision(e.Revision()))
+		return nil, ErrMiss
+	}
+	return e, nil
+}
+
+// encode prefixes v with its deadline in Unix nanoseconds, 0 for none.
+func (c *KV) encode(v string, ttl time.Duration) []byte {
+	b := make([]byte, 8, 8+len(v))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(b, uint64(c.now().Add(ttl).UnixNano()))
+	}
+	return append(b, v...)
+}
+
+// decode returns the value and whether it is still live.
+func (c *KV) decode(b []byte) (string, bool) {
+	if len(b) < 8 {
+		return "", false
+	}
+	deadline := int64(binary.BigEndian.Uint64(b))
+	return string(b[8:]), deadline == 0 || c.now().UnixNano() < deadline
+}
+
+// kvKey maps any cache key onto the characters NATS allows in KV keys.
+func kvKey(k string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(k))
+}
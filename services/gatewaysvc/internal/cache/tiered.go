@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"time"
+
+	"rxw1/logging"
+
+	"github.com/nats-io/nats.go"
+	ulid "github.com/oklog/ulid/v2"
+)
+
+// InvalidateSubject carries keys that replicas must drop from their L1.
+const InvalidateSubject = "cache.invalidate"
+
+// originHeader marks invalidations so a replica skips its own.
+const originHeader = "Cache-Origin"
+
+// Hits counts lookups by the tier that answered them: "l1", "l2" or "miss".
+// It is published on /debug/vars.
+var Hits = expvar.NewMap("cache_hits")
+
+// Tiered keeps recently read keys in an in-process LRU (L1) in front of a
+// shared cache (L2). Writes go to L2 and are broadcast over NATS so other
+// replicas drop the key from their L1. An update racing a read on another
+// replica can leave that replica stale for at most L1TTL.
+type Tiered struct {
+	L1    *LRU
+	L2    Cache
+	L1TTL time.Duration
+
+	nc     *nats.Conn
+	sub    *nats.Subscription
+	origin string
+}
+
+// NewTiered puts an LRU of size entries, each kept for at most l1TTL, in
+// front of l2 and listens for invalidations from other replicas.
+func NewTiered(nc *nats.Conn, l2 Cache, size int, l1TTL time.Duration) (*Tiered, error) {
+	t := &Tiered{
+		L1:     NewLRU(size),
+		L2:     l2,
+		L1TTL:  l1TTL,
+		nc:     nc,
+		origin: ulid.Make().String(),
+	}
+	sub, err := nc.Subscribe(InvalidateSubject, func(m *nats.Msg) {
+		if m.Header.Get(originHeader) == t.origin {
+			return
+		}
+		_ = t.L1.Del(context.Background(), string(m.Data))
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.sub = sub
+	return t, nil
+}
+
+// Close stops listening for invalidations.
+func (t *Tiered) Close() error {
+	return t.sub.Unsubscribe()
+}
+
+func (t *Tiered) Get(ctx context.Context, k string) (string, error) {
+	if v, err := t.L1.Get(ctx, k); err == nil {
+		Hits.Add("l1", 1)
+		return v, nil
+	}
+	v, err := t.L2.Get(ctx, k)
+	if err != nil {
+		Hits.Add("miss", 1)
+		return "", err
+	}
+	Hits.Add("l2", 1)
+	_ = t.L1.Set(ctx, k, v, t.L1TTL)
+	return v, nil
+}
+
+func (t *Tiered) Set(ctx context.Context, k, v string, ttl time.Duration) error {
+	if err := t.L2.Set(ctx, k, v, ttl); err != nil {
+		return err
+	}
+	_ = t.L1.Set(ctx, k, v, t.l1TTL(ttl))
+	t.invalidate(ctx, k)
+	return nil
+}
+
+func (t *Tiered) SetNX(ctx context.Context, k, v string, ttl time.Duration) (bool, error) {
+	ok, err := t.L2.SetNX(ctx, k, v, ttl)
+	if err != nil || !ok {
+		return ok, err
+	}
+	_ = t.L1.Set(ctx, k, v, t.l1TTL(ttl))
+	t.invalidate(ctx, k)
+	return true, nil
+}
+
+func (t *Tiered) Del(ctx context.Context, k string) error {
+	_ = t.L1.Del(ctx, k)
+	if err := t.L2.Del(ctx, k); err != nil {
+		return err
+	}
+	t.invalidate(ctx, k)
+	return nil
+}
+
+// ServeHTTP lists the L1 entries as JSON, filtered by the prefix query
+// parameter, along with the hit counters.
+func (t *Tiered) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	entries := t.L1.Entries(r.URL.Query().Get("prefix"))
+	if entries == nil {
+		entries = []Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"size":    t.L1.Len(),
+		"hits":    json.RawMessage(Hits.String()),
+		"entries": entries,
+	})
+}
+
+// l1TTL caps ttl at L1TTL; 0 (no expiry) becomes L1TTL.
+func (t *Tiered) l1TTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > t.L1TTL {
+		return t.L1TTL
+	}
+	return ttl
+}
+
+func (t *Tiered) invalidate(ctx context.Context, k string) {
+	m := nats.NewMsg(InvalidateSubject)
+	m.Header.Set(originHeader, t.origin)
+	m.Data = []byte(k)
+	if err := t.nc.PublishMsg(m); err != nil {
+		logging.From(ctx).Warn("cache invalidation not sent", "key", k, "error", err)
+	}
+}
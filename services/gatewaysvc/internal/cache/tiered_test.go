@@ -0,0 +1,109 @@
+package cache_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"rxw1/gatewaysvc/internal/cache"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	nc := runNATS(t)
+	l2 := newRedis(t, miniredis.RunT(t).Addr())
+
+	a, err := cache.NewTiered(nc, l2, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := cache.NewTiered(nc, l2, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	hits := func(tier string) int64 {
+		v := cache.Hits.Get(tier)
+		if v == nil {
+			return 0
+		}
+		n, _ := strconv.ParseInt(v.String(), 10, 64)
+		return n
+	}
+	l1, l2hits := hits("l1"), hits("l2")
+
+	if err := a.Set(ctx, "product:1", "v1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := b.Get(ctx, "product:1"); v != "v1" {
+		t.Fatalf("b.Get() = %q, want v1 from L2", v)
+	}
+	if v, _ := b.Get(ctx, "product:1"); v != "v1" {
+		t.Fatalf("b.Get() = %q, want v1 from L1", v)
+	}
+	if got := hits("l2") - l2hits; got != 1 {
+		t.Errorf("l2 hits = %d, want 1", got)
+	}
+	if got := hits("l1") - l1; got != 1 {
+		t.Errorf("l1 hits = %d, want 1", got)
+	}
+
+	// A write on a must evict the key from b's L1.
+	if err := a.Set(ctx, "product:1", "v2", 0); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, _ := b.Get(ctx, "product:1"); v == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("b still serves v1 after invalidation")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// a keeps its own write.
+	if v, err := a.L1.Get(ctx, "product:1"); err != nil || v != "v2" {
+		t.Errorf("a.L1.Get() = %q, %v, want v2", v, err)
+	}
+
+	if err := a.Del(ctx, "product:1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Get(ctx, "product:1"); err == nil {
+		t.Error("a.Get() after Del succeeded")
+	}
+}
+
+func TestTiered_ServeHTTP(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewTiered(runNATS(t), cache.NewLRU(10), 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_ = c.Set(ctx, "product:1", "p1", 0)
+	_ = c.Set(ctx, "idem:x", "i", 0)
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/debug/cache?prefix=product:", nil))
+
+	var body struct {
+		Size    int
+		Entries []cache.Entry
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Size != 2 || len(body.Entries) != 1 || body.Entries[0].Key != "product:1" {
+		t.Errorf("body = %+v", body)
+	}
+}
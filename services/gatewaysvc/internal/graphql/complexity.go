@@ -0,0 +1,35 @@
+package graphql
+
+import "rxw1/model"
+
+// Field costs for the complexity limit. Scalars keep gqlgen's default of 1;
+// every field that issues a NATS request costs requestCost on top, and lists
+// without pagination are assumed to hold listSize items.
+const (
+	requestCost = 10
+	listSize    = 20
+)
+
+// Complexity returns the per-field costs used by limits.ComplexityLimit.
+func Complexity() ComplexityRoot {
+	var c ComplexityRoot
+
+	one := func(childComplexity int) int { return requestCost + childComplexity }
+	list := func(childComplexity int) int { return requestCost + listSize*childComplexity }
+
+	c.Query.Orders = list
+	c.Query.OrdersByUserID = func(childComplexity int, _ string) int { return list(childComplexity) }
+	c.Query.OrderByID = func(childComplexity int, _ string) int { return one(childComplexity) }
+	c.Query.Products = list
+	c.Query.ProductByID = func(childComplexity int, _ string) int { return one(childComplexity) }
+	c.Query.Users = list
+	c.Query.UserByID = func(childComplexity int, _ string) int { return one(childComplexity) }
+
+	c.Order.History = list
+
+	c.Mutation.PlaceOrder = func(childComplexity int, _ model.OrderInput) int { return one(childComplexity) }
+	c.Mutation.CreateOrder = func(childComplexity int, _ string, _ int32, _ *string) int { return one(childComplexity) }
+	c.Mutation.CancelOrder = func(childComplexity int, _ string, _ *string) int { return one(childComplexity) }
+
+	return c
+}
@@ -0,0 +1,39 @@
+package graphql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/vektah/gqlparser/v2"
+)
+
+func TestComplexity(t *testing.T) {
+	es := NewExecutableSchema(Config{Resolvers: &Resolver{}, Complexity: Complexity()})
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"scalar", `{ isCacheEnabled }`, 1},
+		{"list", `{ orders { id } }`, requestCost + listSize},
+		{"list of lists", `{ orders { id history { seq } } }`, requestCost + listSize*(1+requestCost+listSize)},
+		{"one", `{ productById(productId: "01JQ0000000000000000000001") { id name } }`, requestCost + 2},
+		{"siblings add up", `{ products { id } users { id } }`, 2 * (requestCost + listSize)},
+		{"placeOrder", `mutation { placeOrder(input: {items: [{productId: "01JQ0000000000000000000001", qty: 1}]}) { id } }`, requestCost + 1},
+		{"createOrder", `mutation { createOrder(productId: "01JQ0000000000000000000001", qty: 1) { id } }`, requestCost + 1},
+		{"cancelOrder", `mutation { cancelOrder(orderId: "01JQ0000000000000000000002") { id } }`, requestCost + 1},
+		{"flag mutation", `mutation { enableCache }`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := gqlparser.LoadQuery(es.Schema(), tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := complexity.Calculate(context.Background(), es, doc.Operations[0], nil); got != tt.want {
+				t.Errorf("complexity = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
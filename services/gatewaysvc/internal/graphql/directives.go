@@ -0,0 +1,25 @@
+package graphql
+
+import (
+	"context"
+
+	"rxw1/gatewaysvc/internal/auth"
+	"rxw1/logging"
+	"rxw1/model"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// HasRole implements the @hasRole directive. Anonymous callers get
+// ErrUnauthenticated, authenticated callers without the role ErrForbidden.
+func HasRole(ctx context.Context, obj any, next graphql.Resolver, role model.Role) (any, error) {
+	user, err := auth.MustUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !user.HasRole(role.String()) {
+		logging.From(ctx).Warn("missing role", "role", role, "field", graphql.GetFieldContext(ctx).Field.Name)
+		return nil, auth.ErrForbidden
+	}
+	return next(ctx)
+}
@@ -0,0 +1,53 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"rxw1/gatewaysvc/internal/auth"
+	"rxw1/model"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *auth.User
+		wantErr error
+	}{
+		{name: "admin", user: &auth.User{ID: "u1", Roles: []string{"USER", "ADMIN"}}},
+		{name: "role in lower case", user: &auth.User{ID: "u1", Roles: []string{"admin"}}},
+		{name: "other role", user: &auth.User{ID: "u1", Roles: []string{"USER"}}, wantErr: auth.ErrForbidden},
+		{name: "no roles", user: &auth.User{ID: "u1"}, wantErr: auth.ErrForbidden},
+		{name: "anonymous", wantErr: auth.ErrUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := graphql.WithFieldContext(context.Background(), &graphql.FieldContext{
+				Field: graphql.CollectedField{Field: &ast.Field{Name: "enableCache"}},
+			})
+			if tt.user != nil {
+				ctx = auth.WithUser(ctx, tt.user)
+			}
+			called := false
+			next := func(context.Context) (any, error) {
+				called = true
+				return true, nil
+			}
+
+			res, err := HasRole(ctx, nil, next, model.RoleAdmin)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("HasRole() error = %v, want %v", err, tt.wantErr)
+			}
+			if called != (tt.wantErr == nil) {
+				t.Errorf("next called = %v, want %v", called, tt.wantErr == nil)
+			}
+			if tt.wantErr == nil && res != true {
+				t.Errorf("HasRole() = %v, want the result of next", res)
+			}
+		})
+	}
+}
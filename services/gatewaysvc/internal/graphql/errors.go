@@ -0,0 +1,139 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"runtime/debug"
+
+	"rxw1/gatewaysvc/internal/auth"
+	"rxw1/gatewaysvc/internal/idempotency"
+	"rxw1/gatewaysvc/internal/scalar"
+	"rxw1/logging"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/nats-io/nats.go"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// ErrorPresenter sets extensions.code on every resolver error:
+//
+//   - UNAUTHENTICATED for a missing login, FORBIDDEN for a missing
+//     permission and CONFLICT for idempotency key conflicts
+//   - the FieldError's code (BAD_USER_INPUT, NOT_FOUND or CONFLICT), with
+//     its path in extensions.field
+//   - BAD_USER_INPUT for a value a custom scalar rejected, with the path of
+//     the argument in extensions.field
+//   - UPSTREAM_TIMEOUT when a service did not answer a NATS request
+//   - INTERNAL for anything else. Its message is replaced, so storage and
+//     transport details never reach clients; the error is logged instead.
+//
+// Errors that already are a *gqlerror.Error, from gqlgen or an extension,
+// keep their message and code. gqlgen also wraps resolver errors in one with
+// the field's path; those are mapped by what they wrap.
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+
+	var fe *FieldError
+	var se *scalar.Error
+	var code string
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated), errors.Is(err, auth.ErrInvalidToken):
+		code = "UNAUTHENTICATED"
+	case errors.Is(err, auth.ErrForbidden):
+		code = "FORBIDDEN"
+	case errors.Is(err, idempotency.ErrInProgress), errors.Is(err, idempotency.ErrKeyReused):
+		code = CodeConflict
+	case errors.As(err, &fe):
+		code = fe.Code
+		setExtension(gqlErr, "field", fe.Path)
+	case errors.As(err, &se):
+		code = CodeBadUserInput
+		field := argumentPath(ctx, gqlErr)
+		setExtension(gqlErr, "field", field)
+		gqlErr.Message = (&FieldError{Path: field, Message: se.Message}).Error()
+	case upstreamTimeout(err):
+		code = CodeUpstreamTimeout
+		gqlErr.Message = "upstream service did not respond"
+	case ownError(err):
+		return gqlErr
+	default:
+		logging.From(ctx).Error("internal error", "path", gqlErr.Path.String(), "error", err)
+		code = CodeInternal
+		gqlErr.Message = "internal error"
+	}
+
+	setExtension(gqlErr, "code", code)
+	return gqlErr
+}
+
+// ownError reports whether err is a *gqlerror.Error of its own rather than a
+// resolver error gqlgen wrapped.
+func ownError(err error) bool {
+	var ge *gqlerror.Error
+	return errors.As(err, &ge) && ge.Unwrap() == nil
+}
+
+func setExtension(gqlErr *gqlerror.Error, key string, value any) {
+	if gqlErr.Extensions == nil {
+		gqlErr.Extensions = map[string]any{}
+	}
+	gqlErr.Extensions[key] = value
+}
+
+// argumentPath splits the path of an argument error, which gqlgen appends
+// to the field's own path, off gqlErr.Path and returns it.
+func argumentPath(ctx context.Context, gqlErr *gqlerror.Error) []any {
+	path := gqlErr.Path
+	if fc := graphql.GetFieldContext(ctx); fc != nil {
+		if n := len(fc.Path()); n <= len(path) {
+			path, gqlErr.Path = path[n:], path[:n]
+		}
+	}
+	field := make([]any, len(path))
+	for i, p := range path {
+		switch p := p.(type) {
+		case ast.PathName:
+			field[i] = string(p)
+		case ast.PathIndex:
+			field[i] = int(p)
+		}
+	}
+	return field
+}
+
+// upstreamTimeout reports whether err is a NATS request that timed out or
+// that no service was subscribed to answer.
+func upstreamTimeout(err error) bool {
+	return errors.Is(err, nats.ErrTimeout) || errors.Is(err, nats.ErrNoResponders) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Panics counts resolver panics by field ("Query.orders"), or "operation"
+// for panics outside a field. It is published on /debug/vars.
+var Panics = expvar.NewMap("graphql_panics")
+
+// errPanic is what a resolver that panicked returns. ErrorPresenter turns
+// it into INTERNAL.
+var errPanic = errors.New("resolver panicked")
+
+// Recover is the gqlgen recover func. The panic value is logged with its
+// stack trace and request ID and never returned to the client.
+func Recover(ctx context.Context, p any) error {
+	field, path := "operation", ""
+	if fc := graphql.GetFieldContext(ctx); fc != nil {
+		field = fc.Object + "." + fc.Field.Name
+		path = fc.Path().String()
+	}
+	Panics.Add(field, 1)
+
+	logging.From(ctx).Error("resolver panicked",
+		"panic", p,
+		"field", field,
+		"path", path,
+		"requestID", middleware.GetReqID(ctx),
+		"stack", string(debug.Stack()),
+	)
+	return errPanic
+}
@@ -0,0 +1,165 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"rxw1/gatewaysvc/internal/auth"
+	"rxw1/gatewaysvc/internal/scalar"
+	"rxw1/model"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/nats-io/nats.go"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestErrorPresenter(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  any
+		wantField any
+		wantMsg   string
+	}{
+		{name: "unauthenticated", err: auth.ErrUnauthenticated, wantCode: "UNAUTHENTICATED"},
+		{name: "forbidden", err: fmt.Errorf("cancel: %w", auth.ErrForbidden), wantCode: "FORBIDDEN"},
+		{
+			name:      "field error",
+			err:       &FieldError{Code: CodeBadUserInput, Path: []any{"input", "items", 1, "qty"}, Message: "must be positive"},
+			wantCode:  CodeBadUserInput,
+			wantField: []any{"input", "items", 1, "qty"},
+			wantMsg:   "input.items[1].qty: must be positive",
+		},
+		{
+			name:      "not found",
+			err:       &FieldError{Code: CodeNotFound, Path: []any{"orderId"}, Message: "no such order"},
+			wantCode:  CodeNotFound,
+			wantField: []any{"orderId"},
+			wantMsg:   "orderId: no such order",
+		},
+		{
+			name:      "scalar",
+			err:       gqlerror.WrapPath(ast.Path{ast.PathName("input"), ast.PathName("items"), ast.PathIndex(1), ast.PathName("productId")}, &scalar.Error{Scalar: "ULID", Message: "must be a ULID"}),
+			wantCode:  CodeBadUserInput,
+			wantField: []any{"input", "items", 1, "productId"},
+			wantMsg:   "input.items[1].productId: must be a ULID",
+		},
+		{name: "nats timeout", err: nats.ErrTimeout, wantCode: CodeUpstreamTimeout, wantMsg: "upstream service did not respond"},
+		{name: "no responders", err: fmt.Errorf("orders.get: %w", nats.ErrNoResponders), wantCode: CodeUpstreamTimeout, wantMsg: "upstream service did not respond"},
+		{name: "deadline", err: context.DeadlineExceeded, wantCode: CodeUpstreamTimeout, wantMsg: "upstream service did not respond"},
+		{name: "internal", err: errors.New("mongo: connection refused to 10.0.0.7"), wantCode: CodeInternal, wantMsg: "internal error"},
+		{
+			name:     "internal on a path",
+			err:      gqlerror.WrapPath(ast.Path{ast.PathName("createOrder")}, errors.New("dial tcp 10.0.0.7:6379: connection refused")),
+			wantCode: CodeInternal,
+			wantMsg:  "internal error",
+		},
+		{name: "panic", err: Recover(context.Background(), "nil map"), wantCode: CodeInternal, wantMsg: "internal error"},
+		{name: "gqlerror kept", err: gqlerror.Errorf("must not be null"), wantMsg: "must not be null"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ErrorPresenter(context.Background(), tt.err)
+			if code := got.Extensions["code"]; code != tt.wantCode {
+				t.Errorf("code = %v, want %v", code, tt.wantCode)
+			}
+			if field := got.Extensions["field"]; !reflect.DeepEqual(field, tt.wantField) {
+				t.Errorf("field = %v, want %v", field, tt.wantField)
+			}
+			if tt.wantMsg != "" && got.Message != tt.wantMsg {
+				t.Errorf("message = %q, want %q", got.Message, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	ctx := graphql.WithFieldContext(context.Background(), &graphql.FieldContext{
+		Object: "Query",
+		Field:  graphql.CollectedField{Field: &ast.Field{Name: "orders", Alias: "orders"}},
+	})
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		wantField string
+	}{
+		{name: "field", ctx: ctx, wantField: "Query.orders"},
+		{name: "outside a field", ctx: context.Background(), wantField: "operation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := panics(tt.wantField)
+			if err := Recover(tt.ctx, "nil map"); !errors.Is(err, errPanic) {
+				t.Errorf("Recover() = %v, want %v", err, errPanic)
+			}
+			if got := panics(tt.wantField); got != before+1 {
+				t.Errorf("graphql_panics[%s] = %d, want %d", tt.wantField, got, before+1)
+			}
+		})
+	}
+}
+
+func panics(field string) int64 {
+	if v, ok := Panics.Get(field).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestValidator(t *testing.T) {
+	key := func(s string) *string { return &s }
+	const p1, p2 = "01JQ0000000000000000000001", "01JQ0000000000000000000002"
+	items := func(n int) []*model.OrderItemInput {
+		in := make([]*model.OrderItemInput, n)
+		for i := range in {
+			in[i] = &model.OrderItemInput{ProductID: fmt.Sprintf("01JQ00000000000000000000%02d", i), Qty: 1}
+		}
+		return in
+	}
+
+	tests := []struct {
+		name string
+		in   model.OrderInput
+		want []string // FieldError messages
+	}{
+		{name: "valid", in: model.OrderInput{Items: []*model.OrderItemInput{{ProductID: p1, Qty: 1}, {ProductID: p2, Qty: maxItemQty}}, IdempotencyKey: key("k1")}},
+		{name: "max items", in: model.OrderInput{Items: items(maxOrderItems)}},
+		{name: "no items", in: model.OrderInput{}, want: []string{"input.items: must have 1 to 20 items"}},
+		{name: "too many items", in: model.OrderInput{Items: items(maxOrderItems + 1)}, want: []string{"input.items: must have 1 to 20 items"}},
+		{
+			name: "every bad item",
+			in: model.OrderInput{Items: []*model.OrderItemInput{
+				{ProductID: "p1", Qty: 1},
+				{ProductID: p1, Qty: 0},
+				{ProductID: p1, Qty: maxItemQty + 1},
+			}},
+			want: []string{
+				"input.items[0].productId: must be a ULID",
+				"input.items[1].qty: must be between 1 and 1000",
+				"input.items[2].productId: product is already in the order",
+				"input.items[2].qty: must be between 1 and 1000",
+			},
+		},
+		{name: "long key", in: model.OrderInput{Items: items(1), IdempotencyKey: key(strings.Repeat("k", maxKeyLen+1))}, want: []string{"input.idempotencyKey: must have 1 to 128 characters"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v validator
+			v.orderInput(tt.in)
+			var got []string
+			for _, e := range v.errs {
+				got = append(got, e.Error())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
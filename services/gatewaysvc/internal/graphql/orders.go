@@ -0,0 +1,119 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"rxw1/gatewaysvc/internal/auth"
+	"rxw1/logging"
+	"rxw1/model"
+
+	ulid "github.com/oklog/ulid/v2"
+)
+
+// maxOrderItems bounds OrderInput.items. ordersvc enforces the same limit
+// (db.MaxItems) on the events it stores.
+const maxOrderItems = 20
+
+// orderInput checks the arguments of placeOrder.
+func (v *validator) orderInput(in model.OrderInput) {
+	if len(in.Items) == 0 || len(in.Items) > maxOrderItems {
+		v.add(CodeBadUserInput, fmt.Sprintf("must have 1 to %d items", maxOrderItems), "input", "items")
+	}
+	seen := make(map[string]bool, len(in.Items))
+	for i, it := range in.Items {
+		v.ulid(it.ProductID, "input", "items", i, "productId")
+		if seen[it.ProductID] {
+			v.add(CodeBadUserInput, "product is already in the order", "input", "items", i, "productId")
+		}
+		seen[it.ProductID] = true
+		v.qty(it.Qty, "input", "items", i, "qty")
+	}
+	v.idempotencyKey(in.IdempotencyKey, "input", "idempotencyKey")
+}
+
+// itemPath returns the argument path of field of item i, for errors found
+// while resolving items that passed the validator.
+type itemPath func(i int, field string) []any
+
+// orderItems resolves each product's name and current price, so the event
+// records what the order was placed at. ordersvc checks the items again and
+// computes the totals it stores; the ones returned here are for the
+// mutation's response.
+func (r *Resolver) orderItems(ctx context.Context, in []*model.OrderItemInput, path itemPath) ([]*model.OrderItem, int32, error) {
+	items := make([]*model.OrderItem, len(in))
+	var total int64
+	for i, it := range in {
+		p, err := r.Query().ProductByID(ctx, it.ProductID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if p == nil {
+			return nil, 0, &FieldError{Code: CodeNotFound, Path: path(i, "productId"), Message: "no such product"}
+		}
+
+		subtotal := int64(p.Price) * int64(it.Qty)
+		if total += subtotal; total > math.MaxInt32 {
+			return nil, 0, &FieldError{Code: CodeBadUserInput, Path: path(i, "qty"), Message: "order total is too large"}
+		}
+		price, sub := p.Price, int32(subtotal)
+		items[i] = &model.OrderItem{ProductID: p.ID, Name: p.Name, Price: &price, Qty: it.Qty, Subtotal: &sub}
+	}
+	return items, int32(total), nil
+}
+
+// placeOrder publishes order.created for in, which passed the validator,
+// on behalf of user, once per idempotency key. op and args scope the key as
+// in idempotent.
+func (r *Resolver) placeOrder(ctx context.Context, user *auth.User, op string, in []*model.OrderItemInput, path itemPath, idempotencyKey *string, args any) (*model.Order, error) {
+	return r.idempotent(ctx, user.ID, op, idempotencyKey, args, func(key string) (*model.Order, error) {
+		items, total, err := r.orderItems(ctx, in, path)
+		if err != nil {
+			return nil, err
+		}
+
+		// productID and qty repeat the first item for ordersvc versions
+		// that predate items.
+		event := map[string]any{
+			"id":             ulid.Make().String(),
+			"eventID":        ulid.Make().String(),
+			"productID":      items[0].ProductID,
+			"userID":         user.ID,
+			"qty":            items[0].Qty,
+			"items":          items,
+			"total":          total,
+			"createdAt":      time.Now().UTC().Truncate(time.Second),
+			"idempotencyKey": key,
+		}
+
+		b, err := json.Marshal(event)
+		if err != nil {
+			logging.From(ctx).Error("failed to marshal event", "error", err)
+			return nil, err
+		}
+
+		if err := r.publish(ctx, "order.created", b); err != nil {
+			logging.From(ctx).Error("failed to publish event", "error", err)
+			return nil, err
+		}
+
+		order := &model.Order{
+			ID:        event["id"].(string),
+			Qty:       items[0].Qty,
+			ProductID: items[0].ProductID,
+			Price:     items[0].Price,
+			EventID:   event["eventID"].(string),
+			CreatedAt: event["createdAt"].(time.Time),
+			UserID:    user.ID,
+			Status:    model.OrderStatusCreated,
+			Items:     items,
+			Total:     &total,
+		}
+
+		logging.From(ctx).Info("order created", "order", order)
+		return order, nil
+	})
+}
@@ -1,8 +1,17 @@
 package graphql
 
 import (
+	"context"
+	"errors"
+	"slices"
+
+	"rxw1/chaos"
 	"rxw1/flags"
+	"rxw1/gatewaysvc/internal/auth"
 	"rxw1/gatewaysvc/internal/cache"
+	"rxw1/gatewaysvc/internal/idempotency"
+	"rxw1/gatewaysvc/internal/scalar"
+	"rxw1/model"
 
 	"github.com/nats-io/nats.go"
 )
@@ -12,6 +21,95 @@ import (
 
 type Resolver struct {
 	NC *nats.Conn
-	RC *cache.Cache
+	PC *cache.Loader // product reads
 	FF *flags.Flags
+	IK *idempotency.Store
+	CH *chaos.Injector
+
+	Currency string // ISO 4217 code of all prices, e.g. "USD"
+}
+
+// publish sends an event unless fault injection drops or fails it.
+func (r *Resolver) publish(ctx context.Context, subject string, b []byte) error {
+	if err := r.CH.Inject(ctx, chaos.Publish); err != nil {
+		if errors.Is(err, chaos.ErrDropped) {
+			return nil
+		}
+		return err
+	}
+	return r.NC.Publish(subject, b)
+}
+
+// idempotent runs fn once per idempotency key and user and replays its
+// result on retries. Without a key or store fn runs every time.
+func (r *Resolver) idempotent(ctx context.Context, userID, op string, key *string, args any, fn func(key string) (*model.Order, error)) (*model.Order, error) {
+	k := idempotency.KeyFrom(ctx, key)
+	if k == "" || r.IK == nil {
+		return fn("")
+	}
+
+	var order *model.Order
+	err := r.IK.Do(ctx, idempotency.Scope(userID, op, k), args, &order, func() (err error) {
+		order, err = fn(k)
+		return err
+	})
+	return order, err
+}
+
+// setFlag overrides a boolean flag on behalf of the current user and returns
+// the new value.
+func (r *Resolver) setFlag(ctx context.Context, key flags.Key[bool], value bool) (bool, error) {
+	user, err := auth.MustUser(ctx)
+	if err != nil {
+		return false, err
+	}
+	if _, err := r.FF.Set(ctx, key, value, user.ID); err != nil {
+		return false, err
+	}
+	return value, nil
+}
+
+// overridable are the boolean flags the flag mutations override.
+var overridable = []flags.Key[bool]{flags.RedisCacheEnabled, flags.ThrottleEnabled}
+
+// clearFlag removes the override of flag on behalf of the current user.
+func (r *Resolver) clearFlag(ctx context.Context, flag string) (bool, error) {
+	user, err := auth.MustUser(ctx)
+	if err != nil {
+		return false, err
+	}
+	i := slices.Index(overridable, flags.Key[bool](flag))
+	if i < 0 {
+		return false, &FieldError{Code: CodeBadUserInput, Path: []any{"flag"}, Message: "must be a flag the mutations override"}
+	}
+	if _, err := r.FF.Clear(ctx, overridable[i], user.ID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func flagChange(c flags.Change) *model.FlagChange {
+	return &model.FlagChange{
+		Flag:      c.Flag,
+		Enabled:   c.Value,
+		Cleared:   c.Cleared,
+		ChangedBy: c.By,
+		ChangedAt: c.At,
+	}
+}
+
+// productKey is the cache key of a product. v2 holds cache.Loader entries;
+// plain product JSON from before the Loader stays under product:<id> until
+// it expires.
+func productKey(id string) string {
+	return "product:v2:" + id
+}
+
+// money returns amount, in minor units, in the gateway's currency, or nil
+// if the amount is unknown.
+func (r *Resolver) money(amount *int32) *scalar.Money {
+	if amount == nil {
+		return nil
+	}
+	return &scalar.Money{Amount: int64(*amount), Currency: r.Currency}
 }
@@ -7,127 +7,250 @@ package graphql
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	rand "math/rand/v2"
+	"errors"
+	"rxw1/chaos"
+	"rxw1/flags"
+	"rxw1/gatewaysvc/internal/auth"
+	"rxw1/gatewaysvc/internal/cache"
+	"rxw1/gatewaysvc/internal/scalar"
 	"rxw1/logging"
 	"rxw1/model"
+	"strings"
 	"time"
 
 	nats "github.com/nats-io/nats.go"
 	ulid "github.com/oklog/ulid/v2"
 )
 
+// PlaceOrder is the resolver for the placeOrder field.
+func (r *mutationResolver) PlaceOrder(ctx context.Context, input model.OrderInput) (*model.Order, error) {
+	ctx = logging.With(ctx, "items", len(input.Items))
+	logging.From(ctx).Info("[mutationResolver] PlaceOrder")
+
+	user, err := auth.MustUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var v validator
+	v.orderInput(input)
+	if err := v.err(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.CH.Inject(ctx, chaos.Resolver); err != nil {
+		return nil, err
+	}
+
+	path := func(i int, field string) []any { return []any{"input", "items", i, field} }
+	return r.placeOrder(ctx, user, "placeOrder", input.Items, path, input.IdempotencyKey, input.Items)
+}
+
 // CreateOrder is the resolver for the createOrder field.
-func (r *mutationResolver) CreateOrder(ctx context.Context, productID string, qty int32) (*model.Order, error) {
+func (r *mutationResolver) CreateOrder(ctx context.Context, productID string, qty int32, idempotencyKey *string) (*model.Order, error) {
 	ctx = logging.With(ctx, "productID", productID)
 	logging.From(ctx).Info("[mutationResolver] CreateOrder")
 
-	event := map[string]any{
-		"id":        ulid.Make().String(),
-		"eventID":   ulid.Make().String(),
-		"productID": productID,
-		"qty":       qty,
-		"createdAt": time.Now().UTC().Format(time.RFC3339),
-	}
-
-	b, err := json.Marshal(event)
+	user, err := auth.MustUser(ctx)
 	if err != nil {
-		logging.From(ctx).Error("failed to marshal event", "error", err)
 		return nil, err
 	}
-
-	time.Sleep(time.Duration(rand.IntN(500)) * time.Millisecond)
-
-	if err := r.NC.Publish("order.created", b); err != nil {
-		logging.From(ctx).Error("failed to publish event", "error", err)
+	var v validator
+	v.ulid(productID, "productId")
+	v.qty(qty, "qty")
+	v.idempotencyKey(idempotencyKey, "idempotencyKey")
+	if err := v.err(ctx); err != nil {
 		return nil, err
 	}
-
-	order := &model.Order{
-		ID:        event["id"].(string),
-		Qty:       event["qty"].(int32),
-		ProductID: event["productID"].(string),
-		EventID:   event["eventID"].(string),
-		CreatedAt: event["createdAt"].(string),
+	if err := r.CH.Inject(ctx, chaos.Resolver); err != nil {
+		return nil, err
 	}
 
-	logging.From(ctx).Info("order created", "order", order)
-	return order, nil
+	in := []*model.OrderItemInput{{ProductID: productID, Qty: qty}}
+	path := func(_ int, field string) []any { return []any{field} }
+	return r.placeOrder(ctx, user, "createOrder", in, path, idempotencyKey, []any{productID, qty})
 }
 
 // CancelOrder is the resolver for the cancelOrder field.
-func (r *mutationResolver) CancelOrder(ctx context.Context, orderID string) (*model.Order, error) {
+func (r *mutationResolver) CancelOrder(ctx context.Context, orderID string, idempotencyKey *string) (*model.Order, error) {
 	ctx = logging.With(ctx)
 
 	logging.From(ctx).Info("[mutationResolver] CancelOrder", "orderID", orderID)
 
-	event := map[string]any{
-		"id":        orderID,
-		"eventID":   ulid.Make().String(),
-		"createdAt": time.Now().UTC().Format(time.RFC3339),
+	user, err := auth.MustUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var v validator
+	v.ulid(orderID, "orderId")
+	v.idempotencyKey(idempotencyKey, "idempotencyKey")
+	if err := v.err(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.CH.Inject(ctx, chaos.Resolver); err != nil {
+		return nil, err
 	}
 
-	b, err := json.Marshal(event)
+	existing, err := r.Query().OrderByID(ctx, orderID)
 	if err != nil {
-		logging.From(ctx).Error("failed to marshal event", "error", err)
 		return nil, err
 	}
+	if existing == nil {
+		return nil, &FieldError{Code: CodeNotFound, Path: []any{"orderId"}, Message: "no such order"}
+	}
+	if existing.UserID != user.ID && !user.HasRole(model.RoleAdmin.String()) {
+		logging.From(ctx).Warn("cancel denied", "owner", existing.UserID)
+		return nil, auth.ErrForbidden
+	}
 
-	time.Sleep(time.Duration(rand.IntN(500)) * time.Millisecond)
+	return r.idempotent(ctx, user.ID, "cancelOrder", idempotencyKey, []any{orderID}, func(key string) (*model.Order, error) {
+		// Checked here rather than before, so a retried key still replays
+		// the cancellation it made.
+		if existing.Status == model.OrderStatusCanceled || existing.Status == model.OrderStatusRejected {
+			return nil, &FieldError{Code: CodeConflict, Path: []any{"orderId"}, Message: "order is already " + strings.ToLower(existing.Status.String())}
+		}
 
-	if err := r.NC.Publish("order.canceled", b); err != nil {
-		logging.From(ctx).Error("failed to publish event", "error", err)
-		return nil, err
-	}
+		event := map[string]any{
+			"id":             orderID,
+			"eventID":        ulid.Make().String(),
+			"createdAt":      time.Now().UTC().Truncate(time.Second),
+			"idempotencyKey": key,
+		}
 
-	order := &model.Order{
-		ID:        event["id"].(string),
-		EventID:   event["eventID"].(string),
-		CreatedAt: event["createdAt"].(string),
-	}
+		b, err := json.Marshal(event)
+		if err != nil {
+			logging.From(ctx).Error("failed to marshal event", "error", err)
+			return nil, err
+		}
 
-	logging.From(ctx).Info("order canceled", "order", order)
-	return order, nil
+		if err := r.publish(ctx, "order.canceled", b); err != nil {
+			logging.From(ctx).Error("failed to publish event", "error", err)
+			return nil, err
+		}
+
+		order := &model.Order{
+			ID:        event["id"].(string),
+			EventID:   event["eventID"].(string),
+			CreatedAt: existing.CreatedAt,
+			UserID:    existing.UserID,
+			Status:    model.OrderStatusCanceled,
+			Items:     existing.Items,
+			Total:     existing.Total,
+		}
+
+		logging.From(ctx).Info("order canceled", "order", order)
+		return order, nil
+	})
 }
 
 // EnableCache is the resolver for the enableCache field.
 func (r *mutationResolver) EnableCache(ctx context.Context) (bool, error) {
-	panic(fmt.Errorf("not implemented: EnableCache - enableCache"))
+	return r.setFlag(ctx, flags.RedisCacheEnabled, true)
 }
 
 // DisableCache is the resolver for the disableCache field.
 func (r *mutationResolver) DisableCache(ctx context.Context) (bool, error) {
-	panic(fmt.Errorf("not implemented: DisableCache - disableCache"))
+	return r.setFlag(ctx, flags.RedisCacheEnabled, false)
 }
 
 // ClearCache is the resolver for the clearCache field.
 func (r *mutationResolver) ClearCache(ctx context.Context) (bool, error) {
-	panic(fmt.Errorf("not implemented: ClearCache - clearCache"))
+	logging.From(ctx).Info("[mutationResolver] ClearCache")
+
+	products, err := r.Query().Products(ctx)
+	if err != nil {
+		return false, err
+	}
+	// Deleting through the loader's cache also drops L1 copies on every
+	// gateway. Cached misses for unknown ids expire on their own.
+	for _, p := range products {
+		if err := r.PC.Cache.Del(ctx, productKey(p.ID)); err != nil {
+			logging.From(ctx).Error("failed to delete cached product", "productID", p.ID, "error", err)
+			return false, err
+		}
+	}
+
+	logging.From(ctx).Info("cleared product cache", "count", len(products))
+	return true, nil
 }
 
 // EnableThrottling is the resolver for the enableThrottling field.
 func (r *mutationResolver) EnableThrottling(ctx context.Context) (bool, error) {
-	panic(fmt.Errorf("not implemented: EnableThrottling - enableThrottling"))
+	return r.setFlag(ctx, flags.ThrottleEnabled, true)
 }
 
 // DisableThrottling is the resolver for the disableThrottling field.
 func (r *mutationResolver) DisableThrottling(ctx context.Context) (bool, error) {
-	panic(fmt.Errorf("not implemented: DisableThrottling - disableThrottling"))
+	return r.setFlag(ctx, flags.ThrottleEnabled, false)
+}
+
+// ClearFlagOverride is the resolver for the clearFlagOverride field.
+func (r *mutationResolver) ClearFlagOverride(ctx context.Context, flag string) (bool, error) {
+	return r.clearFlag(ctx, flag)
+}
+
+// TotalPrice is the resolver for the totalPrice field.
+func (r *orderResolver) TotalPrice(ctx context.Context, obj *model.Order) (*scalar.Money, error) {
+	return r.money(obj.Total), nil
+}
+
+// History is the resolver for the history field.
+func (r *orderResolver) History(ctx context.Context, obj *model.Order) ([]*model.OrderEvent, error) {
+	ctx = logging.With(ctx, "orderID", obj.ID)
+	logging.From(ctx).Info("[orderResolver] History")
+
+	msg, err := r.NC.Request("orders.history", []byte(obj.ID), 2*time.Second)
+	if err != nil {
+		logging.From(ctx).Error("failed to request order history", "subject", "orders.history", "error", err)
+		return nil, err
+	}
+
+	events := []*model.OrderEvent{}
+	if err := json.Unmarshal(msg.Data, &events); err != nil {
+		logging.From(ctx).Error("failed to unmarshal order history", "error", err)
+		return nil, err
+	}
+
+	logging.From(ctx).Info("fetched order history", "count", len(events))
+	return events, nil
+}
+
+// UnitPrice is the resolver for the unitPrice field.
+func (r *orderItemResolver) UnitPrice(ctx context.Context, obj *model.OrderItem) (*scalar.Money, error) {
+	return r.money(obj.Price), nil
+}
+
+// SubtotalPrice is the resolver for the subtotalPrice field.
+func (r *orderItemResolver) SubtotalPrice(ctx context.Context, obj *model.OrderItem) (*scalar.Money, error) {
+	return r.money(obj.Subtotal), nil
+}
+
+// UnitPrice is the resolver for the unitPrice field.
+func (r *productResolver) UnitPrice(ctx context.Context, obj *model.Product) (*scalar.Money, error) {
+	return r.money(&obj.Price), nil
 }
 
 // CurrentTime is the resolver for the currentTime field.
 func (r *queryResolver) CurrentTime(ctx context.Context) (*model.Time, error) {
-	panic(fmt.Errorf("not implemented: CurrentTime - currentTime"))
+	now := time.Now().UTC()
+	return &model.Time{UnixTime: int32(now.Unix()), TimeStamp: now}, nil
+}
+
+// Me is the resolver for the me field.
+func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
+	u, ok := auth.UserFrom(ctx)
+	if !ok {
+		return nil, nil
+	}
+	return &model.User{ID: u.ID, Name: u.Name}, nil
 }
 
 // IsCacheEnabled is the resolver for the isCacheEnabled field.
 func (r *queryResolver) IsCacheEnabled(ctx context.Context) (bool, error) {
-	panic(fmt.Errorf("not implemented: IsCacheEnabled - isCacheEnabled"))
+	return r.FF.RedisEnabled(ctx), nil
 }
 
 // IsThrottlingEnabled is the resolver for the isThrottlingEnabled field.
 func (r *queryResolver) IsThrottlingEnabled(ctx context.Context) (bool, error) {
-	panic(fmt.Errorf("not implemented: IsThrottlingEnabled - isThrottlingEnabled"))
+	return r.FF.ThrottleEnabled(ctx), nil
 }
 
 // Orders is the resolver for the orders field.
@@ -156,20 +279,26 @@ func (r *queryResolver) OrderByID(ctx context.Context, orderID string) (*model.O
 	ctx = logging.With(ctx, "orderID", orderID)
 	logging.From(ctx).Info("[queryResolver] OrderByID")
 
+	var v validator
+	v.ulid(orderID, "orderId")
+	if err := v.err(ctx); err != nil {
+		return nil, err
+	}
+
 	msg, err := r.NC.Request("orders.get", []byte(orderID), 2*time.Second)
 	if err != nil {
 		logging.From(ctx).Error("failed to request order", "subject", "orders.get", "error", err)
 		return nil, err
 	}
 
-	var order model.Order
+	var order *model.Order
 	if err := json.Unmarshal(msg.Data, &order); err != nil {
 		logging.From(ctx).Error("failed to unmarshal order", "error", err)
 		return nil, err
 	}
 
 	logging.From(ctx).Info("fetched order", "order", order)
-	return &order, nil
+	return order, nil
 }
 
 // OrdersByUserID is the resolver for the ordersByUserId field.
@@ -177,6 +306,12 @@ func (r *queryResolver) OrdersByUserID(ctx context.Context, userID string) ([]*m
 	ctx = logging.With(ctx, "userID", userID)
 	logging.From(ctx).Info("[queryResolver] OrdersByUserID")
 
+	var v validator
+	v.length(userID, maxUserIDLen, "userId")
+	if err := v.err(ctx); err != nil {
+		return nil, err
+	}
+
 	msg, err := r.NC.Request("orders.by_user", []byte(userID), 2*time.Second)
 	if err != nil {
 		logging.From(ctx).Error("failed to request orders", "subject", "orders.by_user", "error", err)
@@ -220,24 +355,40 @@ func (r *queryResolver) ProductByID(ctx context.Context, productID string) (*mod
 
 	logging.From(ctx).Info("[queryResolver] ProductByID")
 
-	useCache := r.FF.RedisEnabled(ctx)
-	if useCache {
-		if s, err := r.RC.Get(ctx, "product:"+productID); err == nil {
-			var p model.Product
-			if json.Unmarshal([]byte(s), &p) == nil {
-				return &p, nil
-			}
+	var v validator
+	v.ulid(productID, "productId")
+	if err := v.err(ctx); err != nil {
+		return nil, err
+	}
+
+	load := func(ctx context.Context) (string, error) {
+		msg, err := r.NC.Request("products.get", []byte(productID), 2*time.Second)
+		if err != nil {
+			logging.From(ctx).Error("failed to request product", "subject", "products.get", "error", err)
+			return "", err
 		}
+		if string(msg.Data) == "null" {
+			return "", cache.ErrNotFound
+		}
+		return string(msg.Data), nil
 	}
 
-	msg, err := r.NC.Request("products.get", []byte(productID), 2*time.Second)
+	var s string
+	var err error
+	if r.FF.RedisEnabled(ctx) {
+		s, err = r.PC.Get(ctx, productKey(productID), load)
+	} else {
+		s, err = load(ctx)
+	}
+	if errors.Is(err, cache.ErrNotFound) {
+		return nil, nil
+	}
 	if err != nil {
-		logging.From(ctx).Error("failed to request product", "subject", "products.get", "error", err)
 		return nil, err
 	}
 
 	var p model.Product
-	if err := json.Unmarshal(msg.Data, &p); err != nil {
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
 		logging.From(ctx).Error("failed to unmarshal product", "error", err)
 		return nil, err
 	}
@@ -249,12 +400,50 @@ func (r *queryResolver) ProductByID(ctx context.Context, productID string) (*mod
 
 // Users is the resolver for the users field.
 func (r *queryResolver) Users(ctx context.Context) ([]*model.User, error) {
-	panic(fmt.Errorf("not implemented: Users - users"))
+	ctx = logging.With(ctx)
+	logging.From(ctx).Info("[queryResolver] Users")
+
+	msg, err := r.NC.Request("users.all", nil, 2*time.Second)
+	if err != nil {
+		logging.From(ctx).Error("failed to request users", "subject", "users.all", "error", err)
+		return nil, err
+	}
+
+	var users []*model.User
+	if err := json.Unmarshal(msg.Data, &users); err != nil {
+		logging.From(ctx).Error("failed to unmarshal users", "error", err)
+		return nil, err
+	}
+
+	logging.From(ctx).Info("fetched users", "count", len(users))
+	return users, nil
 }
 
 // UserByID is the resolver for the userById field.
 func (r *queryResolver) UserByID(ctx context.Context, userID string) (*model.User, error) {
-	panic(fmt.Errorf("not implemented: UserByID - userById"))
+	ctx = logging.With(ctx, "userID", userID)
+	logging.From(ctx).Info("[queryResolver] UserByID")
+
+	var v validator
+	v.length(userID, maxUserIDLen, "userId")
+	if err := v.err(ctx); err != nil {
+		return nil, err
+	}
+
+	msg, err := r.NC.Request("users.get", []byte(userID), 2*time.Second)
+	if err != nil {
+		logging.From(ctx).Error("failed to request user", "subject", "users.get", "error", err)
+		return nil, err
+	}
+
+	var user *model.User
+	if err := json.Unmarshal(msg.Data, &user); err != nil {
+		logging.From(ctx).Error("failed to unmarshal user", "error", err)
+		return nil, err
+	}
+
+	logging.From(ctx).Info("fetched user", "user", user)
+	return user, nil
 }
 
 // LastOrderCreated is the resolver for the lastOrderCreated field.
@@ -264,7 +453,8 @@ func (r *subscriptionResolver) LastOrderCreated(ctx context.Context) (<-chan *mo
 	ch := make(chan *model.Order, 8) // buffered to avoid blocking NATS callback
 
 	sub, err := r.NC.Subscribe("order.created", func(m *nats.Msg) {
-		var o model.Order
+		// order.created events carry no status; every order starts CREATED.
+		o := model.Order{Status: model.OrderStatusCreated}
 		if err := json.Unmarshal(m.Data, &o); err != nil {
 			logging.From(ctx).Error("failed to unmarshal order", "error", err)
 			return
@@ -288,9 +478,42 @@ func (r *subscriptionResolver) LastOrderCreated(ctx context.Context) (<-chan *mo
 	return ch, nil
 }
 
+// FlagChanged is the resolver for the flagChanged field.
+func (r *subscriptionResolver) FlagChanged(ctx context.Context) (<-chan *model.FlagChange, error) {
+	ctx = logging.With(ctx)
+	logging.From(ctx).Info("[subscriptionResolver] FlagChanged")
+
+	changes, err := r.FF.Changes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *model.FlagChange, 8)
+	go func() {
+		defer close(ch)
+		for c := range changes {
+			select {
+			case ch <- flagChange(c):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
+// Order returns OrderResolver implementation.
+func (r *Resolver) Order() OrderResolver { return &orderResolver{r} }
+
+// OrderItem returns OrderItemResolver implementation.
+func (r *Resolver) OrderItem() OrderItemResolver { return &orderItemResolver{r} }
+
+// Product returns ProductResolver implementation.
+func (r *Resolver) Product() ProductResolver { return &productResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
@@ -298,5 +521,8 @@ func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
 
 type mutationResolver struct{ *Resolver }
+type orderResolver struct{ *Resolver }
+type orderItemResolver struct{ *Resolver }
+type productResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
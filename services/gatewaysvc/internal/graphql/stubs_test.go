@@ -0,0 +1,59 @@
+package graphql
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestNoResolverStubs fails while a resolver gqlgen generated is still the
+// stub that panics with "not implemented". gqlgen adds one for every field
+// added to the schema.
+func TestNoResolverStubs(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "schema.resolvers.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if msg, ok := stubPanic(n); ok {
+				t.Errorf("%s: %s panics: %s", fset.Position(n.Pos()), fn.Name.Name, msg)
+			}
+			return true
+		})
+	}
+}
+
+// stubPanic reports whether n is panic(fmt.Errorf("not implemented: ...")),
+// and its message.
+func stubPanic(n ast.Node) (string, bool) {
+	call, ok := n.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return "", false
+	}
+	if id, ok := call.Fun.(*ast.Ident); !ok || id.Name != "panic" {
+		return "", false
+	}
+	arg, ok := call.Args[0].(*ast.CallExpr)
+	if !ok || len(arg.Args) == 0 {
+		return "", false
+	}
+	lit, ok := arg.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	msg, err := strconv.Unquote(lit.Value)
+	if err != nil || !strings.HasPrefix(msg, "not implemented") {
+		return "", false
+	}
+	return msg, true
+}
@@ -0,0 +1,103 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/99designs/gqlgen/graphql"
+	ulid "github.com/oklog/ulid/v2"
+)
+
+// Error codes in extensions.code, besides UNAUTHENTICATED and FORBIDDEN
+// (see ErrorPresenter) and the limit codes of the extensions.
+const (
+	CodeBadUserInput    = "BAD_USER_INPUT"
+	CodeNotFound        = "NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+	CodeUpstreamTimeout = "UPSTREAM_TIMEOUT"
+	CodeInternal        = "INTERNAL"
+)
+
+// Bounds of mutation arguments; maxOrderItems is in orders.go.
+const (
+	maxItemQty   = 1000
+	maxKeyLen    = 128 // idempotency keys
+	maxUserIDLen = 128 // token subjects, which are not ULIDs
+)
+
+// FieldError rejects one argument of a field. Path locates the argument,
+// e.g. ["input", "items", 1, "qty"] for input.items[1].qty, and is returned
+// in extensions.field.
+type FieldError struct {
+	Code    string // CodeBadUserInput, CodeNotFound or CodeConflict
+	Path    []any
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	var b strings.Builder
+	for i, p := range e.Path {
+		switch p := p.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", p)
+		default:
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, p)
+		}
+	}
+	return b.String() + ": " + e.Message
+}
+
+// validator collects the FieldErrors of one field's arguments, so clients
+// see every bad argument at once.
+type validator struct {
+	errs []*FieldError
+}
+
+func (v *validator) add(code, msg string, path ...any) {
+	v.errs = append(v.errs, &FieldError{Code: code, Path: path, Message: msg})
+}
+
+// ulid checks id is a ULID, the format of order and product ids.
+func (v *validator) ulid(id string, path ...any) {
+	if _, err := ulid.ParseStrict(id); err != nil {
+		v.add(CodeBadUserInput, "must be a ULID", path...)
+	}
+}
+
+func (v *validator) qty(qty int32, path ...any) {
+	if qty < 1 || qty > maxItemQty {
+		v.add(CodeBadUserInput, fmt.Sprintf("must be between 1 and %d", maxItemQty), path...)
+	}
+}
+
+// length checks s has 1 to max characters.
+func (v *validator) length(s string, max int, path ...any) {
+	if n := utf8.RuneCountInString(s); n == 0 || n > max {
+		v.add(CodeBadUserInput, fmt.Sprintf("must have 1 to %d characters", max), path...)
+	}
+}
+
+// idempotencyKey checks an optional idempotency key argument.
+func (v *validator) idempotencyKey(key *string, path ...any) {
+	if key != nil && *key != "" {
+		v.length(*key, maxKeyLen, path...)
+	}
+}
+
+// err adds all errors but the last to the response and returns the last,
+// for the resolver to return. It is nil if the arguments are valid.
+func (v *validator) err(ctx context.Context) error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	last := len(v.errs) - 1
+	for _, e := range v.errs[:last] {
+		graphql.AddError(ctx, e)
+	}
+	return v.errs[last]
+}
@@ -0,0 +1,135 @@
+// Package idempotency replays the stored result of a mutation when a client
+// retries it with the same idempotency key.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"rxw1/logging"
+)
+
+var (
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+	ErrKeyReused  = errors.New("idempotency key was used with different arguments")
+)
+
+// KV is the subset of cache.Cache the store needs.
+type KV interface {
+	Get(ctx context.Context, k string) (string, error)
+	Set(ctx context.Context, k, v string, ttl time.Duration) error
+	SetNX(ctx context.Context, k, v string, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, k string) error
+}
+
+// pendingTTL bounds how long a crashed request blocks its key.
+const pendingTTL = 30 * time.Second
+
+type record struct {
+	Fingerprint string          `json:"fingerprint"`
+	Pending     bool            `json:"pending,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+// Store keeps results for TTL after the first successful request.
+type Store struct {
+	KV  KV
+	TTL time.Duration
+}
+
+// Do runs fn once per key and stores its result in out. A retry with the
+// same key and args gets the stored result without running fn; a failed fn
+// releases the key so the client can retry. Once fn succeeds Do does too,
+// even if the result cannot be stored.
+func (s *Store) Do(ctx context.Context, key string, args, out any, fn func() error) error {
+	fp, err := fingerprint(args)
+	if err != nil {
+		return err
+	}
+
+	pending, _ := json.Marshal(record{Fingerprint: fp, Pending: true})
+	ok, err := s.KV.SetNX(ctx, key, string(pending), pendingTTL)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return s.replay(ctx, key, fp, out)
+	}
+
+	if err := fn(); err != nil {
+		_ = s.KV.Del(ctx, key)
+		return err
+	}
+
+	res, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	done, _ := json.Marshal(record{Fingerprint: fp, Response: res})
+	if err := s.KV.Set(ctx, key, string(done), s.TTL); err != nil {
+		// fn has taken effect, so the caller gets its result. Retries see
+		// ErrInProgress until the pending record expires.
+		logging.From(ctx).Error("store idempotent result", "key", key, "error", err)
+	}
+	return nil
+}
+
+func (s *Store) replay(ctx context.Context, key, fp string, out any) error {
+	v, err := s.KV.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	var rec record
+	if err := json.Unmarshal([]byte(v), &rec); err != nil {
+		return fmt.Errorf("decode idempotency record: %w", err)
+	}
+	switch {
+	case rec.Fingerprint != fp:
+		return ErrKeyReused
+	case rec.Pending:
+		return ErrInProgress
+	}
+	return json.Unmarshal(rec.Response, out)
+}
+
+func fingerprint(args any) (string, error) {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Scope namespaces a client key per user and operation.
+func Scope(userID, op, key string) string {
+	return "idem:" + userID + ":" + op + ":" + key
+}
+
+type ctxKey struct{}
+
+// Header makes the Idempotency-Key request header available to KeyFrom.
+func Header(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if k := r.Header.Get("Idempotency-Key"); k != "" {
+			r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, k))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// KeyFrom returns the key from the mutation argument, or from the
+// Idempotency-Key header if the argument is not set.
+func KeyFrom(ctx context.Context, arg *string) string {
+	if arg != nil && *arg != "" {
+		return *arg
+	}
+	k, _ := ctx.Value(ctxKey{}).(string)
+	return k
+}
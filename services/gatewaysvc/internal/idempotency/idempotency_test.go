@@ -0,0 +1,152 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"rxw1/gatewaysvc/internal/idempotency"
+)
+
+type memKV struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+var errNotFound = errors.New("not found")
+
+func (kv *memKV) Get(_ context.Context, k string) (string, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	v, ok := kv.m[k]
+	if !ok {
+		return "", errNotFound
+	}
+	return v, nil
+}
+
+func (kv *memKV) Set(_ context.Context, k, v string, _ time.Duration) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.m[k] = v
+	return nil
+}
+
+func (kv *memKV) SetNX(_ context.Context, k, v string, _ time.Duration) (bool, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if _, ok := kv.m[k]; ok {
+		return false, nil
+	}
+	kv.m[k] = v
+	return true, nil
+}
+
+func (kv *memKV) Del(_ context.Context, k string) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	delete(kv.m, k)
+	return nil
+}
+
+type order struct {
+	ID  string
+	Qty int
+}
+
+func TestStore_Do(t *testing.T) {
+	ctx := context.Background()
+	s := &idempotency.Store{KV: &memKV{m: map[string]string{}}, TTL: time.Hour}
+	args := map[string]any{"productId": "p1", "qty": 2}
+
+	calls := 0
+	create := func(out *order) func() error {
+		return func() error {
+			calls++
+			*out = order{ID: "o1", Qty: 2}
+			return nil
+		}
+	}
+
+	var first order
+	if err := s.Do(ctx, "k1", args, &first, create(&first)); err != nil {
+		t.Fatal(err)
+	}
+
+	var retry order
+	if err := s.Do(ctx, "k1", args, &retry, create(&retry)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 || retry != first {
+		t.Errorf("retry: calls = %d, got %+v, want %+v", calls, retry, first)
+	}
+
+	var other order
+	err := s.Do(ctx, "k1", map[string]any{"productId": "p2", "qty": 2}, &other, create(&other))
+	if !errors.Is(err, idempotency.ErrKeyReused) {
+		t.Errorf("different args: err = %v, want ErrKeyReused", err)
+	}
+}
+
+func TestStore_DoFailureReleasesKey(t *testing.T) {
+	ctx := context.Background()
+	s := &idempotency.Store{KV: &memKV{m: map[string]string{}}, TTL: time.Hour}
+
+	var out order
+	boom := errors.New("boom")
+	if err := s.Do(ctx, "k", nil, &out, func() error { return boom }); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want boom", err)
+	}
+	if err := s.Do(ctx, "k", nil, &out, func() error { return nil }); err != nil {
+		t.Fatalf("retry after failure: %v", err)
+	}
+}
+
+// failingSet is a memKV whose Set fails.
+type failingSet struct{ *memKV }
+
+func (failingSet) Set(context.Context, string, string, time.Duration) error {
+	return errors.New("set failed")
+}
+
+func TestStore_DoResultNotStored(t *testing.T) {
+	ctx := context.Background()
+	s := &idempotency.Store{KV: failingSet{&memKV{m: map[string]string{}}}, TTL: time.Hour}
+
+	var out order
+	if err := s.Do(ctx, "k", nil, &out, func() error { out = order{ID: "o1"}; return nil }); err != nil || out.ID != "o1" {
+		t.Fatalf("Do() = %+v, %v, want the result of fn", out, err)
+	}
+	if err := s.Do(ctx, "k", nil, &out, func() error { return nil }); !errors.Is(err, idempotency.ErrInProgress) {
+		t.Errorf("retry: err = %v, want ErrInProgress", err)
+	}
+}
+
+func TestStore_DoInProgress(t *testing.T) {
+	ctx := context.Background()
+	s := &idempotency.Store{KV: &memKV{m: map[string]string{}}, TTL: time.Hour}
+
+	var out order
+	err := s.Do(ctx, "k", nil, &out, func() error {
+		return s.Do(ctx, "k", nil, &out, func() error { return nil })
+	})
+	if !errors.Is(err, idempotency.ErrInProgress) {
+		t.Errorf("concurrent request: err = %v, want ErrInProgress", err)
+	}
+}
+
+func TestKeyFrom(t *testing.T) {
+	arg := "from-arg"
+	empty := ""
+	if got := idempotency.KeyFrom(context.Background(), &arg); got != arg {
+		t.Errorf("KeyFrom(arg) = %q", got)
+	}
+	if got := idempotency.KeyFrom(context.Background(), &empty); got != "" {
+		t.Errorf("KeyFrom(empty) = %q", got)
+	}
+	if got := idempotency.KeyFrom(context.Background(), nil); got != "" {
+		t.Errorf("KeyFrom(nil) = %q", got)
+	}
+}
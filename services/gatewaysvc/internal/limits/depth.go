@@ -0,0 +1,40 @@
+package limits
+
+import (
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Depth returns the nesting depth of a selection set. Fragments are expanded
+// and introspection fields (__schema, __type, ...) are not counted, so the
+// playground's schema query is not rejected by a tight limit.
+func Depth(set ast.SelectionSet) int {
+	return depth(set, map[string]bool{})
+}
+
+func depth(set ast.SelectionSet, visiting map[string]bool) int {
+	maxDepth := 0
+	for _, sel := range set {
+		d := 0
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name, "__") {
+				continue
+			}
+			d = 1 + depth(sel.SelectionSet, visiting)
+		case *ast.InlineFragment:
+			d = depth(sel.SelectionSet, visiting)
+		case *ast.FragmentSpread:
+			// The validator rejects fragment cycles, guard anyway.
+			if sel.Definition == nil || visiting[sel.Name] {
+				continue
+			}
+			visiting[sel.Name] = true
+			d = depth(sel.Definition.SelectionSet, visiting)
+			delete(visiting, sel.Name)
+		}
+		maxDepth = max(maxDepth, d)
+	}
+	return maxDepth
+}
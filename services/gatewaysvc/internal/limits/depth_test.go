@@ -0,0 +1,42 @@
+package limits_test
+
+import (
+	"testing"
+
+	"rxw1/gatewaysvc/internal/limits"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+var schema = gqlparser.MustLoadSchema(&ast.Source{Input: `
+type Order { id: ID! product: Product }
+type Product { id: ID! orders: [Order!]! }
+type Query { orders: [Order!]! product: Product }
+`})
+
+func TestDepth(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"flat", `{ orders { id } }`, 2},
+		{"nested", `{ orders { product { orders { id } } } }`, 4},
+		{"widest branch wins", `{ product { id } orders { product { id } } }`, 3},
+		{"fragment", `{ orders { ...F } } fragment F on Order { product { id } }`, 3},
+		{"inline fragment", `{ orders { ... on Order { product { id } } } }`, 3},
+		{"introspection ignored", `{ __schema { types { fields { type { ofType { name } } } } } orders { id } }`, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := gqlparser.LoadQuery(schema, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := limits.Depth(doc.Operations[0].SelectionSet); got != tt.want {
+				t.Errorf("Depth() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
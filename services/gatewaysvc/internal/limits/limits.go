@@ -0,0 +1,76 @@
+// Package limits rejects GraphQL operations that are too deep or too
+// expensive before any resolver runs.
+package limits
+
+import (
+	"context"
+	"expvar"
+
+	"rxw1/logging"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const errDepthLimit = "DEPTH_LIMIT_EXCEEDED"
+
+// Rejected counts rejected operations by reason ("depth", "complexity").
+// It is published on /debug/vars.
+var Rejected = expvar.NewMap("graphql_rejected_operations")
+
+// DepthLimit rejects operations nested deeper than Max fields.
+type DepthLimit struct {
+	Max int
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = DepthLimit{}
+
+func (DepthLimit) ExtensionName() string {
+	return "DepthLimit"
+}
+
+func (DepthLimit) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (l DepthLimit) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	d := Depth(rc.Operation.SelectionSet)
+	if d <= l.Max {
+		return nil
+	}
+
+	reject(ctx, rc, "depth", "depth", d, "limit", l.Max)
+	err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", d, l.Max)
+	err.Extensions = map[string]any{"code": errDepthLimit}
+	return err
+}
+
+// ComplexityLimit wraps gqlgen's fixed complexity limit to log and count
+// rejected operations. Field costs come from the schema's ComplexityRoot.
+type ComplexityLimit struct {
+	*extension.ComplexityLimit
+	max int
+}
+
+func NewComplexityLimit(max int) ComplexityLimit {
+	return ComplexityLimit{ComplexityLimit: extension.FixedComplexityLimit(max), max: max}
+}
+
+func (l ComplexityLimit) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	// gqlgen already sets extensions.code COMPLEXITY_LIMIT_EXCEEDED.
+	err := l.ComplexityLimit.MutateOperationContext(ctx, rc)
+	if err != nil {
+		reject(ctx, rc, "complexity", "limit", l.max, "error", err.Message)
+	}
+	return err
+}
+
+func reject(ctx context.Context, rc *graphql.OperationContext, reason string, args ...any) {
+	Rejected.Add(reason, 1)
+	args = append(args, "reason", reason, "operation", rc.OperationName)
+	logging.From(ctx).Warn("rejected operation", args...)
+}
@@ -0,0 +1,70 @@
+package limits_test
+
+import (
+	"context"
+	"expvar"
+	"testing"
+
+	"rxw1/gatewaysvc/internal/limits"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// costs is an ExecutableSchema over schema whose orders field costs ten
+// times its children; other fields keep gqlgen's default of 1 each.
+type costs struct{ graphql.ExecutableSchema }
+
+func (costs) Schema() *ast.Schema { return schema }
+
+func (costs) Complexity(_ context.Context, typeName, field string, childComplexity int, _ map[string]any) (int, bool) {
+	if typeName == "Query" && field == "orders" {
+		return 10 * childComplexity, true
+	}
+	return 0, false
+}
+
+func rejected(reason string) int64 {
+	v, _ := limits.Rejected.Get(reason).(*expvar.Int)
+	if v == nil {
+		return 0
+	}
+	return v.Value()
+}
+
+func TestComplexityLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		reject bool
+	}{
+		{"under", `{ product { id } }`, false},                  // 2
+		{"at limit", `{ orders { id product { id } } }`, false}, // 10 * 3
+		{"over", `{ orders { id product { id orders { id } } } }`, true},
+	}
+	l := limits.NewComplexityLimit(30)
+	if err := l.Validate(costs{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := gqlparser.LoadQuery(schema, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := rejected("complexity")
+			rc := &graphql.OperationContext{Doc: doc, Operation: doc.Operations[0]}
+			gerr := l.MutateOperationContext(context.Background(), rc)
+			if (gerr != nil) != tt.reject {
+				t.Fatalf("MutateOperationContext() = %v, want rejected %v", gerr, tt.reject)
+			}
+			if gerr != nil && gerr.Extensions["code"] != "COMPLEXITY_LIMIT_EXCEEDED" {
+				t.Errorf("code = %v, want COMPLEXITY_LIMIT_EXCEEDED", gerr.Extensions["code"])
+			}
+			if got, want := rejected("complexity")-before, map[bool]int64{true: 1}[tt.reject]; got != want {
+				t.Errorf("Rejected[complexity] grew by %d, want %d", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Package ratelimit limits GraphQL operations per caller with token buckets
+// kept in Redis, falling back to process memory when Redis is unavailable.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"rxw1/gatewaysvc/internal/cache"
+)
+
+// Limit is a token bucket: Burst tokens at most, refilled at Rate tokens per
+// second. A zero Rate disables the limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Store takes one token from the bucket key. When the bucket is empty it
+// returns false and how long until the next token is available. Refund
+// puts back a token taken for an operation that was rejected anyway.
+type Store interface {
+	Take(ctx context.Context, key string, l Limit, now time.Time) (bool, time.Duration, error)
+	Refund(ctx context.Context, key string, l Limit) error
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills b for the time since its last use and takes a token.
+func (b *bucket) take(l Limit, now time.Time) (bool, time.Duration) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(l.Burst), b.tokens+elapsed*l.Rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	return false, wait
+}
+
+// Memory is an in-process Store. Buckets that have refilled completely are
+// dropped once the map grows past maxIdle entries.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+const maxIdle = 10_000
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}}
+}
+
+func (m *Memory) Take(_ context.Context, key string, l Limit, now time.Time) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		if len(m.buckets) >= maxIdle {
+			m.sweep(l, now)
+		}
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		m.buckets[key] = b
+	}
+	allowed, wait := b.take(l, now)
+	return allowed, wait, nil
+}
+
+func (m *Memory) Refund(_ context.Context, key string, l Limit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if b, ok := m.buckets[key]; ok {
+		b.tokens = math.Min(float64(l.Burst), b.tokens+1)
+	}
+	return nil
+}
+
+func (m *Memory) sweep(l Limit, now time.Time) {
+	full := time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+	for k, b := range m.buckets {
+		if now.Sub(b.last) >= full {
+			delete(m.buckets, k)
+		}
+	}
+}
+
+// Fallback uses Primary and switches to Secondary for a call when Primary
+// fails, so a Redis outage degrades to per-replica limits instead of none.
+// After a failure it skips Primary until Breaker closes again.
+type Fallback struct {
+	Primary, Secondary Store
+	Breaker            *cache.Breaker
+	OnError            func(ctx context.Context, err error)
+}
+
+func (f Fallback) Take(ctx context.Context, key string, l Limit, now time.Time) (bool, time.Duration, error) {
+	if f.Breaker.Open() {
+		return f.Secondary.Take(ctx, key, l, now)
+	}
+	allowed, wait, err := f.Primary.Take(ctx, key, l, now)
+	if err == nil {
+		return allowed, wait, nil
+	}
+	f.failed(ctx, err)
+	return f.Secondary.Take(ctx, key, l, now)
+}
+
+func (f Fallback) Refund(ctx context.Context, key string, l Limit) error {
+	if f.Breaker.Open() {
+		return f.Secondary.Refund(ctx, key, l)
+	}
+	if err := f.Primary.Refund(ctx, key, l); err != nil {
+		f.failed(ctx, err)
+		return f.Secondary.Refund(ctx, key, l)
+	}
+	return nil
+}
+
+func (f Fallback) failed(ctx context.Context, err error) {
+	f.Breaker.Trip()
+	if f.OnError != nil {
+		f.OnError(ctx, err)
+	}
+}
@@ -0,0 +1,135 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"rxw1/gatewaysvc/internal/cache"
+	"rxw1/gatewaysvc/internal/ratelimit"
+)
+
+func TestMemory_Take(t *testing.T) {
+	ctx := context.Background()
+	lim := ratelimit.Limit{Rate: 1, Burst: 2} // one token per second
+	t0 := time.Unix(1000, 0)
+
+	tests := []struct {
+		name        string
+		key         string
+		at          time.Duration
+		wantAllowed bool
+		wantWait    time.Duration
+	}{
+		{"burst 1", "a", 0, true, 0},
+		{"burst 2", "a", 0, true, 0},
+		{"empty", "a", 0, false, time.Second},
+		{"partially refilled", "a", 500 * time.Millisecond, false, 500 * time.Millisecond},
+		{"refilled", "a", time.Second, true, 0},
+		{"other key has own bucket", "b", time.Second, true, 0},
+		{"refill capped at burst", "a", time.Hour, true, 0},
+		{"second after long idle", "a", time.Hour, true, 0},
+		{"third after long idle", "a", time.Hour, false, time.Second},
+	}
+
+	m := ratelimit.NewMemory()
+	for _, tt := range tests {
+		allowed, wait, err := m.Take(ctx, tt.key, lim, t0.Add(tt.at))
+		if err != nil {
+			t.Fatalf("%s: Take() failed: %v", tt.name, err)
+		}
+		if allowed != tt.wantAllowed || wait != tt.wantWait {
+			t.Errorf("%s: Take() = %v, %v, want %v, %v", tt.name, allowed, wait, tt.wantAllowed, tt.wantWait)
+		}
+	}
+}
+
+func TestMemory_Refund(t *testing.T) {
+	ctx := context.Background()
+	lim := ratelimit.Limit{Rate: 1, Burst: 2}
+	now := time.Unix(1000, 0)
+
+	m := ratelimit.NewMemory()
+	for range 2 {
+		if ok, _, _ := m.Take(ctx, "a", lim, now); !ok {
+			t.Fatal("Take() within burst rejected")
+		}
+	}
+	for range 3 { // refunds stop at the burst
+		if err := m.Refund(ctx, "a", lim); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Refund(ctx, "unknown", lim); err != nil {
+		t.Fatal(err)
+	}
+	var allowed int
+	for range 3 {
+		if ok, _, _ := m.Take(ctx, "a", lim, now); ok {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Take() allowed %d times after refunds, want 2", allowed)
+	}
+}
+
+// failing is a Store that always fails and counts the calls it gets.
+type failing struct{ calls *int }
+
+func (f failing) Take(context.Context, string, ratelimit.Limit, time.Time) (bool, time.Duration, error) {
+	*f.calls++
+	return false, 0, errors.New("redis down")
+}
+
+func (f failing) Refund(context.Context, string, ratelimit.Limit) error {
+	*f.calls++
+	return errors.New("redis down")
+}
+
+func TestFallback_Take(t *testing.T) {
+	var failures, calls int
+	s := ratelimit.Fallback{
+		Primary:   failing{&calls},
+		Secondary: ratelimit.NewMemory(),
+		OnError:   func(context.Context, error) { failures++ },
+	}
+
+	lim := ratelimit.Limit{Rate: 1, Burst: 1}
+	now := time.Now()
+	if ok, _, err := s.Take(context.Background(), "k", lim, now); !ok || err != nil {
+		t.Fatalf("first Take() = %v, %v", ok, err)
+	}
+	if ok, _, err := s.Take(context.Background(), "k", lim, now); ok || err != nil {
+		t.Fatalf("second Take() = %v, %v", ok, err)
+	}
+	if failures != 2 {
+		t.Errorf("OnError called %d times, want 2", failures)
+	}
+}
+
+func TestFallback_Breaker(t *testing.T) {
+	var calls int
+	b := &cache.Breaker{Cooldown: time.Hour}
+	s := ratelimit.Fallback{Primary: failing{&calls}, Secondary: ratelimit.NewMemory(), Breaker: b}
+
+	lim := ratelimit.Limit{Rate: 1, Burst: 1}
+	now := time.Now()
+	ctx := context.Background()
+	if ok, _, err := s.Take(ctx, "k", lim, now); !ok || err != nil {
+		t.Fatalf("first Take() = %v, %v", ok, err)
+	}
+	if ok, _, err := s.Take(ctx, "k", lim, now); ok || err != nil {
+		t.Fatalf("second Take() = %v, %v", ok, err)
+	}
+	if err := s.Refund(ctx, "k", lim); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _, err := s.Take(ctx, "k", lim, now); !ok || err != nil {
+		t.Fatalf("Take() after Refund() = %v, %v", ok, err)
+	}
+	if calls != 1 {
+		t.Errorf("primary called %d times, want 1 before the breaker opened", calls)
+	}
+}
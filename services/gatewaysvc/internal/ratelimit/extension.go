@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"rxw1/gatewaysvc/internal/auth"
+	"rxw1/gatewaysvc/internal/limits"
+	"rxw1/logging"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const errRateLimited = "RATE_LIMITED"
+
+// Limiter takes a token per root field of every operation from the caller's
+// bucket for that field. Limits maps field names to limits, "*" applies to
+// fields without their own entry. A rejected operation gets back the tokens
+// it took for its other fields. Store errors fail open.
+type Limiter struct {
+	Store  Store
+	Limits func(ctx context.Context) map[string]Limit
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+} = Limiter{}
+
+func (Limiter) ExtensionName() string {
+	return "RateLimit"
+}
+
+func (Limiter) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (l Limiter) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	rc := graphql.GetOperationContext(ctx)
+	caller := callerKey(ctx)
+	lims := l.Limits(ctx)
+	now := time.Now()
+
+	type taken struct {
+		key string
+		lim Limit
+	}
+	var took []taken
+	for _, field := range rootFields(rc.Operation.SelectionSet) {
+		lim, ok := lims[field]
+		if !ok {
+			lim, ok = lims["*"]
+		}
+		if !ok || lim.Rate <= 0 {
+			continue
+		}
+
+		key := caller + ":" + field
+		allowed, wait, err := l.Store.Take(ctx, key, lim, now)
+		if err != nil {
+			logging.From(ctx).Error("rate limit store failed", "error", err)
+			continue
+		}
+		if allowed {
+			took = append(took, taken{key, lim})
+			continue
+		}
+		for _, t := range took {
+			if err := l.Store.Refund(ctx, t.key, t.lim); err != nil {
+				logging.From(ctx).Error("rate limit refund failed", "key", t.key, "error", err)
+			}
+		}
+
+		secs := int(math.Ceil(wait.Seconds()))
+		limits.Rejected.Add("rate", 1)
+		logging.From(ctx).Warn("rejected operation", "reason", "rate", "field", field, "caller", caller, "retryAfter", secs)
+
+		gqlErr := gqlerror.Errorf("rate limit exceeded for %s, retry in %ds", field, secs)
+		gqlErr.Extensions = map[string]any{"code": errRateLimited, "retryAfter": secs}
+		return graphql.OneShot(&graphql.Response{Errors: gqlerror.List{gqlErr}})
+	}
+	return next(ctx)
+}
+
+// rootFields returns the distinct root field names of an operation.
+func rootFields(set ast.SelectionSet) []string {
+	var fields []string
+	for _, sel := range set {
+		var names []string
+		switch sel := sel.(type) {
+		case *ast.Field:
+			names = []string{sel.Name}
+		case *ast.InlineFragment:
+			names = rootFields(sel.SelectionSet)
+		case *ast.FragmentSpread:
+			if sel.Definition != nil {
+				names = rootFields(sel.Definition.SelectionSet)
+			}
+		}
+		for _, n := range names {
+			if !strings.HasPrefix(n, "__") && !slices.Contains(fields, n) {
+				fields = append(fields, n)
+			}
+		}
+	}
+	return fields
+}
+
+// callerKey identifies the bucket owner: the user if authenticated, the
+// client IP otherwise.
+func callerKey(ctx context.Context) string {
+	if u, ok := auth.UserFrom(ctx); ok {
+		return "user:" + u.ID
+	}
+	if ip, ok := ctx.Value(ipKey{}).(string); ok {
+		return "ip:" + ip
+	}
+	return "anonymous"
+}
+
+type ipKey struct{}
+
+// ClientIP stores the request's remote IP for callerKey. Put chi's RealIP
+// middleware in front of it when running behind a trusted proxy.
+func ClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ipKey{}, host)))
+	})
+}
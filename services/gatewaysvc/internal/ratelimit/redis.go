@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript is the Redis side of bucket.take. Time is passed in from the
+// caller so all gateway replicas agree with the in-memory fallback.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(b[1]) or burst
+local last = tonumber(b[2]) or now
+if now > last then
+  tokens = math.min(burst, tokens + (now - last) / 1000 * rate)
+end
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return {allowed, wait}
+`)
+
+// refundScript puts a token back into a bucket that still exists, up to
+// its burst.
+var refundScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
+if tokens then
+  redis.call('HSET', KEYS[1], 'tokens', tostring(math.min(burst, tokens + 1)))
+end
+return 0
+`)
+
+// Redis is a Store shared by all gateway replicas.
+type Redis struct {
+	R redis.UniversalClient
+}
+
+func (r Redis) Take(ctx context.Context, key string, l Limit, now time.Time) (bool, time.Duration, error) {
+	res, err := takeScript.Run(ctx, r.R, []string{"ratelimit:" + key},
+		strconv.FormatFloat(l.Rate, 'f', -1, 64),
+		l.Burst,
+		now.UnixMilli(),
+	).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+func (r Redis) Refund(ctx context.Context, key string, l Limit) error {
+	return refundScript.Run(ctx, r.R, []string{"ratelimit:" + key}, l.Burst).Err()
+}
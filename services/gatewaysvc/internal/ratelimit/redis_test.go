@@ -0,0 +1,107 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rxw1/gatewaysvc/internal/ratelimit"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newRedis(t *testing.T) (ratelimit.Redis, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return ratelimit.Redis{R: rdb}, mr
+}
+
+func TestRedis_Take(t *testing.T) {
+	ctx := context.Background()
+	lim := ratelimit.Limit{Rate: 1, Burst: 2} // one token per second
+	t0 := time.Unix(1000, 0)
+
+	tests := []struct {
+		name        string
+		key         string
+		at          time.Duration
+		wantAllowed bool
+		wantWait    time.Duration
+	}{
+		{"burst 1", "a", 0, true, 0},
+		{"burst 2", "a", 0, true, 0},
+		{"empty", "a", 0, false, time.Second},
+		{"partially refilled", "a", 500 * time.Millisecond, false, 500 * time.Millisecond},
+		{"refilled", "a", time.Second, true, 0},
+		{"other key has own bucket", "b", time.Second, true, 0},
+		{"refill capped at burst", "a", time.Hour, true, 0},
+		{"second after long idle", "a", time.Hour, true, 0},
+		{"third after long idle", "a", time.Hour, false, time.Second},
+	}
+
+	s, _ := newRedis(t)
+	for _, tt := range tests {
+		allowed, wait, err := s.Take(ctx, tt.key, lim, t0.Add(tt.at))
+		if err != nil {
+			t.Fatalf("%s: Take() failed: %v", tt.name, err)
+		}
+		if allowed != tt.wantAllowed || wait != tt.wantWait {
+			t.Errorf("%s: Take() = %v, %v, want %v, %v", tt.name, allowed, wait, tt.wantAllowed, tt.wantWait)
+		}
+	}
+}
+
+func TestRedis_Expiry(t *testing.T) {
+	ctx := context.Background()
+	lim := ratelimit.Limit{Rate: 1, Burst: 2}
+	now := time.Unix(1000, 0)
+
+	s, mr := newRedis(t)
+	if _, _, err := s.Take(ctx, "a", lim, now); err != nil {
+		t.Fatal(err)
+	}
+	// A bucket lives as long as it takes to refill from empty.
+	if ttl := mr.TTL("ratelimit:a"); ttl != 2*time.Second {
+		t.Errorf("TTL = %v, want 2s", ttl)
+	}
+	mr.FastForward(2 * time.Second)
+	if mr.Exists("ratelimit:a") {
+		t.Error("bucket still stored after refilling")
+	}
+}
+
+func TestRedis_Refund(t *testing.T) {
+	ctx := context.Background()
+	lim := ratelimit.Limit{Rate: 1, Burst: 2}
+	now := time.Unix(1000, 0)
+
+	s, mr := newRedis(t)
+	for range 2 {
+		if ok, _, _ := s.Take(ctx, "a", lim, now); !ok {
+			t.Fatal("Take() within burst rejected")
+		}
+	}
+	for range 3 { // refunds stop at the burst
+		if err := s.Refund(ctx, "a", lim); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Refund(ctx, "unknown", lim); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("ratelimit:unknown") {
+		t.Error("Refund() created a bucket")
+	}
+	var allowed int
+	for range 3 {
+		if ok, _, _ := s.Take(ctx, "a", lim, now); ok {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Take() allowed %d times after refunds, want 2", allowed)
+	}
+}
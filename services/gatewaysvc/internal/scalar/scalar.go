@@ -0,0 +1,140 @@
+// Package scalar holds the gqlgen marshalers for the gateway's custom
+// GraphQL scalars: DateTime, ULID and Money.
+package scalar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/oklog/ulid/v2"
+	"golang.org/x/text/currency"
+)
+
+// Error is a value a scalar does not accept. The GraphQL error presenter
+// reports it as BAD_USER_INPUT on the argument it was given for.
+type Error struct {
+	Scalar  string
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func invalid(scalar, format string, args ...any) error {
+	return &Error{Scalar: scalar, Message: fmt.Sprintf(format, args...)}
+}
+
+// MarshalDateTime writes t as an RFC3339 string in UTC, at second
+// precision like the String fields DateTime replaced.
+func MarshalDateTime(t time.Time) graphql.Marshaler {
+	return graphql.MarshalString(t.UTC().Format(time.RFC3339))
+}
+
+// UnmarshalDateTime reads an RFC3339 string, with or without fractional
+// seconds, as a time in UTC.
+func UnmarshalDateTime(v any) (time.Time, error) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, invalid("DateTime", "must be an RFC3339 string")
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, invalid("DateTime", "must be an RFC3339 date-time")
+	}
+	return t.UTC(), nil
+}
+
+// MarshalULID writes id as is. Ids stored before they were ULIDs are still
+// returned.
+func MarshalULID(id string) graphql.Marshaler {
+	return graphql.MarshalString(id)
+}
+
+// UnmarshalULID reads a ULID in either case and returns it in canonical
+// upper case, as productsvc and the gateway generate them.
+func UnmarshalULID(v any) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", invalid("ULID", "must be a ULID string")
+	}
+	id, err := ulid.ParseStrict(s)
+	if err != nil {
+		return "", invalid("ULID", "must be a ULID")
+	}
+	return id.String(), nil
+}
+
+// Money is an amount in the minor unit of an ISO 4217 currency, e.g.
+// {"amount": 1999, "currency": "USD"} for $19.99.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalGQL writes m as a JSON object.
+func (m Money) MarshalGQL(w io.Writer) {
+	b, _ := json.Marshal(m)
+	_, _ = w.Write(b)
+}
+
+// UnmarshalGQL reads an object with an integer amount and a known ISO 4217
+// currency code, in either case.
+func (m *Money) UnmarshalGQL(v any) error {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return invalid("Money", "must be an object with amount and currency")
+	}
+	for k := range obj {
+		if k != "amount" && k != "currency" {
+			return invalid("Money", "unknown field %q", k)
+		}
+	}
+
+	amount, ok := integer(obj["amount"])
+	if !ok {
+		return invalid("Money", "amount must be an integer in minor units")
+	}
+	code, _ := obj["currency"].(string)
+	cur, err := Currency(code)
+	if err != nil {
+		return err
+	}
+	*m = Money{Amount: amount, Currency: cur}
+	return nil
+}
+
+// Currency returns code as an upper-case ISO 4217 currency code, or an
+// error if it is not one.
+func Currency(code string) (string, error) {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return "", invalid("Money", "currency must be an ISO 4217 code")
+	}
+	return unit.String(), nil
+}
+
+// integer returns v as an int64 if it is a whole number. Variables arrive
+// as json.Number and literals as int64.
+func integer(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case json.Number:
+		i, err := strconv.ParseInt(string(n), 10, 64)
+		return i, err == nil
+	case float64:
+		if n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+			return 0, false
+		}
+		return int64(n), true
+	}
+	return 0, false
+}
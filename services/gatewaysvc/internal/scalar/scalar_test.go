@@ -0,0 +1,123 @@
+package scalar_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"rxw1/gatewaysvc/internal/scalar"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+func marshal(m graphql.Marshaler) string {
+	var b bytes.Buffer
+	m.MarshalGQL(&b)
+	return b.String()
+}
+
+func TestDateTime(t *testing.T) {
+	at := time.Date(2025, 3, 4, 4, 6, 7, 0, time.UTC)
+	if got, want := marshal(scalar.MarshalDateTime(at.In(time.FixedZone("CET", 3600)).Add(891*time.Millisecond))), strconv.Quote("2025-03-04T04:06:07Z"); got != want {
+		t.Errorf("MarshalDateTime() = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		in      any
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "utc", in: "2025-03-04T04:06:07Z", want: at},
+		{name: "offset", in: "2025-03-04T05:06:07+01:00", want: at},
+		{name: "fraction", in: "2025-03-04T04:06:07.5Z", want: at.Add(500 * time.Millisecond)},
+		{name: "date only", in: "2025-03-04", wantErr: true},
+		{name: "no zone", in: "2025-03-04T04:06:07", wantErr: true},
+		{name: "unix", in: int64(1741061167), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scalar.UnmarshalDateTime(tt.in)
+			if (err != nil) != tt.wantErr || err != nil && !errors.As(err, new(*scalar.Error)) {
+				t.Fatalf("UnmarshalDateTime(%v) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) || !got.IsZero() && got.Location() != time.UTC {
+				t.Errorf("UnmarshalDateTime(%v) = %v, want %v in UTC", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestULID(t *testing.T) {
+	const id = "01JQ0000000000000000000001"
+	if got := marshal(scalar.MarshalULID("legacy-id")); got != strconv.Quote("legacy-id") {
+		t.Errorf("MarshalULID(legacy-id) = %s, want it unchanged", got)
+	}
+
+	tests := []struct {
+		name    string
+		in      any
+		want    string
+		wantErr bool
+	}{
+		{name: "canonical", in: id, want: id},
+		{name: "lower case", in: "01jq0000000000000000000001", want: id},
+		{name: "too short", in: "01JQ", wantErr: true},
+		{name: "invalid character", in: "01JQ000000000000000000000U", wantErr: true},
+		{name: "overflow", in: "81JQ0000000000000000000001", wantErr: true},
+		{name: "path", in: "../etc/passwd", wantErr: true},
+		{name: "number", in: int64(1), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scalar.UnmarshalULID(tt.in)
+			if (err != nil) != tt.wantErr || err != nil && !errors.As(err, new(*scalar.Error)) {
+				t.Fatalf("UnmarshalULID(%v) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("UnmarshalULID(%v) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney(t *testing.T) {
+	if got, want := marshal(scalar.Money{Amount: 1999, Currency: "USD"}), `{"amount":1999,"currency":"USD"}`; got != want {
+		t.Errorf("MarshalGQL() = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		in      any
+		want    scalar.Money
+		wantErr bool
+	}{
+		{name: "literal", in: map[string]any{"amount": int64(1999), "currency": "USD"}, want: scalar.Money{Amount: 1999, Currency: "USD"}},
+		{name: "variable", in: map[string]any{"amount": json.Number("-250"), "currency": "eur"}, want: scalar.Money{Amount: -250, Currency: "EUR"}},
+		{name: "whole float", in: map[string]any{"amount": 100.0, "currency": "JPY"}, want: scalar.Money{Amount: 100, Currency: "JPY"}},
+		{name: "fraction", in: map[string]any{"amount": 19.99, "currency": "USD"}, wantErr: true},
+		{name: "fraction as number", in: map[string]any{"amount": json.Number("19.99"), "currency": "USD"}, wantErr: true},
+		{name: "amount as string", in: map[string]any{"amount": "1999", "currency": "USD"}, wantErr: true},
+		{name: "no amount", in: map[string]any{"currency": "USD"}, wantErr: true},
+		{name: "no currency", in: map[string]any{"amount": int64(1)}, wantErr: true},
+		{name: "unknown currency", in: map[string]any{"amount": int64(1), "currency": "ABC"}, wantErr: true},
+		{name: "symbol", in: map[string]any{"amount": int64(1), "currency": "$"}, wantErr: true},
+		{name: "extra field", in: map[string]any{"amount": int64(1), "currency": "USD", "cents": true}, wantErr: true},
+		{name: "bare number", in: int64(1999), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got scalar.Money
+			err := got.UnmarshalGQL(tt.in)
+			if (err != nil) != tt.wantErr || err != nil && !errors.As(err, new(*scalar.Error)) {
+				t.Fatalf("UnmarshalGQL(%v) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("UnmarshalGQL(%v) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -6,27 +6,18 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
-	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"rxw1/flags"
+	"rxw1/gatewaysvc/internal/auth"
 	"rxw1/gatewaysvc/internal/cache"
-	"rxw1/gatewaysvc/internal/graphql"
+	"rxw1/gatewaysvc/server"
 	"rxw1/logging"
 
-	"github.com/99designs/gqlgen/graphql/handler"
-	"github.com/99designs/gqlgen/graphql/handler/extension"
-	"github.com/99designs/gqlgen/graphql/handler/lru"
-	"github.com/99designs/gqlgen/graphql/handler/transport"
-	"github.com/99designs/gqlgen/graphql/playground"
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/cors"
-	"github.com/gorilla/websocket"
 	"github.com/nats-io/nats.go"
-	"github.com/vektah/gqlparser/v2/ast"
 )
 
 const (
@@ -36,7 +27,8 @@ const (
 
 func main() {
 	logger, err := logging.NewTint(logging.Config{
-		Service: name,
+		Service:  name,
+		Sampling: logging.DefaultSampling(),
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -51,91 +43,105 @@ func main() {
 	}
 	defer nc.Drain()
 
-	// Redis
-	rc := cache.New(os.Getenv("REDIS_ADDR"))
-
-	// Flags
-	ff := flags.New(name)
-
-	// GraphQL
-	res := &graphql.Resolver{NC: nc, RC: rc, FF: ff}
-	srv := handler.New(graphql.NewExecutableSchema(graphql.Config{Resolvers: res}))
-
-	// Websockets
-	srv.AddTransport(transport.Websocket{
-		KeepAlivePingInterval: 10 * time.Second,
-		Upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				origin := r.Header.Get("Origin")
-				if origin == "" { // no origin header, likely same-origin or non-browser
-					return true
-				}
-
-				// Allowed origins from env (comma-separated). Defaults cover local dev.
-				allowedFromEnv := strings.TrimSpace(os.Getenv("WS_ALLOWED_ORIGINS"))
-				var allowedOrigins []string
-				if allowedFromEnv != "" {
-					parts := strings.SplitSeq(allowedFromEnv, ",")
-					for p := range parts {
-						p = strings.TrimSpace(p)
-						if p != "" {
-							allowedOrigins = append(allowedOrigins, p)
-						}
-					}
-				} else {
-					allowedOrigins = []string{
-						"http://localhost:8088",
-					}
-				}
-
-				// Always allow if the Origin host matches the request host (same host/port).
-				if u, err := url.Parse(origin); err == nil {
-					if u.Host == r.Host {
-						logging.From(ctx).Warn("Allowed same-host origin", "origin", origin)
-						return true
-					}
-				}
-
-				if slices.Contains(allowedOrigins, origin) {
-					logging.From(ctx).Warn("Allowed WS origin", "origin", origin)
-					return true
-				}
-				logging.From(ctx).Warn("Blocked WS origin", "origin", origin)
-				return false
-			},
+	// Flags, with runtime overrides shared over NATS KV
+	var flagOpts []flags.Option
+	if ov, err := flags.NewOverrides(ctx, nc); err != nil {
+		logging.From(ctx).Warn("flag overrides unavailable, flags are read-only", "error", err)
+	} else {
+		flagOpts = append(flagOpts, flags.WithOverrides(ov))
+	}
+	flagOpts = append(flagOpts, flags.WithEnvironment(os.Getenv("ENVIRONMENT")))
+	ff := flags.New(name, flagOpts...)
+
+	srv, err := server.New(ctx, nc, ff, server.Config{
+		// Cache: redis (default), nats or memory
+		Cache: cache.Config{
+			Backend: cache.Backend(os.Getenv("CACHE_BACKEND")),
+			Redis:   redisConfigFromEnv(),
+			Size:    intFromEnv("CACHE_SIZE", 10000),
+		},
+		L1Size: intFromEnv("CACHE_L1_SIZE", 1000),
+		L1TTL:  durationFromEnv("CACHE_L1_TTL", 30*time.Second),
+
+		RedisRetryAfter: durationFromEnv("REDIS_RETRY_AFTER", 5*time.Second),
+		Auth: auth.Config{
+			HMACSecret: []byte(os.Getenv("AUTH_HS256_SECRET")),
+			JWKSFile:   os.Getenv("AUTH_JWKS_FILE"),
+			Issuer:     os.Getenv("AUTH_ISSUER"),
+			Audience:   os.Getenv("AUTH_AUDIENCE"),
+			Leeway:     30 * time.Second,
 		},
+		// Allowed origins from env (comma-separated). Defaults cover local dev.
+		AllowedOrigins:    listFromEnv("WS_ALLOWED_ORIGINS", "http://localhost:8088"),
+		TrustProxyHeaders: os.Getenv("TRUST_PROXY_HEADERS") == "true",
+		Introspection:     os.Getenv("GRAPHQL_INTROSPECTION") != "false",
+		MaxDepth:          intFromEnv("GRAPHQL_MAX_DEPTH", 8),
+		MaxComplexity:     intFromEnv("GRAPHQL_MAX_COMPLEXITY", 1000),
+		Currency:          os.Getenv("CURRENCY"),
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer srv.Close()
 
-	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
-
-	srv.AddTransport(transport.Options{}) // For the playground
-	srv.AddTransport(transport.GET{})
-	srv.AddTransport(transport.POST{}) // Must be after the WebSocket transport
-
-	srv.Use(extension.Introspection{}) // For running gqlgen
-	srv.Use(extension.AutomaticPersistedQuery{
-		Cache: lru.New[string](100), // From default config
-	})
+	err = http.ListenAndServe(fmt.Sprintf(":%d", port), srv)
+	if err != nil {
+		logging.From(ctx).Error("server startup failed", "port", port, "svc", name)
+		os.Exit(1)
+	}
+	logging.From(ctx).Info("server ready", "port", port, "svc", name)
+}
 
-	r := chi.NewRouter()
+// listFromEnv splits the comma-separated env var key or returns def.
+func listFromEnv(key string, def ...string) []string {
+	var origins []string
+	for p := range strings.SplitSeq(os.Getenv(key), ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			origins = append(origins, p)
+		}
+	}
+	if len(origins) == 0 {
+		return def
+	}
+	return origins
+}
 
-	// CORS
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300,
-	}))
+// intFromEnv parses the env var key as an int or returns def.
+func intFromEnv(key string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return n
+}
 
-	r.Handle("/", playground.Handler("GraphQL", "/graphql"))
-	r.Handle("/graphql", srv)
+// redisConfigFromEnv reads REDIS_URL, or REDIS_ADDR (comma-separated) with
+// the REDIS_* credentials, plus TLS, sentinel, cluster and pool settings.
+func redisConfigFromEnv() cache.RedisConfig {
+	return cache.RedisConfig{
+		URL:          os.Getenv("REDIS_URL"),
+		Addrs:        listFromEnv("REDIS_ADDR", "localhost:6379"),
+		MasterName:   os.Getenv("REDIS_MASTER_NAME"),
+		Cluster:      os.Getenv("REDIS_CLUSTER") == "true",
+		Username:     os.Getenv("REDIS_USERNAME"),
+		Password:     os.Getenv("REDIS_PASSWORD"),
+		DB:           intFromEnv("REDIS_DB", 0),
+		TLS:          os.Getenv("REDIS_TLS") == "true",
+		CAFile:       os.Getenv("REDIS_CA_FILE"),
+		ServerName:   os.Getenv("REDIS_TLS_SERVER_NAME"),
+		DialTimeout:  durationFromEnv("REDIS_DIAL_TIMEOUT", 0),
+		ReadTimeout:  durationFromEnv("REDIS_READ_TIMEOUT", 0),
+		WriteTimeout: durationFromEnv("REDIS_WRITE_TIMEOUT", 0),
+		PoolSize:     intFromEnv("REDIS_POOL_SIZE", 0),
+		MinIdleConns: intFromEnv("REDIS_MIN_IDLE_CONNS", 0),
+	}
+}
 
-	err = http.ListenAndServe(fmt.Sprintf(":%d", port), r)
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
 	if err != nil {
-		logging.From(ctx).Error("server startup failed", "port", port, "svc", name)
-		os.Exit(1)
+		return def
 	}
-	logging.From(ctx).Info("server ready", "port", port, "svc", name)
+	return d
 }
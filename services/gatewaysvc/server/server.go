@@ -0,0 +1,299 @@
+// Package server wires the gateway's caches, auth and GraphQL handler so the
+// service can run from main or in-process in integration tests.
+package server
+
+import (
+	"cmp"
+	"context"
+	"expvar"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"rxw1/chaos"
+	"rxw1/flags"
+	"rxw1/gatewaysvc/internal/auth"
+	"rxw1/gatewaysvc/internal/cache"
+	"rxw1/gatewaysvc/internal/graphql"
+	"rxw1/gatewaysvc/internal/idempotency"
+	"rxw1/gatewaysvc/internal/limits"
+	"rxw1/gatewaysvc/internal/ratelimit"
+	"rxw1/gatewaysvc/internal/scalar"
+	"rxw1/logging"
+	"rxw1/model"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const name = "gatewaysvc"
+
+// idempotencyTTL is how long the result of a keyed mutation is replayed.
+const idempotencyTTL = 24 * time.Hour
+
+// Config is the gateway's runtime configuration. main reads it from the
+// environment; tests fill it in directly.
+type Config struct {
+	Cache  cache.Config // NC defaults to the connection passed to New
+	L1Size int
+	L1TTL  time.Duration
+	Auth   auth.Config
+
+	RedisRetryAfter time.Duration // how long to skip Redis after it fails, default 5s
+
+	AllowedOrigins    []string // CORS and WS origins besides the request host
+	TrustProxyHeaders bool     // take client IPs from X-Forwarded-For
+	Introspection     bool
+	MaxDepth          int    // default 8
+	MaxComplexity     int    // default 1000
+	Currency          string // ISO 4217 code of all prices, default USD
+}
+
+// Server is the gateway's HTTP handler and the resources behind it.
+type Server struct {
+	http.Handler
+	closers []func()
+}
+
+// New builds the gateway on nc and ff. Call Close when done.
+func New(ctx context.Context, nc *nats.Conn, ff *flags.Flags, cfg Config) (*Server, error) {
+	s := &Server{}
+	done := false
+	defer func() {
+		if !done {
+			s.Close()
+		}
+	}()
+
+	// Cache: redis (default), nats or memory
+	if cfg.Cache.NC == nil {
+		cfg.Cache.NC = nc
+	}
+	// Nothing here is cached for longer than idempotency keys.
+	cfg.Cache.MaxAge = cmp.Or(cfg.Cache.MaxAge, idempotencyTTL)
+	rc, err := cache.New(cfg.Cache)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redis is optional: while it is down, cache in memory per replica.
+	// After a failure it is skipped for RedisRetryAfter, so requests do not
+	// each wait for its timeout.
+	redisCache, _ := rc.(*cache.Redis)
+	redisDown := &cache.Breaker{Cooldown: cmp.Or(cfg.RedisRetryAfter, 5*time.Second)}
+	if redisCache != nil {
+		s.closers = append(s.closers, func() { _ = redisCache.Close() })
+		pingCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		if err := redisCache.Ping(pingCtx); err != nil {
+			logging.From(ctx).Warn("redis unavailable, caching in memory until it is back", "error", err)
+		}
+		cancel()
+		rc = cache.Fallback{
+			Primary:   redisCache,
+			Secondary: cache.NewLRU(cfg.Cache.Size),
+			Breaker:   redisDown,
+			OnError: func(ctx context.Context, err error) {
+				logging.From(ctx).Warn("cache falling back to memory", "error", err)
+			},
+		}
+	}
+
+	// Products are read through a per-replica LRU unless the cache already
+	// is one; writes are broadcast so other replicas drop stale copies.
+	pc := rc
+	var l1 *cache.Tiered
+	if _, ok := rc.(*cache.LRU); !ok {
+		l1, err = cache.NewTiered(nc, rc, cfg.L1Size, cfg.L1TTL)
+		if err != nil {
+			return nil, err
+		}
+		s.closers = append(s.closers, func() { _ = l1.Close() })
+		pc = l1
+	}
+
+	// Auth
+	av, err := auth.NewVerifier(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	if !av.Enabled() {
+		logging.From(ctx).Warn("no auth keys configured, all requests are anonymous")
+	}
+
+	allowedOrigins := cfg.AllowedOrigins
+
+	currency, err := scalar.Currency(cmp.Or(cfg.Currency, "USD"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Idempotency keys must be seen by every replica, so they stay on Redis
+	// and keyed mutations fail while it is down instead of running twice.
+	var keys cache.Cache = rc
+	if redisCache != nil {
+		keys = redisCache
+	}
+
+	// GraphQL
+	res := &graphql.Resolver{
+		NC: nc,
+		PC: &cache.Loader{
+			Cache:   pc,
+			TTL:     5 * time.Minute,
+			Stale:   time.Minute,
+			MissTTL: 10 * time.Second,
+			Jitter:  0.1,
+		},
+		FF: ff,
+		IK: &idempotency.Store{KV: keys, TTL: idempotencyTTL},
+		CH: chaos.New(name, func(ctx context.Context) chaos.Config {
+			return flags.Object[chaos.Config](ctx, ff, flags.Chaos, nil)
+		}),
+		Currency: currency,
+	}
+	gcfg := graphql.Config{Resolvers: res, Complexity: graphql.Complexity()}
+	gcfg.Directives.HasRole = graphql.HasRole
+	srv := handler.New(graphql.NewExecutableSchema(gcfg))
+	srv.SetErrorPresenter(graphql.ErrorPresenter)
+	srv.SetRecoverFunc(graphql.Recover)
+
+	// Websockets
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		// Browsers cannot set headers on the upgrade request, so the token
+		// travels in the connection_init payload.
+		InitFunc: func(ctx context.Context, p transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+			ctx, err := av.Authenticate(ctx, p.Authorization())
+			if err != nil {
+				logging.From(ctx).Warn("rejected WS token", "error", err)
+				return ctx, nil, err
+			}
+			return flagTarget(ctx), &p, nil
+		},
+		Upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				if origin == "" { // no origin header, likely same-origin or non-browser
+					return true
+				}
+
+				// Always allow if the Origin host matches the request host (same host/port).
+				if u, err := url.Parse(origin); err == nil {
+					if u.Host == r.Host {
+						logging.From(ctx).Warn("Allowed same-host origin", "origin", origin)
+						return true
+					}
+				}
+
+				if slices.Contains(allowedOrigins, origin) {
+					logging.From(ctx).Warn("Allowed WS origin", "origin", origin)
+					return true
+				}
+				logging.From(ctx).Warn("Blocked WS origin", "origin", origin)
+				return false
+			},
+		},
+	})
+
+	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+
+	srv.AddTransport(transport.Options{}) // For the playground
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{}) // Must be after the WebSocket transport
+
+	if cfg.Introspection {
+		srv.Use(extension.Introspection{}) // For running gqlgen
+	}
+	srv.Use(limits.DepthLimit{Max: cmp.Or(cfg.MaxDepth, 8)})
+	srv.Use(limits.NewComplexityLimit(cmp.Or(cfg.MaxComplexity, 1000)))
+	// Buckets are shared through Redis when it is the cache, else per replica.
+	var buckets ratelimit.Store = ratelimit.NewMemory()
+	if redisCache != nil {
+		buckets = ratelimit.Fallback{
+			Primary:   ratelimit.Redis{R: redisCache.R},
+			Secondary: buckets,
+			Breaker:   redisDown,
+			OnError: func(ctx context.Context, err error) {
+				logging.From(ctx).Warn("rate limit falling back to memory", "error", err)
+			},
+		}
+	}
+	srv.Use(ratelimit.Limiter{
+		Store: buckets,
+		Limits: func(ctx context.Context) map[string]ratelimit.Limit {
+			lims := map[string]ratelimit.Limit{}
+			for field, l := range ff.RateLimits(ctx) {
+				lims[field] = ratelimit.Limit{Rate: float64(l.PerMinute) / 60, Burst: l.Burst}
+			}
+			return lims
+		},
+	})
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New[string](100), // From default config
+	})
+
+	r := chi.NewRouter()
+
+	// Client IPs for rate limiting. Only trust X-Forwarded-For behind a proxy.
+	if cfg.TrustProxyHeaders {
+		r.Use(middleware.RealIP)
+	}
+	r.Use(ratelimit.ClientIP)
+	r.Use(middleware.RequestID)
+
+	// CORS
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   allowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Idempotency-Key", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: false,
+		MaxAge:           300,
+	}))
+
+	r.Handle("/", playground.Handler("GraphQL", "/graphql"))
+	r.With(auth.Middleware(av), flagTargeting, idempotency.Header).Handle("/graphql", srv)
+	admin := r.With(auth.Middleware(av), auth.RequireRole(model.RoleAdmin.String()))
+	admin.Handle("/debug/vars", expvar.Handler())
+	if l1 != nil {
+		admin.Handle("/debug/cache", l1)
+	}
+
+	s.Handler = r
+	done = true
+	return s, nil
+}
+
+// Close releases the caches, most recently opened first.
+func (s *Server) Close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+}
+
+// flagTarget scopes flag evaluations under ctx to its user and request.
+func flagTarget(ctx context.Context) context.Context {
+	if id := middleware.GetReqID(ctx); id != "" {
+		ctx = flags.WithRequestID(ctx, id)
+	}
+	if u, ok := auth.UserFrom(ctx); ok {
+		ctx = flags.WithUserID(ctx, u.ID)
+	}
+	return ctx
+}
+
+func flagTargeting(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(flagTarget(r.Context())))
+	})
+}
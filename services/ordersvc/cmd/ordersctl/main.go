@@ -0,0 +1,251 @@
+// Command ordersctl runs maintenance tasks against ordersvc's MongoDB.
+//
+//	ordersctl rebuild   recompute every document in the orders collection
+//	                    from the order's history in order_events
+//	ordersctl replay    run past order.* events, from the ORDERS stream or
+//	                    an NDJSON file, through the handlers again
+//	ordersctl export    write the ORDERS stream to stdout as NDJSON
+//
+// It connects the way ordersvc does, from MONGO_URI, MONGO_DATABASE,
+// MONGO_COLLECTION, MONGO_EVENTS_COLLECTION and NATS_URL. In the cluster it
+// ships in the ordersvc image: kubectl exec deploy/ordersvc -- /ordersctl
+// rebuild. Run ordersctl <command> -h for a command's flags.
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"rxw1/ordersvc/internal/db"
+	"rxw1/ordersvc/internal/handle"
+	"rxw1/ordersvc/internal/replay"
+
+	"github.com/nats-io/nats.go"
+)
+
+func main() {
+	timeout := flag.Duration("timeout", 5*time.Minute, "give up after this long")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: ordersctl [-timeout d] rebuild | replay [flags] | export [flags]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "rebuild":
+		err = rebuild(ctx)
+	case "replay":
+		err = replayCmd(ctx, args)
+	case "export":
+		err = export(ctx, args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// connect opens the Store, with collection and events overriding
+// MONGO_COLLECTION and MONGO_EVENTS_COLLECTION when set.
+func connect(ctx context.Context, collection, events string) (*db.Store, func(), error) {
+	s, err := db.Connect(ctx, db.Config{
+		URI:        os.Getenv("MONGO_URI"),
+		Database:   os.Getenv("MONGO_DATABASE"),
+		Collection: cmp.Or(collection, os.Getenv("MONGO_COLLECTION")),
+		Events:     cmp.Or(events, os.Getenv("MONGO_EVENTS_COLLECTION")),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, func() { _ = s.C.Database().Client().Disconnect(context.WithoutCancel(ctx)) }, nil
+}
+
+// rebuild folds every order projection again from the events and swaps
+// them in at once.
+func rebuild(ctx context.Context) error {
+	s, disconnect, err := connect(ctx, "", "")
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	if err := s.EnsureSchema(ctx); err != nil {
+		return err
+	}
+	n, err := s.Rebuild(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rebuilt %d orders from %s\n", n, s.Events.Name())
+	return nil
+}
+
+// sourceFlags are the flags replay and export share to pick events.
+type sourceFlags struct {
+	stream       string
+	since, until string
+}
+
+func (sf *sourceFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&sf.stream, "stream", handle.Stream, "JetStream stream to read, at NATS_URL")
+	fs.StringVar(&sf.since, "since", "", "only events published at or after this RFC3339 time")
+	fs.StringVar(&sf.until, "until", "", "only events published before this RFC3339 time")
+}
+
+func (sf *sourceFlags) filter() (replay.Filter, error) {
+	var f replay.Filter
+	for _, b := range []struct {
+		name string
+		s    string
+		t    *time.Time
+	}{{"since", sf.since, &f.Since}, {"until", sf.until, &f.Until}} {
+		if b.s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, b.s)
+		if err != nil {
+			return replay.Filter{}, fmt.Errorf("-%s: %w", b.name, err)
+		}
+		*b.t = t
+	}
+	return f, nil
+}
+
+// openStream reads sf.stream from since on. The returned func closes the
+// consumer and the connection.
+func (sf *sourceFlags) openStream(since time.Time) (replay.Source, func(), error) {
+	nc, err := nats.Connect(cmp.Or(os.Getenv("NATS_URL"), nats.DefaultURL))
+	if err != nil {
+		return nil, nil, err
+	}
+	src, err := replay.JetStream(nc, sf.stream, since)
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+	return src, func() { _ = src.Close(); nc.Close() }, nil
+}
+
+// replayCmd applies past events with handle.Handle. Events already stored
+// are recognised by eventId and left alone, so replaying a range twice, or
+// one that overlaps what ordersvc handled live, changes nothing.
+func replayCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var sf sourceFlags
+	sf.register(fs)
+	file := fs.String("file", "", "read this NDJSON export, - for stdin, instead of the stream")
+	dryRun := fs.Bool("dry-run", false, "read MongoDB without writing and report the events that would be appended")
+	collection := fs.String("collection", "", "orders collection to write (default MONGO_COLLECTION)")
+	events := fs.String("events", "", "events collection to write (default MONGO_EVENTS_COLLECTION)")
+	_ = fs.Parse(args)
+
+	f, err := sf.filter()
+	if err != nil {
+		return err
+	}
+
+	var src replay.Source
+	switch *file {
+	case "":
+		var closeSrc func()
+		if src, closeSrc, err = sf.openStream(f.Since); err != nil {
+			return err
+		}
+		defer closeSrc()
+	case "-":
+		src = replay.NDJSON(os.Stdin)
+	default:
+		r, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		src = replay.NDJSON(r)
+	}
+
+	s, disconnect, err := connect(ctx, *collection, *events)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+	var (
+		repo   db.OrderRepository = s
+		dry    *db.DryRun
+		target = s.C.Name() + " and " + s.Events.Name()
+	)
+	if *dryRun {
+		dry = db.NewDryRun(s)
+		repo, target = dry, target+" (dry run)"
+	} else if err := s.EnsureSchema(ctx); err != nil {
+		return err
+	}
+
+	st, err := replay.Run(ctx, src, f, func(ctx context.Context, r replay.Record) error {
+		err := handle.Handle(ctx, repo, r.Subject, r.Data)
+		if errors.Is(err, handle.ErrUnknownSubject) {
+			return fmt.Errorf("%w: %w", replay.ErrSkip, err)
+		}
+		return err
+	})
+	fmt.Printf("replayed into %s: read %d, skipped %d, applied %d, failed %d\n", target, st.Read, st.Skipped, st.Applied, st.Failed)
+	if dry != nil {
+		changes := dry.Changes()
+		for _, e := range changes {
+			fmt.Printf("would append %s %s to order %s at seq %d\n", e.Type, e.EventID, e.OrderID, e.Seq)
+		}
+		fmt.Printf("would append %d events\n", len(changes))
+	}
+	if err != nil {
+		return err
+	}
+	if st.Failed > 0 {
+		return fmt.Errorf("%d events failed", st.Failed)
+	}
+	return nil
+}
+
+// export writes the stream as NDJSON for replay -file, e.g. to replay it
+// somewhere without access to NATS or after the stream's max age.
+func export(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var sf sourceFlags
+	sf.register(fs)
+	_ = fs.Parse(args)
+
+	f, err := sf.filter()
+	if err != nil {
+		return err
+	}
+	src, closeSrc, err := sf.openStream(f.Since)
+	if err != nil {
+		return err
+	}
+	defer closeSrc()
+
+	st, err := replay.Run(ctx, src, f, replay.NDJSONWriter(os.Stdout))
+	fmt.Fprintf(os.Stderr, "exported %d of %d events\n", st.Applied, st.Read)
+	if err != nil {
+		return err
+	}
+	if st.Failed > 0 {
+		return io.ErrShortWrite
+	}
+	return nil
+}
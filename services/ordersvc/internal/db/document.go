@@ -0,0 +1,167 @@
+package db
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"rxw1/model"
+)
+
+// MaxItems bounds the items of an order.
+const MaxItems = 20
+
+// ErrInvalidOrder is returned by AddOrder for items that fail ValidateItems.
+var ErrInvalidOrder = errors.New("db: invalid order")
+
+// Item is one line of an order: a product at the name and unit price it had
+// when the order was placed. Price is nil for orders placed before prices
+// were recorded.
+type Item struct {
+	ProductID string `bson:"productId"`
+	Name      string `bson:"name"`
+	Price     *int32 `bson:"price,omitempty"`
+	Qty       int32  `bson:"qty"`
+}
+
+// ValidateItems checks that an order has 1 to MaxItems items, each for a
+// different product with a positive qty and, if it has one, a price of at
+// least 0, and that its total fits an int32.
+func ValidateItems(items []Item) error {
+	if len(items) == 0 || len(items) > MaxItems {
+		return fmt.Errorf("%w: %d items, want 1 to %d", ErrInvalidOrder, len(items), MaxItems)
+	}
+	seen := make(map[string]bool, len(items))
+	var total int64
+	for i, it := range items {
+		switch {
+		case it.ProductID == "":
+			return fmt.Errorf("%w: item %d has no product", ErrInvalidOrder, i)
+		case seen[it.ProductID]:
+			return fmt.Errorf("%w: product %s is listed twice", ErrInvalidOrder, it.ProductID)
+		case it.Qty <= 0:
+			return fmt.Errorf("%w: item %d has qty %d", ErrInvalidOrder, i, it.Qty)
+		case it.Price != nil && *it.Price < 0:
+			return fmt.Errorf("%w: item %d has price %d", ErrInvalidOrder, i, *it.Price)
+		}
+		seen[it.ProductID] = true
+		if it.Price == nil {
+			continue
+		}
+		if total += int64(*it.Price) * int64(it.Qty); total > math.MaxInt32 {
+			return fmt.Errorf("%w: total exceeds %d", ErrInvalidOrder, math.MaxInt32)
+		}
+	}
+	return nil
+}
+
+// total returns the sum of the items' subtotals, or nil if an item has no
+// price. items must pass ValidateItems.
+func total(items []Item) *int32 {
+	var t int32
+	for _, it := range items {
+		if it.Price == nil {
+			return nil
+		}
+		t += *it.Price * it.Qty
+	}
+	return &t
+}
+
+// times returns price * qty, or nil if the price is unknown.
+func times(price *int32, qty int32) *int32 {
+	if price == nil {
+		return nil
+	}
+	t := *price * qty
+	return &t
+}
+
+// Model maps it to the GraphQL model.
+func (it Item) Model() *model.OrderItem {
+	return &model.OrderItem{
+		ProductID: it.ProductID,
+		Name:      it.Name,
+		Price:     it.Price,
+		Qty:       it.Qty,
+		Subtotal:  times(it.Price, it.Qty),
+	}
+}
+
+// OrderDoc is an order as stored in Mongo. Its bson keys are the ones
+// OrderValidator and OrderIndexes refer to; model.Order only has json tags,
+// so the driver would read it under lowercased keys such as "productid".
+// Model also fills in what is not stored: the Subtotal of each item, and the
+// items and total of orders written before Items existed.
+//
+// ProductID, Qty and Price repeat the first item, for readers that predate
+// Items. Price and Total are absent while a price is unknown.
+type OrderDoc struct {
+	ID             string    `bson:"id"`
+	EventID        string    `bson:"eventId"`
+	IdempotencyKey string    `bson:"idempotencyKey"`
+	ProductID      string    `bson:"productId"`
+	UserID         string    `bson:"userId"`
+	Qty            int32     `bson:"qty"`
+	CreatedAt      time.Time `bson:"createdAt"`
+	Status         string    `bson:"status"`
+	Price          *int32    `bson:"price,omitempty"`
+	Items          []Item    `bson:"items"`
+	Total          *int32    `bson:"total,omitempty"`
+	Version        int64     `bson:"version"` // Seq of the last event applied
+}
+
+// NewOrderDoc returns the new order orderID of items, which must pass
+// ValidateItems, with its total. createdAt is kept in UTC at millisecond
+// precision, which is what a BSON date holds.
+//
+// orderID is the id the gateway returned to the client and published in
+// order.created, so replaying that event gives the order the same id.
+func NewOrderDoc(orderID, eventID, idempotencyKey, userID string, items []Item, createdAt time.Time) OrderDoc {
+	createdAt = createdAt.UTC().Truncate(time.Millisecond)
+	return OrderDoc{
+		ID:             orderID,
+		EventID:        eventID,
+		IdempotencyKey: idempotencyKey,
+		ProductID:      items[0].ProductID,
+		UserID:         userID,
+		Qty:            items[0].Qty,
+		CreatedAt:      createdAt,
+		Status:         StatusCreated,
+		Price:          items[0].Price,
+		Items:          items,
+		Total:          total(items),
+		Version:        1,
+	}
+}
+
+// Model maps d to the GraphQL model. CreatedAt is in UTC, or zero for
+// documents stored without one; documents stored without a status are
+// CREATED, and those stored without items have the one item ProductID, Qty
+// and Price describe.
+func (d OrderDoc) Model() model.Order {
+	o := model.Order{
+		ID:        d.ID,
+		EventID:   d.EventID,
+		ProductID: d.ProductID,
+		UserID:    d.UserID,
+		Qty:       d.Qty,
+		Price:     d.Price,
+		Status:    model.OrderStatus(cmp.Or(d.Status, StatusCreated)),
+		Items:     []*model.OrderItem{},
+		CreatedAt: d.CreatedAt.UTC(),
+		Total:     d.Total,
+	}
+
+	items := d.Items
+	if len(items) == 0 && d.ProductID != "" {
+		items = []Item{{ProductID: d.ProductID, Price: d.Price, Qty: d.Qty}}
+		o.Total = times(d.Price, d.Qty)
+	}
+	for _, it := range items {
+		o.Items = append(o.Items, it.Model())
+	}
+	return o
+}
@@ -0,0 +1,155 @@
+package db_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"rxw1/model"
+	"rxw1/ordersvc/internal/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestOrderDoc_RoundTrip(t *testing.T) {
+	at := time.Date(2025, 3, 4, 5, 6, 7, 891234567, time.FixedZone("CET", 3600))
+	items := []db.Item{{ProductID: "p1", Name: "Widget", Price: ptr[int32](250), Qty: 3}, {ProductID: "p2", Name: "Gadget", Price: ptr[int32](100), Qty: 1}}
+	d := db.NewOrderDoc("o1", "ev1", "k1", "u1", items, at)
+
+	raw, err := bson.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stored keys are the ones the validator and indexes expect.
+	props := db.OrderValidator["$jsonSchema"].(bson.M)["properties"].(bson.M)
+	elems, err := bson.Raw(raw).Elements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range elems {
+		if _, ok := props[e.Key()]; !ok {
+			t.Errorf("key %q not in OrderValidator", e.Key())
+		}
+	}
+	if typ := bson.Raw(raw).Lookup("createdAt").Type; typ != bson.TypeDateTime {
+		t.Errorf("createdAt stored as %v, want date", typ)
+	}
+
+	var back db.OrderDoc
+	if err := bson.Unmarshal(raw, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, d) {
+		t.Errorf("round trip = %+v, want %+v", back, d)
+	}
+
+	want := model.Order{
+		ID:        "o1",
+		EventID:   "ev1",
+		ProductID: "p1",
+		UserID:    "u1",
+		Qty:       3,
+		Price:     ptr[int32](250),
+		CreatedAt: time.Date(2025, 3, 4, 4, 6, 7, 891000000, time.UTC),
+		Status:    model.OrderStatusCreated,
+		Items: []*model.OrderItem{
+			{ProductID: "p1", Name: "Widget", Price: ptr[int32](250), Qty: 3, Subtotal: ptr[int32](750)},
+			{ProductID: "p2", Name: "Gadget", Price: ptr[int32](100), Qty: 1, Subtotal: ptr[int32](100)},
+		},
+		Total: ptr[int32](850),
+	}
+	if got := back.Model(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Model() = %+v, want %+v", got, want)
+	}
+}
+
+func TestOrderDoc_Decode(t *testing.T) {
+	at := time.Date(2025, 3, 4, 4, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		doc  bson.M
+		want model.Order
+	}{
+		{
+			name: "current",
+			doc: bson.M{"id": "o1", "eventId": "ev1", "idempotencyKey": "", "productId": "p1", "userId": "u1",
+				"qty": int32(2), "createdAt": at, "status": db.StatusCanceled, "price": int32(500), "version": int64(2),
+				"items": bson.A{bson.M{"productId": "p1", "name": "Widget", "price": int32(500), "qty": int32(2)}}, "total": int32(1000)},
+			want: model.Order{ID: "o1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, Price: ptr[int32](500), CreatedAt: at, Status: model.OrderStatusCanceled,
+				Items: []*model.OrderItem{{ProductID: "p1", Name: "Widget", Price: ptr[int32](500), Qty: 2, Subtotal: ptr[int32](1000)}}, Total: ptr[int32](1000)},
+		},
+		{
+			name: "before migration 000003",
+			doc: bson.M{"id": "o1", "eventId": "ev1", "productId": "p1", "userId": "u1",
+				"qty": int32(2), "createdAt": at, "status": db.StatusCreated, "price": int32(500), "version": int64(1)},
+			want: model.Order{ID: "o1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, Price: ptr[int32](500), CreatedAt: at, Status: model.OrderStatusCreated,
+				Items: []*model.OrderItem{{ProductID: "p1", Price: ptr[int32](500), Qty: 2, Subtotal: ptr[int32](1000)}}, Total: ptr[int32](1000)},
+		},
+		{
+			name: "before migration 000001, qty as long",
+			doc:  bson.M{"id": "o1", "eventId": "ev1", "productId": "p1", "userId": "u1", "qty": int64(2), "createdAt": at},
+			want: model.Order{ID: "o1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, CreatedAt: at, Status: model.OrderStatusCreated,
+				Items: []*model.OrderItem{{ProductID: "p1", Qty: 2}}},
+		},
+		{
+			name: "no createdAt",
+			doc:  bson.M{"id": "o1", "eventId": "ev1", "qty": int32(1)},
+			want: model.Order{ID: "o1", EventID: "ev1", Qty: 1, Status: model.OrderStatusCreated, Items: []*model.OrderItem{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := bson.Marshal(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var d db.OrderDoc
+			if err := bson.Unmarshal(raw, &d); err != nil {
+				t.Fatal(err)
+			}
+			if got := d.Model(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Model() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateItems(t *testing.T) {
+	item := func(productID string, price, qty int32) db.Item {
+		return db.Item{ProductID: productID, Price: &price, Qty: qty}
+	}
+	many := make([]db.Item, db.MaxItems+1)
+	for i := range many {
+		many[i] = item(string(rune('a'+i)), 1, 1)
+	}
+
+	tests := []struct {
+		name    string
+		items   []db.Item
+		wantErr bool
+	}{
+		{name: "one", items: []db.Item{item("p1", 100, 1)}},
+		{name: "several", items: []db.Item{item("p1", 100, 1), item("p2", 0, 3)}},
+		{name: "unknown price", items: []db.Item{{ProductID: "p1", Qty: 2}}},
+		{name: "max", items: many[:db.MaxItems]},
+		{name: "none", wantErr: true},
+		{name: "too many", items: many, wantErr: true},
+		{name: "zero qty", items: []db.Item{item("p1", 100, 0)}, wantErr: true},
+		{name: "negative qty", items: []db.Item{item("p1", 100, -1)}, wantErr: true},
+		{name: "negative price", items: []db.Item{item("p1", -1, 1)}, wantErr: true},
+		{name: "no product", items: []db.Item{item("", 100, 1)}, wantErr: true},
+		{name: "duplicate product", items: []db.Item{item("p1", 100, 1), item("p1", 100, 2)}, wantErr: true},
+		{name: "total overflows", items: []db.Item{item("p1", 1<<30, 2)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.ValidateItems(tt.items)
+			if (err != nil) != tt.wantErr || err != nil && !errors.Is(err, db.ErrInvalidOrder) {
+				t.Errorf("ValidateItems() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"rxw1/model"
+)
+
+// ErrDryRun is returned by the DryRun methods that have no dry form.
+var ErrDryRun = errors.New("db: not supported in a dry run")
+
+// readOnly is the repository a DryRun reads: Store or Memory.
+type readOnly interface {
+	OrderRepository
+	// owner returns the id of the order that has the event eventID, or the
+	// user's idempotency key when one is set, or "" if none has.
+	owner(ctx context.Context, eventID, idempotencyKey, userID string) (string, error)
+}
+
+// DryRun is an OrderRepository that reads another one and keeps what it
+// would write in memory, so ordersctl replay -dry-run can report what events
+// would change in MongoDB without writing to it. The history of an order is
+// copied from the base the first time it is touched; events and idempotency
+// keys the base already has are ignored, as the base itself would.
+type DryRun struct {
+	base readOnly
+	mem  *Memory
+
+	mu      sync.Mutex
+	loaded  map[string]bool
+	changes []OrderEvent
+}
+
+// NewDryRun returns a DryRun over base, with nothing written yet.
+func NewDryRun(base readOnly) *DryRun {
+	return &DryRun{base: base, mem: NewMemory(), loaded: map[string]bool{}}
+}
+
+// Changes returns the events the DryRun would have appended, in order.
+func (d *DryRun) Changes() []OrderEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.changes)
+}
+
+func (d *DryRun) AddOrder(ctx context.Context, orderID, eventID, idempotencyKey, userID string, items []Item, createdAt time.Time) error {
+	if err := ValidateItems(items); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if stored, err := d.base.owner(ctx, eventID, idempotencyKey, userID); err != nil || stored != "" {
+		return err
+	}
+	if err := d.load(ctx, orderID); err != nil {
+		return err
+	}
+	return d.record(func() error {
+		return d.mem.AddOrder(ctx, orderID, eventID, idempotencyKey, userID, items, createdAt)
+	})
+}
+
+func (d *DryRun) AppendEvent(ctx context.Context, e OrderEvent) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if stored, err := d.base.owner(ctx, e.EventID, "", ""); err != nil || stored != "" {
+		return err
+	}
+	if err := d.load(ctx, e.OrderID); err != nil {
+		return err
+	}
+	return d.record(func() error { return d.mem.AppendEvent(ctx, e) })
+}
+
+// GetAllOrders returns the base's orders with the ones the DryRun changed
+// replaced, and the ones it added last.
+func (d *DryRun) GetAllOrders(ctx context.Context) ([]model.Order, error) {
+	orders, err := d.base.GetAllOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := d.mem.GetAllOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range changed {
+		if i := slices.IndexFunc(orders, func(b model.Order) bool { return b.ID == o.ID }); i >= 0 {
+			orders[i] = o
+		} else {
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
+}
+
+func (d *DryRun) GetOrder(ctx context.Context, id string) (*model.Order, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.load(ctx, id); err != nil {
+		return nil, err
+	}
+	return d.mem.GetOrder(ctx, id)
+}
+
+func (d *DryRun) GetHistory(ctx context.Context, orderID string) ([]OrderEvent, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.load(ctx, orderID); err != nil {
+		return nil, err
+	}
+	return d.mem.GetHistory(ctx, orderID)
+}
+
+func (d *DryRun) Rebuild(context.Context) (int, error) {
+	return 0, ErrDryRun
+}
+
+// load copies the history of orderID from the base, once.
+func (d *DryRun) load(ctx context.Context, orderID string) error {
+	if d.loaded[orderID] {
+		return nil
+	}
+	events, err := d.base.GetHistory(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	d.mem.mu.Lock()
+	defer d.mem.mu.Unlock()
+	d.loaded[orderID] = true
+	if len(events) == 0 {
+		return nil
+	}
+	d.mem.events = append(d.mem.events, events...)
+	return d.mem.project(orderID)
+}
+
+// record runs write against the in-memory copy and keeps the event it
+// appended, if any.
+func (d *DryRun) record(write func() error) error {
+	n := len(d.mem.events)
+	if err := write(); err != nil {
+		return err
+	}
+	d.changes = append(d.changes, d.mem.events[n:]...)
+	return nil
+}
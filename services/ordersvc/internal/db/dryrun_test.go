@@ -0,0 +1,85 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"rxw1/model"
+	"rxw1/ordersvc/internal/db"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	at := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	item := []db.Item{{ProductID: "p1", Qty: 1}}
+
+	base := db.NewMemory()
+	if err := base.AddOrder(ctx, "o1", "ev1", "k1", "u1", item, at); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.AddOrder(ctx, "o2", "ev2", "", "u1", item, at); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.AppendEvent(ctx, db.OrderEvent{OrderID: "o2", Type: db.EventCanceled, EventID: "ev3", At: at}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := db.NewDryRun(base)
+	writes := []struct {
+		name    string
+		write   func() error
+		wantErr error
+	}{
+		{name: "stored order", write: func() error { return d.AddOrder(ctx, "o1", "ev1", "k1", "u1", item, at) }},
+		{name: "stored event id", write: func() error { return d.AddOrder(ctx, "o9", "ev1", "", "u1", item, at) }},
+		{name: "stored idempotency key", write: func() error { return d.AddOrder(ctx, "o9", "ev9", "k1", "u1", item, at) }},
+		{name: "stored transition", write: func() error {
+			return d.AppendEvent(ctx, db.OrderEvent{OrderID: "o2", Type: db.EventCanceled, EventID: "ev3", At: at})
+		}},
+		{name: "new order", write: func() error { return d.AddOrder(ctx, "o3", "ev4", "", "u2", item, at) }},
+		{name: "new transition", write: func() error {
+			return d.AppendEvent(ctx, db.OrderEvent{OrderID: "o1", Type: db.EventConfirmed, EventID: "ev5", At: at})
+		}},
+		{name: "new transition redelivered", write: func() error {
+			return d.AppendEvent(ctx, db.OrderEvent{OrderID: "o1", Type: db.EventConfirmed, EventID: "ev5", At: at})
+		}},
+		{name: "invalid transition", write: func() error {
+			return d.AppendEvent(ctx, db.OrderEvent{OrderID: "o2", Type: db.EventConfirmed, EventID: "ev6", At: at})
+		}, wantErr: db.ErrInvalidTransition},
+		{name: "unknown order", write: func() error {
+			return d.AppendEvent(ctx, db.OrderEvent{OrderID: "o9", Type: db.EventCanceled, EventID: "ev7", At: at})
+		}, wantErr: db.ErrOrderNotFound},
+	}
+	for _, w := range writes {
+		if err := w.write(); !errors.Is(err, w.wantErr) {
+			t.Errorf("%s: %v, want %v", w.name, err, w.wantErr)
+		}
+	}
+
+	var got []string
+	for _, e := range d.Changes() {
+		got = append(got, fmt.Sprintf("%s %d %s %s", e.OrderID, e.Seq, e.Type, e.EventID))
+	}
+	if want := []string{"o3 1 CREATED ev4", "o1 2 CONFIRMED ev5"}; !slices.Equal(got, want) {
+		t.Errorf("Changes() = %q, want %q", got, want)
+	}
+
+	if o, err := d.GetOrder(ctx, "o1"); err != nil || o == nil || o.Status != model.OrderStatusConfirmed {
+		t.Errorf("GetOrder(o1) = %+v, %v, want it CONFIRMED", o, err)
+	}
+	if orders, err := d.GetAllOrders(ctx); err != nil || len(orders) != 3 {
+		t.Errorf("GetAllOrders() = %+v, %v, want 3 orders", orders, err)
+	}
+
+	// The base is left as it was.
+	if orders, _ := base.GetAllOrders(ctx); len(orders) != 2 || orders[0].Status != model.OrderStatusCreated {
+		t.Errorf("base orders = %+v, want o1 CREATED and o2", orders)
+	}
+	if _, err := d.Rebuild(ctx); !errors.Is(err, db.ErrDryRun) {
+		t.Errorf("Rebuild() = %v, want %v", err, db.ErrDryRun)
+	}
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"rxw1/model"
+)
+
+// Event types, which are also the status an order has after the event.
+const (
+	EventCreated   = StatusCreated
+	EventConfirmed = StatusConfirmed
+	EventRejected  = StatusRejected
+	EventCanceled  = StatusCanceled
+)
+
+var (
+	// ErrOrderNotFound is returned when an event is appended to an order
+	// that was never created.
+	ErrOrderNotFound = errors.New("db: order not found")
+	// ErrInvalidTransition is returned when an event does not apply to the
+	// order's current status, e.g. confirming a canceled order.
+	ErrInvalidTransition = errors.New("db: invalid order transition")
+)
+
+// transitions lists the event types each status accepts. CANCELED and
+// REJECTED are final.
+var transitions = map[string][]string{
+	"":              {EventCreated},
+	StatusCreated:   {EventConfirmed, EventRejected, EventCanceled},
+	StatusConfirmed: {EventCanceled},
+}
+
+// OrderEvent is one entry of an order's history in the order_events
+// collection, keyed by OrderID and Seq. Only the CREATED event, always
+// Seq 1, carries the order's fields; later events carry a Reason at most.
+// Items and Total are absent from CREATED events stored before orders had
+// items, until migration 000003 backfills them.
+type OrderEvent struct {
+	OrderID string    `bson:"orderId"`
+	Seq     int64     `bson:"seq"`
+	Type    string    `bson:"type"`
+	EventID string    `bson:"eventId"`
+	At      time.Time `bson:"at"`
+	Reason  string    `bson:"reason,omitempty"`
+
+	IdempotencyKey string `bson:"idempotencyKey,omitempty"`
+	ProductID      string `bson:"productId,omitempty"`
+	UserID         string `bson:"userId,omitempty"`
+	Qty            int32  `bson:"qty,omitempty"`
+	Price          *int32 `bson:"price,omitempty"`
+	Items          []Item `bson:"items,omitempty"`
+	Total          *int32 `bson:"total,omitempty"`
+}
+
+// Created returns the CREATED event of d, from which Project rebuilds d.
+func (d OrderDoc) Created() OrderEvent {
+	return OrderEvent{
+		OrderID:        d.ID,
+		Seq:            1,
+		Type:           EventCreated,
+		EventID:        d.EventID,
+		At:             d.CreatedAt,
+		IdempotencyKey: d.IdempotencyKey,
+		ProductID:      d.ProductID,
+		UserID:         d.UserID,
+		Qty:            d.Qty,
+		Price:          d.Price,
+		Items:          d.Items,
+		Total:          d.Total,
+	}
+}
+
+// Project folds an order's events, in Seq order, into its projection in
+// the orders collection.
+func Project(events []OrderEvent) (OrderDoc, error) {
+	var d OrderDoc
+	for i, e := range events {
+		if e.Seq != int64(i+1) {
+			return OrderDoc{}, fmt.Errorf("db: order %s: event %d has seq %d", e.OrderID, i+1, e.Seq)
+		}
+		if err := d.apply(e); err != nil {
+			return OrderDoc{}, err
+		}
+	}
+	return d, nil
+}
+
+// next returns e as the event that follows history: at the next Seq, if the
+// order's current status accepts it.
+func next(history []OrderEvent, e OrderEvent) (OrderEvent, error) {
+	if len(history) == 0 {
+		return OrderEvent{}, fmt.Errorf("%w: %s", ErrOrderNotFound, e.OrderID)
+	}
+	d, err := Project(history)
+	if err != nil {
+		return OrderEvent{}, err
+	}
+	e.Seq = d.Version + 1
+	e.At = e.At.UTC().Truncate(time.Millisecond)
+	if err := d.apply(e); err != nil {
+		return OrderEvent{}, err
+	}
+	return e, nil
+}
+
+// apply moves d to the status of e, or fails if d's status does not accept e.
+func (d *OrderDoc) apply(e OrderEvent) error {
+	if !slices.Contains(transitions[d.Status], e.Type) {
+		return fmt.Errorf("%w: %s order %s cannot be %s", ErrInvalidTransition, d.Status, e.OrderID, e.Type)
+	}
+	if e.Type == EventCreated {
+		*d = OrderDoc{
+			ID:             e.OrderID,
+			EventID:        e.EventID,
+			IdempotencyKey: e.IdempotencyKey,
+			ProductID:      e.ProductID,
+			UserID:         e.UserID,
+			Qty:            e.Qty,
+			CreatedAt:      e.At,
+			Price:          e.Price,
+			Items:          e.Items,
+			Total:          e.Total,
+		}
+	}
+	d.Status = e.Type
+	d.Version = e.Seq
+	return nil
+}
+
+// Model maps e to the GraphQL model. At is in UTC.
+func (e OrderEvent) Model() model.OrderEvent {
+	m := model.OrderEvent{
+		Seq:     int32(e.Seq),
+		Type:    model.OrderEventType(e.Type),
+		EventID: e.EventID,
+		At:      e.At.UTC(),
+	}
+	if e.Reason != "" {
+		m.Reason = &e.Reason
+	}
+	return m
+}
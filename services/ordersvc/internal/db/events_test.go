@@ -0,0 +1,72 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"rxw1/ordersvc/internal/db"
+)
+
+func TestProject(t *testing.T) {
+	at := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	created := db.NewOrderDoc("o1", "ev1", "k1", "u1", []db.Item{{ProductID: "p1", Qty: 2}}, at).Created()
+	event := func(seq int64, typ string) db.OrderEvent {
+		return db.OrderEvent{OrderID: created.OrderID, Seq: seq, Type: typ, EventID: typ, At: at}
+	}
+
+	tests := []struct {
+		name        string
+		events      []db.OrderEvent
+		wantStatus  string
+		wantErr     error
+		wantAnyFail bool
+	}{
+		{name: "created", events: []db.OrderEvent{created}, wantStatus: db.StatusCreated},
+		{name: "confirmed", events: []db.OrderEvent{created, event(2, db.EventConfirmed)}, wantStatus: db.StatusConfirmed},
+		{name: "rejected", events: []db.OrderEvent{created, event(2, db.EventRejected)}, wantStatus: db.StatusRejected},
+		{name: "canceled", events: []db.OrderEvent{created, event(2, db.EventCanceled)}, wantStatus: db.StatusCanceled},
+		{
+			name:       "confirmed then canceled",
+			events:     []db.OrderEvent{created, event(2, db.EventConfirmed), event(3, db.EventCanceled)},
+			wantStatus: db.StatusCanceled,
+		},
+		{name: "not created first", events: []db.OrderEvent{event(1, db.EventConfirmed)}, wantErr: db.ErrInvalidTransition},
+		{name: "created twice", events: []db.OrderEvent{created, event(2, db.EventCreated)}, wantErr: db.ErrInvalidTransition},
+		{
+			name:    "rejected is final",
+			events:  []db.OrderEvent{created, event(2, db.EventRejected), event(3, db.EventConfirmed)},
+			wantErr: db.ErrInvalidTransition,
+		},
+		{
+			name:    "canceled is final",
+			events:  []db.OrderEvent{created, event(2, db.EventCanceled), event(3, db.EventCanceled)},
+			wantErr: db.ErrInvalidTransition,
+		},
+		{name: "gap in seq", events: []db.OrderEvent{created, event(3, db.EventCanceled)}, wantAnyFail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := db.Project(tt.events)
+			switch {
+			case tt.wantAnyFail:
+				if err == nil {
+					t.Fatalf("Project() = %+v, want an error", d)
+				}
+				return
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("Project() error = %v, want %v", err, tt.wantErr)
+			case err != nil:
+				return
+			}
+
+			if d.Status != tt.wantStatus || d.Version != int64(len(tt.events)) {
+				t.Errorf("status %s version %d, want %s version %d", d.Status, d.Version, tt.wantStatus, len(tt.events))
+			}
+			// Later events change the status only.
+			if d.ID != created.OrderID || d.EventID != "ev1" || d.IdempotencyKey != "k1" || d.Qty != 2 || !d.CreatedAt.Equal(at) {
+				t.Errorf("projection = %+v, want the fields of %+v", d, created)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"rxw1/chaos"
+	"rxw1/model"
+)
+
+// Memory is an in-process OrderRepository for tests and local runs. It keeps
+// events in append order and orders in creation order, as an unsorted Mongo
+// find returns them, and projects them the way Store does.
+type Memory struct {
+	CH *chaos.Injector
+
+	mu     sync.Mutex
+	events []OrderEvent
+	orders []OrderDoc
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) AddOrder(ctx context.Context, orderID, eventID, idempotencyKey, userID string, items []Item, createdAt time.Time) error {
+	if err := m.CH.Inject(ctx, chaos.DB); err != nil {
+		return err
+	}
+	if err := ValidateItems(items); err != nil {
+		return err
+	}
+
+	// The unique indexes on Store.Events: an order and an eventId are
+	// stored once, and so is a user's idempotency key.
+	match := func(e OrderEvent) bool {
+		return e.OrderID == orderID || e.EventID == eventID ||
+			idempotencyKey != "" && e.UserID == userID && e.IdempotencyKey == idempotencyKey
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.ContainsFunc(m.events, match) {
+		return nil
+	}
+	e := NewOrderDoc(orderID, eventID, idempotencyKey, userID, items, createdAt).Created()
+	m.events = append(m.events, e)
+	return m.project(e.OrderID)
+}
+
+func (m *Memory) AppendEvent(ctx context.Context, e OrderEvent) error {
+	if err := m.CH.Inject(ctx, chaos.DB); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.ContainsFunc(m.events, func(s OrderEvent) bool { return s.EventID == e.EventID }) {
+		return nil
+	}
+	e, err := next(m.history(e.OrderID), e)
+	if err != nil {
+		return err
+	}
+	m.events = append(m.events, e)
+	return m.project(e.OrderID)
+}
+
+func (m *Memory) GetAllOrders(ctx context.Context) ([]model.Order, error) {
+	if err := m.CH.Inject(ctx, chaos.DB); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	orders := make([]model.Order, len(m.orders))
+	for i, o := range m.orders {
+		orders[i] = o.Model()
+	}
+	return orders, nil
+}
+
+func (m *Memory) GetOrder(ctx context.Context, id string) (*model.Order, error) {
+	if err := m.CH.Inject(ctx, chaos.DB); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.orders {
+		if o.ID == id {
+			order := o.Model()
+			return &order, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetHistory(ctx context.Context, orderID string) ([]OrderEvent, error) {
+	if err := m.CH.Inject(ctx, chaos.DB); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.history(orderID), nil
+}
+
+func (m *Memory) Rebuild(ctx context.Context) (int, error) {
+	if err := m.CH.Inject(ctx, chaos.DB); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.orders = nil
+	for _, e := range m.events {
+		if e.Seq == 1 {
+			if err := m.project(e.OrderID); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(m.orders), nil
+}
+
+func (m *Memory) owner(_ context.Context, eventID, idempotencyKey, userID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.events {
+		if e.EventID == eventID || idempotencyKey != "" && e.UserID == userID && e.IdempotencyKey == idempotencyKey {
+			return e.OrderID, nil
+		}
+	}
+	return "", nil
+}
+
+// history returns a copy of the order's events; they are appended in Seq
+// order.
+func (m *Memory) history(orderID string) []OrderEvent {
+	var events []OrderEvent
+	for _, e := range m.events {
+		if e.OrderID == orderID {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func (m *Memory) project(orderID string) error {
+	d, err := Project(m.history(orderID))
+	if err != nil {
+		return err
+	}
+	if i := slices.IndexFunc(m.orders, func(o OrderDoc) bool { return o.ID == orderID }); i >= 0 {
+		m.orders[i] = d
+	} else {
+		m.orders = append(m.orders, d)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// https://github.com/golang-migrate/migrate
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"rxw1/logging"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/mongodb"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// Migrate runs all up migrations from the migrations directory of
+// migrationsFS (see: services/ordersvc/main.go). Each script is a JSON list
+// of database commands. They address the orders and order_events collections
+// by name, so the store must use those. A lock collection keeps replicas
+// from migrating at once.
+//
+// Despite its name, 000001_backfill_status_price only backfills status.
+// Prices of existing orders stay absent on purpose: the price an order was
+// placed at is not recorded anywhere else, and productsvc's current price
+// may not be it, so Order.price and total stay null for them.
+func Migrate(ctx context.Context, s *Store, migrationsFS fs.FS) error {
+	database := s.C.Database()
+	logging.From(ctx).Info("migrate", "database", database.Name(), "collection", s.C.Name())
+
+	if s.C.Name() != "orders" || s.Events.Name() != "order_events" {
+		return fmt.Errorf("migrate: scripts target collections orders and order_events, store uses %s and %s", s.C.Name(), s.Events.Name())
+	}
+
+	drv, err := mongodb.WithInstance(database.Client(), &mongodb.Config{
+		DatabaseName: database.Name(),
+		Locking:      mongodb.Locking{Enabled: true},
+	})
+	if err != nil {
+		return fmt.Errorf("mongodb driver: %w", err)
+	}
+
+	srcDriver, err := iofs.New(migrationsFS, "migrations")
+	if err != nil {
+		return fmt.Errorf("iofs source driver: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", srcDriver, "mongodb", drv)
+	if err != nil {
+		return fmt.Errorf("new migrate: %w", err)
+	}
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("migrate up: %w", err)
+	}
+
+	version, dirty, _ := m.Version()
+	logging.From(ctx).Info("migrated", "version", version, "dirty", dirty)
+	return nil
+}
@@ -0,0 +1,120 @@
+package db_test
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"rxw1/ordersvc/internal/db"
+
+	"github.com/oklog/ulid/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrationsFS mirrors the embedded FS in main: a migrations directory.
+var migrationsFS = os.DirFS("../..")
+
+// TestMigrationFiles checks every script parses the way the golang-migrate
+// mongodb driver reads it, has its counterpart, and targets the collections
+// Migrate expects.
+func TestMigrationFiles(t *testing.T) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.json")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations: %v", err)
+	}
+	for _, f := range files {
+		t.Run(path.Base(f), func(t *testing.T) {
+			other := strings.NewReplacer(".up.", ".down.", ".down.", ".up.").Replace(f)
+			if _, err := fs.Stat(migrationsFS, other); err != nil {
+				t.Errorf("missing %s", other)
+			}
+
+			b, err := fs.ReadFile(migrationsFS, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cmds []bson.D
+			if err := bson.UnmarshalExtJSON(b, true, &cmds); err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if len(cmds) == 0 {
+				t.Fatal("no commands")
+			}
+			for _, c := range cmds {
+				if c[0].Value != "orders" && c[0].Value != "order_events" {
+					t.Errorf("%s targets %v, want orders or order_events", c[0].Key, c[0].Value)
+				}
+			}
+		})
+	}
+}
+
+// TestMigrate runs the migrations against a throwaway database on MongoDB at
+// MONGO_URI.
+func TestMigrate(t *testing.T) {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		t.Skip("MONGO_URI not set")
+	}
+	ctx := context.Background()
+	cli, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cli.Disconnect(ctx) })
+
+	database := cli.Database("ordersvc_test_" + ulid.Make().String())
+	t.Cleanup(func() { _ = database.Drop(ctx) })
+	s := &db.Store{C: database.Collection("orders"), Events: database.Collection("order_events")}
+
+	// An order from before statuses, prices and events were stored, under
+	// an id ordersvc derived itself. Its eventId is the id the gateway
+	// returned to the client.
+	at := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	legacy := bson.M{"id": "derived", "eventId": "o1", "productId": "p1", "userId": "u1", "qty": 2, "createdAt": at}
+	if _, err := s.C.InsertOne(ctx, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 { // the second run has nothing to do
+		if err := db.Migrate(ctx, s, migrationsFS); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got bson.M
+	if err := s.C.FindOne(ctx, bson.M{"id": "o1"}).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["price"]; ok || got["status"] != db.StatusCreated {
+		t.Errorf("migrated order = %v, want status %s and no price", got, db.StatusCreated)
+	}
+	if o, err := s.GetOrder(ctx, "o1"); err != nil || o == nil || len(o.Items) != 1 || o.Items[0].ProductID != "p1" || o.Items[0].Qty != 2 || o.Items[0].Price != nil || o.Total != nil {
+		t.Errorf("GetOrder(o1) = %+v, %v, want the backfilled item", o, err)
+	}
+	if _, ok := got["total"]; ok {
+		t.Errorf("migrated order = %v, want no total", got)
+	}
+
+	history, err := s.GetHistory(ctx, "o1")
+	if err != nil || len(history) != 1 {
+		t.Fatalf("GetHistory(o1) = %v, %v, want the backfilled CREATED event", history, err)
+	}
+	if e := history[0]; e.Type != db.EventCreated || e.EventID != "o1" || e.UserID != "u1" || !e.At.Equal(at) || len(e.Items) != 1 {
+		t.Errorf("backfilled event = %+v", e)
+	}
+	if n, err := s.Rebuild(ctx); err != nil || n != 1 {
+		t.Errorf("Rebuild() = %d, %v, want 1 order", n, err)
+	}
+
+	other := &db.Store{C: database.Collection("orders_v2"), Events: s.Events}
+	if err := db.Migrate(ctx, other, migrationsFS); err == nil {
+		t.Error("Migrate() on another collection succeeded")
+	}
+}
@@ -1,59 +1,419 @@
 package db
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"rxw1/chaos"
 	"rxw1/logging"
 	"rxw1/model"
 
-	"github.com/oklog/ulid/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-type Store struct{ C *mongo.Collection }
+// Store keeps each order's history in Events and the current state of every
+// order, projected from it, in C.
+type Store struct {
+	C      *mongo.Collection
+	Events *mongo.Collection
+	CH     *chaos.Injector
+}
+
+// Config configures the Mongo connection. Zero durations and pool sizes keep
+// the driver defaults.
+type Config struct {
+	URI            string
+	Database       string // default "app"
+	Collection     string // default "orders"
+	Events         string // default "order_events"
+	ConnectTimeout time.Duration
+	Timeout        time.Duration // per operation
+	MaxPoolSize    uint64
+	MinPoolSize    uint64
+	PingAttempts   int           // default 5
+	PingBackoff    time.Duration // first wait between pings, doubled after each; default 500ms
+}
 
-func Connect(ctx context.Context, uri string) (*Store, error) {
-	cli, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+// Options returns the driver options for c.
+func (c Config) Options() *options.ClientOptions {
+	o := options.Client().ApplyURI(c.URI)
+	if c.ConnectTimeout > 0 {
+		o.SetConnectTimeout(c.ConnectTimeout)
+		o.SetServerSelectionTimeout(c.ConnectTimeout)
+	}
+	if c.Timeout > 0 {
+		o.SetTimeout(c.Timeout)
+	}
+	if c.MaxPoolSize > 0 {
+		o.SetMaxPoolSize(c.MaxPoolSize)
+	}
+	if c.MinPoolSize > 0 {
+		o.SetMinPoolSize(c.MinPoolSize)
+	}
+	return o
+}
+
+// Connect connects to Mongo and pings it until it answers or the attempts
+// run out, so the service can start alongside the database.
+func Connect(ctx context.Context, cfg Config) (*Store, error) {
+	if cfg.URI == "" {
+		return nil, errors.New("db: no mongo uri")
+	}
+	cli, err := mongo.Connect(ctx, cfg.Options())
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("db: connect mongo: %w", err)
+	}
+
+	attempts := cmp.Or(cfg.PingAttempts, 5)
+	wait := cmp.Or(cfg.PingBackoff, 500*time.Millisecond)
+	for i := 1; ; i++ {
+		if err = cli.Ping(ctx, readpref.Primary()); err == nil {
+			break
+		}
+		if i == attempts {
+			_ = cli.Disconnect(context.WithoutCancel(ctx))
+			return nil, fmt.Errorf("db: ping mongo after %d attempts: %w", attempts, err)
+		}
+		logging.From(ctx).Warn("mongo not ready, retrying", "attempt", i, "wait", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			_ = cli.Disconnect(context.WithoutCancel(ctx))
+			return nil, ctx.Err()
+		}
+		wait *= 2
 	}
-	return &Store{C: cli.Database("app").Collection("orders")}, nil
+
+	db := cli.Database(cmp.Or(cfg.Database, "app"))
+	return &Store{
+		C:      db.Collection(cmp.Or(cfg.Collection, "orders")),
+		Events: db.Collection(cmp.Or(cfg.Events, "order_events")),
+	}, nil
 }
 
-func (s *Store) AddOrder(ctx context.Context, eventID, productID string, qty int, createdAt time.Time) error {
-	ctx = logging.With(ctx, "eventID", eventID, "productID", productID, "qty", qty, "createdAt", createdAt)
+// AddOrder appends the CREATED event of a new order and projects it, unless
+// an order with the same id or eventId, or the same user and idempotency
+// key, already exists. The unique indexes on Events make this hold under
+// concurrent deliveries too: the loser of an insert race gets a duplicate key
+// error, which means already stored.
+func (s *Store) AddOrder(ctx context.Context, orderID, eventID, idempotencyKey, userID string, items []Item, createdAt time.Time) error {
+	ctx = logging.With(ctx, "orderID", orderID, "eventID", eventID, "idempotencyKey", idempotencyKey, "userID", userID, "items", len(items), "createdAt", createdAt)
 
 	logging.From(ctx).Debug("AddOrder")
 
-	res, err := s.C.UpdateOne(ctx,
-		bson.M{"eventId": eventID},
-		bson.M{
-			"$setOnInsert": bson.M{
-				"id":        ulid.Make().String(),
-				"eventId":   eventID,
-				"productId": productID,
-				"qty":       qty,
-				"createdAt": createdAt,
-			},
-		}, options.Update().SetUpsert(true))
-	logging.From(ctx).Debug("result", "res", res, "err", err)
+	if err := ValidateItems(items); err != nil {
+		return err
+	}
+
+	if err := s.CH.Inject(ctx, chaos.DB); err != nil {
+		return err
+	}
+
+	e := NewOrderDoc(orderID, eventID, idempotencyKey, userID, items, createdAt).Created()
+	_, err := s.Events.InsertOne(ctx, e)
+	if mongo.IsDuplicateKeyError(err) {
+		logging.From(ctx).Debug("order already stored")
+
+		// Project the stored order again, in case an earlier delivery
+		// stopped between the append and the projection.
+		filter := bson.A{bson.M{"orderId": orderID}, bson.M{"eventId": eventID}}
+		if idempotencyKey != "" {
+			filter = append(filter, bson.M{"userId": userID, "idempotencyKey": idempotencyKey})
+		}
+		var stored OrderEvent
+		err := s.Events.FindOne(ctx, bson.M{"type": EventCreated, "$or": filter}).Decode(&stored)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return s.project(ctx, stored.OrderID)
+	}
+	if err != nil {
+		return err
+	}
+	return s.project(ctx, e.OrderID)
+}
+
+// appendAttempts bounds the retries of AppendEvent when concurrent events
+// for one order race for the same Seq.
+const appendAttempts = 3
+
+// AppendEvent appends e to the history of order e.OrderID at the next Seq
+// and updates its projection.
+func (s *Store) AppendEvent(ctx context.Context, e OrderEvent) error {
+	ctx = logging.With(ctx, "mongo", "AppendEvent", "orderID", e.OrderID, "eventID", e.EventID, "type", e.Type)
+	if err := s.CH.Inject(ctx, chaos.DB); err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		n, err := s.Events.CountDocuments(ctx, bson.M{"eventId": e.EventID}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			logging.From(ctx).Debug("event already stored")
+			return nil
+		}
+
+		history, err := s.history(ctx, e.OrderID)
+		if err != nil {
+			return err
+		}
+		ev, err := next(history, e)
+		if err != nil {
+			return err
+		}
+		_, err = s.Events.InsertOne(ctx, ev)
+		if mongo.IsDuplicateKeyError(err) && attempt < appendAttempts {
+			logging.From(ctx).Debug("lost append race, retrying", "seq", ev.Seq)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return s.project(ctx, ev.OrderID)
+	}
+}
+
+// GetHistory returns the events of the order with the given id, oldest first.
+func (s *Store) GetHistory(ctx context.Context, orderID string) ([]OrderEvent, error) {
+	ctx = logging.With(ctx, "mongo", "GetHistory", "orderID", orderID)
+	if err := s.CH.Inject(ctx, chaos.DB); err != nil {
+		return nil, err
+	}
+	events, err := s.history(ctx, orderID)
+	if err != nil {
+		logging.From(ctx).Error("DATABASE MONGO failed to find order events", "error", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+func (s *Store) owner(ctx context.Context, eventID, idempotencyKey, userID string) (string, error) {
+	filter := bson.A{bson.M{"eventId": eventID}}
+	if idempotencyKey != "" {
+		filter = append(filter, bson.M{"userId": userID, "idempotencyKey": idempotencyKey})
+	}
+	var e OrderEvent
+	err := s.Events.FindOne(ctx, bson.M{"$or": filter}, options.FindOne().SetProjection(bson.M{"orderId": 1})).Decode(&e)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	return e.OrderID, err
+}
+
+func (s *Store) history(ctx context.Context, orderID string) ([]OrderEvent, error) {
+	cur, err := s.Events.Find(ctx, bson.M{"orderId": orderID}, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var events []OrderEvent
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// project replaces the projection of the order with the fold of its events.
+// A projection that is already at the same or a later version is left
+// alone: the replace then misses, and its upsert hits id_unique.
+func (s *Store) project(ctx context.Context, orderID string) error {
+	events, err := s.history(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("%w: %s", ErrOrderNotFound, orderID)
+	}
+	d, err := Project(events)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.C.ReplaceOne(ctx,
+		bson.M{"id": orderID, "$or": bson.A{
+			bson.M{"version": bson.M{"$lt": d.Version}},
+			bson.M{"version": bson.M{"$exists": false}},
+		}},
+		d, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		logging.From(ctx).Debug("projection already current", "orderID", orderID, "version", d.Version)
+		return nil
+	}
 	return err
 }
 
+// rebuildBatch is how many orders Rebuild inserts at a time.
+const rebuildBatch = 1000
+
+// Rebuild replaces every order in C with the fold of its events and returns
+// how many orders it wrote. It refuses to run while C holds orders without
+// events; migration 000002 backfills those. The orders are written to a
+// temporary collection, which then replaces C in one renameCollection, so
+// readers keep seeing the old orders until the swap. Projections written to
+// C while it runs are replaced too, so it is meant for ordersctl, not a
+// serving instance.
+func (s *Store) Rebuild(ctx context.Context) (int, error) {
+	ctx = logging.With(ctx, "mongo", "Rebuild")
+
+	orphans, err := s.orphans(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if orphans > 0 {
+		return 0, fmt.Errorf("db: %d orders have no events, run migration 000002 first", orphans)
+	}
+
+	database := s.C.Database()
+	tmp := database.Collection(s.C.Name() + "_rebuild")
+	if err := tmp.Drop(ctx); err != nil { // left over from a failed run
+		return 0, err
+	}
+	if err := ensureCollection(ctx, tmp, OrderValidator, OrderIndexes); err != nil {
+		return 0, err
+	}
+
+	cur, err := s.Events.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "orderId", Value: 1}, {Key: "seq", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	var (
+		n      int
+		docs   []any
+		events []OrderEvent
+	)
+	insert := func() error {
+		if len(docs) == 0 {
+			return nil
+		}
+		if _, err := tmp.InsertMany(ctx, docs); err != nil {
+			return err
+		}
+		n, docs = n+len(docs), nil
+		return nil
+	}
+	flush := func() error {
+		if len(events) == 0 {
+			return nil
+		}
+		d, err := Project(events)
+		if err != nil {
+			return err
+		}
+		docs, events = append(docs, d), nil
+		if len(docs) < rebuildBatch {
+			return nil
+		}
+		return insert()
+	}
+	for cur.Next(ctx) {
+		var e OrderEvent
+		if err := cur.Decode(&e); err != nil {
+			return 0, err
+		}
+		if len(events) > 0 && events[0].OrderID != e.OrderID {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+		events = append(events, e)
+	}
+	if err := cur.Err(); err != nil {
+		return 0, err
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	if err := insert(); err != nil {
+		return 0, err
+	}
+
+	err = database.Client().Database("admin").RunCommand(ctx, bson.D{
+		{Key: "renameCollection", Value: database.Name() + "." + tmp.Name()},
+		{Key: "to", Value: database.Name() + "." + s.C.Name()},
+		{Key: "dropTarget", Value: true},
+	}).Err()
+	if err != nil {
+		return 0, fmt.Errorf("db: swap in rebuilt orders: %w", err)
+	}
+	logging.From(ctx).Info("projections rebuilt", "orders", n)
+	return n, nil
+}
+
+// orphans counts the orders in C that have no events.
+func (s *Store) orphans(ctx context.Context) (int, error) {
+	cur, err := s.C.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from":     s.Events.Name(),
+			"let":      bson.M{"id": "$id"},
+			"pipeline": bson.A{bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$orderId", "$$id"}}}}, bson.M{"$limit": 1}, bson.M{"$project": bson.M{"_id": 1}}},
+			"as":       "events",
+		}}},
+		{{Key: "$match", Value: bson.M{"events": bson.M{"$size": 0}}}},
+		{{Key: "$count", Value: "orphans"}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var res []struct {
+		Orphans int `bson:"orphans"`
+	}
+	if err := cur.All(ctx, &res); err != nil || len(res) == 0 {
+		return 0, err
+	}
+	return res[0].Orphans, nil
+}
+
 func (s *Store) GetAllOrders(ctx context.Context) ([]model.Order, error) {
 	ctx = logging.With(ctx, "mongo", "GetAllOrders")
+	if err := s.CH.Inject(ctx, chaos.DB); err != nil {
+		return nil, err
+	}
 	cur, err := s.C.Find(ctx, bson.M{})
 	if err != nil {
 		logging.From(ctx).Error("DATABASE MONGO failed to find orders", "error", err)
 		return nil, err
 	}
-	var orders []model.Order
-	if err := cur.All(ctx, &orders); err != nil {
+	var docs []OrderDoc
+	if err := cur.All(ctx, &docs); err != nil {
 		logging.From(ctx).Error("DATABASE MONGO failed to decode orders", "error", err)
 		return nil, err
 	}
+	orders := make([]model.Order, len(docs))
+	for i, d := range docs {
+		orders[i] = d.Model()
+	}
 	return orders, nil
 }
+
+// GetOrder returns the order with the given id, or nil if there is none.
+func (s *Store) GetOrder(ctx context.Context, id string) (*model.Order, error) {
+	ctx = logging.With(ctx, "mongo", "GetOrder", "orderID", id)
+	if err := s.CH.Inject(ctx, chaos.DB); err != nil {
+		return nil, err
+	}
+
+	var doc OrderDoc
+	err := s.C.FindOne(ctx, bson.M{"id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		logging.From(ctx).Error("DATABASE MONGO failed to find order", "error", err)
+		return nil, err
+	}
+
+	o := doc.Model()
+	return &o, nil
+}
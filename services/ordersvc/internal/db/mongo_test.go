@@ -0,0 +1,73 @@
+package db_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"rxw1/ordersvc/internal/db"
+)
+
+func TestConfig_Options(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         db.Config
+		wantTimeout *time.Duration
+		wantMaxPool *uint64
+	}{
+		{
+			name: "driver defaults",
+			cfg:  db.Config{URI: "mongodb://localhost:27017"},
+		},
+		{
+			name:        "timeouts and pool",
+			cfg:         db.Config{URI: "mongodb://localhost:27017", Timeout: 2 * time.Second, MaxPoolSize: 50},
+			wantTimeout: ptr(2 * time.Second),
+			wantMaxPool: ptr(uint64(50)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := tt.cfg.Options()
+			if err := o.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if !equal(o.Timeout, tt.wantTimeout) {
+				t.Errorf("Timeout = %v, want %v", o.Timeout, tt.wantTimeout)
+			}
+			if !equal(o.MaxPoolSize, tt.wantMaxPool) {
+				t.Errorf("MaxPoolSize = %v, want %v", o.MaxPoolSize, tt.wantMaxPool)
+			}
+		})
+	}
+}
+
+func TestConnect_RetriesPing(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := db.Connect(ctx, db.Config{}); err == nil {
+		t.Error("Connect() without uri succeeded")
+	}
+
+	start := time.Now()
+	_, err := db.Connect(ctx, db.Config{
+		URI:            "mongodb://127.0.0.1:1/?directConnection=true",
+		ConnectTimeout: 50 * time.Millisecond,
+		PingAttempts:   3,
+		PingBackoff:    20 * time.Millisecond,
+	})
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Fatalf("Connect() error = %v, want ping failure after 3 attempts", err)
+	}
+	// Two waits between three pings: 20ms, then 40ms.
+	if d := time.Since(start); d < 60*time.Millisecond {
+		t.Errorf("Connect() gave up after %v, want >= 60ms of backoff", d)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func equal[T comparable](a, b *T) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
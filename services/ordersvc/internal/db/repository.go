@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"rxw1/model"
+)
+
+// OrderRepository persists and reads orders. Every change to an order is an
+// OrderEvent in its history; the orders read back are projections of those
+// events (see Project). Store implements it on MongoDB and Memory in
+// process; both pass the same contract tests.
+type OrderRepository interface {
+	// AddOrder stores the order orderID of items unless its id, its eventId,
+	// or its user and idempotency key when a key is set, is already stored. It returns
+	// ErrInvalidOrder if items fail ValidateItems.
+	AddOrder(ctx context.Context, orderID, eventID, idempotencyKey, userID string, items []Item, createdAt time.Time) error
+	// AppendEvent appends e to the history of order e.OrderID at the next
+	// Seq and updates its projection. It returns ErrOrderNotFound or
+	// ErrInvalidTransition if e does not apply, and ignores an EventID that
+	// is already stored.
+	AppendEvent(ctx context.Context, e OrderEvent) error
+	GetAllOrders(ctx context.Context) ([]model.Order, error)
+	// GetOrder returns the order with the given id, or nil if there is none.
+	GetOrder(ctx context.Context, id string) (*model.Order, error)
+	// GetHistory returns the events of the order with the given id, oldest
+	// first, or none if there is no such order.
+	GetHistory(ctx context.Context, orderID string) ([]OrderEvent, error)
+	// Rebuild recomputes every order from its events and returns how many
+	// orders it wrote.
+	Rebuild(ctx context.Context) (int, error)
+}
+
+var (
+	_ OrderRepository = (*Store)(nil)
+	_ OrderRepository = (*Memory)(nil)
+	_ OrderRepository = (*DryRun)(nil)
+)
@@ -0,0 +1,262 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"rxw1/model"
+	"rxw1/ordersvc/internal/db"
+
+	"github.com/oklog/ulid/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testOrderRepository is the contract every OrderRepository must meet.
+func testOrderRepository(t *testing.T, newRepo func(t *testing.T) db.OrderRepository) {
+	ctx := context.Background()
+	at := time.Date(2025, 3, 4, 5, 6, 7, 0, time.FixedZone("CET", 3600))
+
+	t.Run("empty", func(t *testing.T) {
+		r := newRepo(t)
+		orders, err := r.GetAllOrders(ctx)
+		if err != nil || len(orders) != 0 {
+			t.Errorf("GetAllOrders() = %v, %v, want none", orders, err)
+		}
+		o, err := r.GetOrder(ctx, "missing")
+		if err != nil || o != nil {
+			t.Errorf("GetOrder(missing) = %v, %v, want nil, nil", o, err)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		r := newRepo(t)
+		items := []db.Item{{ProductID: "p1", Name: "Widget", Price: ptr[int32](250), Qty: 3}, {ProductID: "p2", Name: "Gadget", Price: ptr[int32](100), Qty: 1}}
+		if err := r.AddOrder(ctx, "o1", "ev1", "", "u1", items, at); err != nil {
+			t.Fatal(err)
+		}
+		orders, err := r.GetAllOrders(ctx)
+		if err != nil || len(orders) != 1 {
+			t.Fatalf("GetAllOrders() = %v, %v, want one order", orders, err)
+		}
+		got := orders[0]
+		if got.ID != "o1" || got.EventID != "ev1" || got.ProductID != "p1" || got.UserID != "u1" || got.Qty != 3 {
+			t.Errorf("stored order = %+v", got)
+		}
+		if !got.CreatedAt.Equal(at) || got.CreatedAt.Location() != time.UTC {
+			t.Errorf("CreatedAt = %v, want %v in UTC", got.CreatedAt, at)
+		}
+		wantItems := []*model.OrderItem{
+			{ProductID: "p1", Name: "Widget", Price: ptr[int32](250), Qty: 3, Subtotal: ptr[int32](750)},
+			{ProductID: "p2", Name: "Gadget", Price: ptr[int32](100), Qty: 1, Subtotal: ptr[int32](100)},
+		}
+		if !reflect.DeepEqual(got.Items, wantItems) || !reflect.DeepEqual(got.Total, ptr[int32](850)) || !reflect.DeepEqual(got.Price, ptr[int32](250)) {
+			t.Errorf("items %+v total %v price %v, want %+v total 850 price 250", got.Items, got.Total, got.Price, wantItems)
+		}
+
+		byID, err := r.GetOrder(ctx, got.ID)
+		if err != nil || byID == nil || !reflect.DeepEqual(*byID, got) {
+			t.Errorf("GetOrder(%s) = %+v, %v, want %+v", got.ID, byID, err, got)
+		}
+	})
+
+	t.Run("invalid items", func(t *testing.T) {
+		r := newRepo(t)
+		dup := []db.Item{{ProductID: "p1", Qty: 1}, {ProductID: "p1", Qty: 2}}
+		if err := r.AddOrder(ctx, "o1", "ev1", "", "u1", dup, at); !errors.Is(err, db.ErrInvalidOrder) {
+			t.Errorf("AddOrder(duplicate products) = %v, want %v", err, db.ErrInvalidOrder)
+		}
+		if orders, _ := r.GetAllOrders(ctx); len(orders) != 0 {
+			t.Errorf("stored %+v, want nothing", orders)
+		}
+	})
+
+	t.Run("history", func(t *testing.T) {
+		r := newRepo(t)
+		if err := r.AddOrder(ctx, "o1", "ev1", "", "u1", []db.Item{{ProductID: "p1", Qty: 3}}, at); err != nil {
+			t.Fatal(err)
+		}
+		orders, err := r.GetAllOrders(ctx)
+		if err != nil || len(orders) != 1 {
+			t.Fatalf("GetAllOrders() = %v, %v, want one order", orders, err)
+		}
+		id := orders[0].ID
+
+		later := at.Add(time.Minute)
+		appends := []struct {
+			e       db.OrderEvent
+			wantErr error
+		}{
+			{e: db.OrderEvent{OrderID: id, Type: db.EventConfirmed, EventID: "ev2", At: later}},
+			{e: db.OrderEvent{OrderID: id, Type: db.EventCanceled, EventID: "ev3", At: later, Reason: "changed mind"}},
+			{e: db.OrderEvent{OrderID: id, Type: db.EventCanceled, EventID: "ev3", At: later}}, // redelivered
+			{e: db.OrderEvent{OrderID: id, Type: db.EventConfirmed, EventID: "ev4", At: later}, wantErr: db.ErrInvalidTransition},
+			{e: db.OrderEvent{OrderID: id, Type: db.EventCreated, EventID: "ev5", At: later}, wantErr: db.ErrInvalidTransition},
+			{e: db.OrderEvent{OrderID: "missing", Type: db.EventCanceled, EventID: "ev6", At: later}, wantErr: db.ErrOrderNotFound},
+		}
+		for _, a := range appends {
+			if err := r.AppendEvent(ctx, a.e); !errors.Is(err, a.wantErr) {
+				t.Errorf("AppendEvent(%s %s) = %v, want %v", a.e.Type, a.e.EventID, err, a.wantErr)
+			}
+		}
+
+		o, err := r.GetOrder(ctx, id)
+		if err != nil || o == nil || o.Status != model.OrderStatusCanceled || o.ProductID != "p1" {
+			t.Errorf("GetOrder(%s) = %+v, %v, want a CANCELED order of p1", id, o, err)
+		}
+
+		history, err := r.GetHistory(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range history {
+			got = append(got, fmt.Sprintf("%d %s %s", e.Seq, e.Type, e.EventID))
+		}
+		want := []string{"1 CREATED ev1", "2 CONFIRMED ev2", "3 CANCELED ev3"}
+		if !slices.Equal(got, want) {
+			t.Errorf("history = %q, want %q", got, want)
+		}
+		if history[2].Reason != "changed mind" || !history[2].At.Equal(later) {
+			t.Errorf("cancel event = %+v", history[2])
+		}
+
+		if h, err := r.GetHistory(ctx, "missing"); err != nil || len(h) != 0 {
+			t.Errorf("GetHistory(missing) = %v, %v, want none", h, err)
+		}
+	})
+
+	t.Run("rebuild", func(t *testing.T) {
+		r := newRepo(t)
+		for _, ev := range []string{"ev1", "ev2"} {
+			if err := r.AddOrder(ctx, "o-"+ev, ev, "", "u1", []db.Item{{ProductID: "p1", Qty: 1}}, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+		before, err := r.GetAllOrders(ctx)
+		if err != nil || len(before) != 2 {
+			t.Fatalf("GetAllOrders() = %v, %v, want two orders", before, err)
+		}
+		if err := r.AppendEvent(ctx, db.OrderEvent{OrderID: before[1].ID, Type: db.EventRejected, EventID: "ev3", At: at}); err != nil {
+			t.Fatal(err)
+		}
+		before[1].Status = model.OrderStatusRejected
+
+		n, err := r.Rebuild(ctx)
+		if err != nil || n != 2 {
+			t.Fatalf("Rebuild() = %d, %v, want 2", n, err)
+		}
+		after, err := r.GetAllOrders(ctx)
+		if err != nil || !reflect.DeepEqual(after, before) {
+			t.Errorf("GetAllOrders() after Rebuild = %+v, %v, want %+v", after, err, before)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		adds   [][5]string // orderID, eventID, idempotencyKey, userID, productID
+		wantPs []string    // product IDs stored, in order
+	}{
+		{
+			name:   "duplicate event ignored",
+			adds:   [][5]string{{"o1", "ev1", "", "u1", "p1"}, {"o1", "ev1", "", "u1", "p2"}},
+			wantPs: []string{"p1"},
+		},
+		{
+			name:   "distinct events stored",
+			adds:   [][5]string{{"o1", "ev1", "", "u1", "p1"}, {"o2", "ev2", "", "u1", "p2"}},
+			wantPs: []string{"p1", "p2"},
+		},
+		{
+			name:   "order id stored once",
+			adds:   [][5]string{{"o1", "ev1", "", "u1", "p1"}, {"o1", "ev2", "", "u1", "p2"}},
+			wantPs: []string{"p1"},
+		},
+		{
+			name:   "event id stored once",
+			adds:   [][5]string{{"o1", "ev1", "", "u1", "p1"}, {"o2", "ev1", "", "u1", "p2"}},
+			wantPs: []string{"p1"},
+		},
+		{
+			name:   "idempotency key wins over event id",
+			adds:   [][5]string{{"o1", "ev1", "k1", "u1", "p1"}, {"o2", "ev2", "k1", "u1", "p2"}},
+			wantPs: []string{"p1"},
+		},
+		{
+			name:   "idempotency key scoped to user",
+			adds:   [][5]string{{"o1", "ev1", "k1", "u1", "p1"}, {"o2", "ev2", "k1", "u2", "p2"}},
+			wantPs: []string{"p1", "p2"},
+		},
+		{
+			name:   "event stored once with or without key",
+			adds:   [][5]string{{"o1", "ev1", "", "u1", "p1"}, {"o1", "ev1", "k1", "u1", "p2"}},
+			wantPs: []string{"p1"},
+		},
+		{
+			name:   "keyed event stored once",
+			adds:   [][5]string{{"o1", "ev1", "k1", "u1", "p1"}, {"o1", "ev1", "", "u1", "p2"}},
+			wantPs: []string{"p1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRepo(t)
+			for _, a := range tt.adds {
+				if err := r.AddOrder(ctx, a[0], a[1], a[2], a[3], []db.Item{{ProductID: a[4], Qty: 1}}, at); err != nil {
+					t.Fatal(err)
+				}
+			}
+			orders, err := r.GetAllOrders(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, o := range orders {
+				got = append(got, o.ProductID)
+			}
+			if len(got) != len(tt.wantPs) {
+				t.Fatalf("stored products %v, want %v", got, tt.wantPs)
+			}
+			for i := range got {
+				if got[i] != tt.wantPs[i] {
+					t.Errorf("stored products %v, want %v", got, tt.wantPs)
+				}
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testOrderRepository(t, func(*testing.T) db.OrderRepository { return db.NewMemory() })
+}
+
+// TestStore runs the contract against MongoDB at MONGO_URI, throwaway
+// collections per case.
+func TestStore(t *testing.T) {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		t.Skip("MONGO_URI not set")
+	}
+	ctx := context.Background()
+	cli, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cli.Disconnect(ctx) })
+
+	testOrderRepository(t, func(t *testing.T) db.OrderRepository {
+		database, suffix := cli.Database("ordersvc_test"), ulid.Make().String()
+		s := &db.Store{C: database.Collection("orders_" + suffix), Events: database.Collection("order_events_" + suffix)}
+		t.Cleanup(func() { _ = s.C.Drop(ctx); _ = s.Events.Drop(ctx) })
+		if err := s.EnsureSchema(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
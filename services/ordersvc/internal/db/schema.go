@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"rxw1/logging"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Order statuses. Orders stored before statuses existed get StatusCreated
+// from migration 000001.
+const (
+	StatusCreated   = "CREATED"
+	StatusConfirmed = "CONFIRMED"
+	StatusRejected  = "REJECTED"
+	StatusCanceled  = "CANCELED"
+)
+
+var statuses = bson.A{StatusCreated, StatusConfirmed, StatusRejected, StatusCanceled}
+
+// itemsSchema is the $jsonSchema of the items of an order and its CREATED
+// event. Only ValidateItems checks products are distinct.
+var itemsSchema = bson.M{
+	"bsonType": "array",
+	"minItems": 1,
+	"maxItems": MaxItems,
+	"items": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"productId", "qty"},
+		"properties": bson.M{
+			"productId": bson.M{"bsonType": "string", "minLength": 1},
+			"name":      bson.M{"bsonType": "string"},
+			"price":     bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+			"qty":       bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+		},
+	},
+}
+
+// OrderValidator is the $jsonSchema every order document must match.
+// Existing documents that do not are left alone until they are updated.
+var OrderValidator = bson.M{"$jsonSchema": bson.M{
+	"bsonType": "object",
+	"required": bson.A{"id", "eventId", "productId", "userId", "qty", "createdAt"},
+	"properties": bson.M{
+		"id":             bson.M{"bsonType": "string", "minLength": 1},
+		"eventId":        bson.M{"bsonType": "string", "minLength": 1},
+		"idempotencyKey": bson.M{"bsonType": "string"},
+		"productId":      bson.M{"bsonType": "string", "minLength": 1},
+		"userId":         bson.M{"bsonType": "string", "minLength": 1},
+		"qty":            bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+		"createdAt":      bson.M{"bsonType": "date"},
+		"status":         bson.M{"enum": statuses},
+		"price":          bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+		"items":          itemsSchema,
+		"total":          bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+		"version":        bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+	},
+}}
+
+// OrderEventValidator is the $jsonSchema every document in the events
+// collection must match.
+var OrderEventValidator = bson.M{"$jsonSchema": bson.M{
+	"bsonType": "object",
+	"required": bson.A{"orderId", "seq", "type", "eventId", "at"},
+	"properties": bson.M{
+		"orderId":        bson.M{"bsonType": "string", "minLength": 1},
+		"seq":            bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+		"type":           bson.M{"enum": statuses},
+		"eventId":        bson.M{"bsonType": "string", "minLength": 1},
+		"at":             bson.M{"bsonType": "date"},
+		"reason":         bson.M{"bsonType": "string"},
+		"idempotencyKey": bson.M{"bsonType": "string"},
+		"productId":      bson.M{"bsonType": "string"},
+		"userId":         bson.M{"bsonType": "string"},
+		"qty":            bson.M{"bsonType": bson.A{"int", "long"}},
+		"price":          bson.M{"bsonType": bson.A{"int", "long"}},
+		"items":          itemsSchema,
+		"total":          bson.M{"bsonType": bson.A{"int", "long"}},
+	},
+}}
+
+// OrderIndexes back the lookups and the AddOrder dedupe. The unique ones
+// turn concurrent duplicate inserts into duplicate key errors.
+var OrderIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "eventId", Value: 1}},
+		Options: options.Index().SetName("eventId_unique").SetUnique(true),
+	},
+	{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetName("id_unique").SetUnique(true),
+	},
+	{
+		Keys:    bson.D{{Key: "productId", Value: 1}},
+		Options: options.Index().SetName("productId"),
+	},
+	{
+		Keys:    bson.D{{Key: "items.productId", Value: 1}},
+		Options: options.Index().SetName("items_productId"),
+	},
+	{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+		Options: options.Index().SetName("userId_createdAt"),
+	},
+	{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "idempotencyKey", Value: 1}},
+		Options: options.Index().SetName("userId_idempotencyKey_unique").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"idempotencyKey": bson.M{"$gt": ""}}),
+	},
+}
+
+// OrderEventIndexes make appends safe under concurrency: a redelivered
+// event, a second order for a user's idempotency key, or two events racing
+// for the same Seq all fail with a duplicate key error. orderId_seq_unique
+// also serves History and is created by migration 000002 as well.
+var OrderEventIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "orderId", Value: 1}, {Key: "seq", Value: 1}},
+		Options: options.Index().SetName("orderId_seq_unique").SetUnique(true),
+	},
+	{
+		Keys:    bson.D{{Key: "eventId", Value: 1}},
+		Options: options.Index().SetName("eventId_unique").SetUnique(true),
+	},
+	{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "idempotencyKey", Value: 1}},
+		Options: options.Index().SetName("userId_idempotencyKey_unique").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"idempotencyKey": bson.M{"$gt": ""}}),
+	},
+}
+
+// codeNamespaceExists is the server error for creating an existing collection.
+const codeNamespaceExists = 48
+
+// EnsureSchema creates the orders collection with OrderValidator and the
+// events collection with OrderEventValidator, or updates the validators of
+// existing ones, and creates their indexes. It is idempotent, so every
+// instance runs it on startup.
+func (s *Store) EnsureSchema(ctx context.Context) error {
+	if err := ensureCollection(ctx, s.C, OrderValidator, OrderIndexes); err != nil {
+		return err
+	}
+	return ensureCollection(ctx, s.Events, OrderEventValidator, OrderEventIndexes)
+}
+
+func ensureCollection(ctx context.Context, c *mongo.Collection, validator bson.M, indexes []mongo.IndexModel) error {
+	db, name := c.Database(), c.Name()
+
+	err := db.CreateCollection(ctx, name, options.CreateCollection().
+		SetValidator(validator).
+		SetValidationLevel("moderate"))
+	var ce mongo.CommandError
+	if errors.As(err, &ce) && ce.Code == codeNamespaceExists {
+		err = db.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: name},
+			{Key: "validator", Value: validator},
+			{Key: "validationLevel", Value: "moderate"},
+		}).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("db: validator on %s: %w", name, err)
+	}
+
+	created, err := c.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return fmt.Errorf("db: indexes on %s: %w", name, err)
+	}
+	logging.From(ctx).Info("mongo schema ensured", "collection", name, "indexes", created)
+	return nil
+}
@@ -0,0 +1,134 @@
+package handle
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"rxw1/ordersvc/internal/db"
+)
+
+var (
+	// ErrMalformed is returned for payloads that cannot be decoded. They
+	// are logged and skipped; redelivering them cannot help.
+	ErrMalformed = errors.New("handle: malformed event")
+	// ErrUnknownSubject is returned by Handle for subjects it has no
+	// handler for.
+	ErrUnknownSubject = errors.New("handle: unknown subject")
+)
+
+// Event is the payload of order.created. ID is the order's id, the one the
+// gateway returned to the client, and EventID the event's own, as in
+// Transition. Payloads without an EventID use ID for both. ProductID and Qty
+// repeat the first item; events published before orders had items carry
+// only those, and stand for one item at an unknown price.
+type Event struct {
+	ID             string
+	EventID        string
+	ProductID      string
+	UserID         string
+	CreatedAt      string
+	Qty            int
+	IdempotencyKey string
+	Items          []Item
+}
+
+// Item is a line of an order.created event, with the product's name and
+// price as the gateway resolved them when the order was placed.
+type Item struct {
+	ProductID string
+	Name      string
+	Price     *int32
+	Qty       int32
+}
+
+// items returns the order's items as stored. Totals are computed by db and
+// never taken from the event.
+func (e Event) items() []db.Item {
+	if len(e.Items) == 0 {
+		return []db.Item{{ProductID: e.ProductID, Qty: int32(e.Qty)}}
+	}
+	items := make([]db.Item, len(e.Items))
+	for i, it := range e.Items {
+		items[i] = db.Item{ProductID: it.ProductID, Name: it.Name, Price: it.Price, Qty: it.Qty}
+	}
+	return items
+}
+
+// Transition is the payload of order.confirmed, order.rejected and
+// order.canceled. ID is the order's id, EventID the event's own.
+type Transition struct {
+	ID        string
+	EventID   string
+	CreatedAt string
+	Reason    string
+}
+
+// transitionSubjects maps the subjects SubscribeToOrderTransitions handles
+// to the event each appends.
+var transitionSubjects = map[string]string{
+	"order.confirmed": db.EventConfirmed,
+	"order.rejected":  db.EventRejected,
+	"order.canceled":  db.EventCanceled,
+}
+
+// Handle applies one order event, as published on subject, to mo. It is
+// what the subscriptions do minus throttling and fault injection, so
+// ordersctl replay reprocesses past events with the current handler code.
+func Handle(ctx context.Context, mo db.OrderRepository, subject string, data []byte) error {
+	if subject == "order.created" {
+		e, ts, err := decodeCreated(data)
+		if err != nil {
+			return err
+		}
+		return addOrder(ctx, mo, e, ts)
+	}
+	if _, ok := transitionSubjects[subject]; ok {
+		e, err := decodeTransition(subject, data)
+		if err != nil {
+			return err
+		}
+		return mo.AppendEvent(ctx, e)
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownSubject, subject)
+}
+
+func decodeCreated(data []byte) (Event, time.Time, error) {
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Event{}, time.Time{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if e.ID == "" {
+		return Event{}, time.Time{}, fmt.Errorf("%w: id is required", ErrMalformed)
+	}
+	e.EventID = cmp.Or(e.EventID, e.ID)
+	ts, err := time.Parse(time.RFC3339, e.CreatedAt)
+	if err != nil {
+		return Event{}, time.Time{}, fmt.Errorf("%w: createdAt: %v", ErrMalformed, err)
+	}
+	return e, ts, nil
+}
+
+func addOrder(ctx context.Context, mo db.OrderRepository, e Event, ts time.Time) error {
+	return mo.AddOrder(ctx, e.ID, e.EventID, e.IdempotencyKey, e.UserID, e.items(), ts)
+}
+
+// decodeTransition returns the order event a transition payload on subject
+// appends.
+func decodeTransition(subject string, data []byte) (db.OrderEvent, error) {
+	var e Transition
+	if err := json.Unmarshal(data, &e); err != nil {
+		return db.OrderEvent{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if e.ID == "" || e.EventID == "" {
+		return db.OrderEvent{}, fmt.Errorf("%w: id and eventID are required", ErrMalformed)
+	}
+	ts, err := time.Parse(time.RFC3339, e.CreatedAt)
+	if err != nil {
+		return db.OrderEvent{}, fmt.Errorf("%w: createdAt: %v", ErrMalformed, err)
+	}
+	return db.OrderEvent{OrderID: e.ID, Type: transitionSubjects[subject], EventID: e.EventID, At: ts, Reason: e.Reason}, nil
+}
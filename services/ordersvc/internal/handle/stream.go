@@ -0,0 +1,33 @@
+package handle
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Stream is the JetStream stream that keeps every order.* event, so
+// ordersctl can replay them. Publishers keep using plain NATS.
+const Stream = "ORDERS"
+
+// EnsureStream creates Stream, or updates its retention, keeping events
+// for maxAge.
+func EnsureStream(nc *nats.Conn, maxAge time.Duration) error {
+	js, err := nc.JetStream()
+	if err != nil {
+		return err
+	}
+	cfg := &nats.StreamConfig{
+		Name:        Stream,
+		Description: "order events, for ordersctl replay",
+		Subjects:    []string{"order.>"},
+		Storage:     nats.FileStorage,
+		MaxAge:      maxAge,
+	}
+	_, err = js.AddStream(cfg)
+	if errors.Is(err, nats.ErrStreamNameAlreadyInUse) {
+		_, err = js.UpdateStream(cfg)
+	}
+	return err
+}
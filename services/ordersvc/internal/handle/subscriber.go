@@ -3,60 +3,56 @@ package handle
 import (
 	"context"
 	"encoding/json"
-	"math/rand/v2"
-	"time"
+	"errors"
 
+	"rxw1/chaos"
 	"rxw1/flags"
 	"rxw1/logging"
+	"rxw1/model"
 	"rxw1/ordersvc/internal/db"
 
 	"github.com/nats-io/nats.go"
 )
 
-type Event struct {
-	ID        string
-	ProductID string
-	CreatedAt string
-	Qty       int
-}
-
-func SubscribeToOrdersCreated(ctx context.Context, nc *nats.Conn, mo *db.Store, ff *flags.Flags) (*nats.Subscription, error) {
+func SubscribeToOrdersCreated(ctx context.Context, nc *nats.Conn, mo db.OrderRepository, ff *flags.Flags, ch *chaos.Injector) (*nats.Subscription, error) {
+	throttle := &pacer{interval: throttleInterval}
 	// ctx = logging.With(ctx, "fn", "SubscribeToOrdersCreated", "package", "nats")
 
 	sub, err := nc.Subscribe("order.created", func(m *nats.Msg) {
 		// ctx = logging.With(ctx, "fn", "Subscribe", "package", "nats")
-		var e Event
-		if json.Unmarshal(m.Data, &e) != nil {
-			logging.From(ctx).Error("failed to unmarshal event", "data", string(m.Data))
+		e, ts, err := decodeCreated(m.Data)
+		if err != nil {
+			logging.From(ctx).Error("skipping event", "error", err, "data", string(m.Data))
 			return // return nothing = skip message
 		}
 
-		ts, err := time.Parse(time.RFC3339, e.CreatedAt)
-		if err != nil {
-			logging.From(ctx).Error("failed to parse time", "error", err, "time", e.CreatedAt)
-			return
-		}
+		logging.From(ctx).Info("event", "orderId", e.ID, "eventId", e.EventID, "productId", e.ProductID, "userId", e.UserID, "qty", e.Qty, "items", len(e.Items), "createdAt", e.CreatedAt)
 
-		logging.From(ctx).Info("event", "eventId", e.ID, "productId", e.ProductID, "qty", e.Qty, "createdAt", e.CreatedAt)
+		// Evaluate flags for the user who placed the order.
+		ctx := flags.WithRequestID(flags.WithUserID(ctx, e.UserID), e.ID)
 
 		if ff.ThrottleEnabled(ctx) {
-			t := time.Duration(rand.IntN(500)) * time.Millisecond
-			logging.From(ctx).Info("throttling enabled, sleeping", "t", t)
-			time.Sleep(t)
+			if err := throttle.wait(ctx); err != nil {
+				return
+			}
 		}
 
-		err = mo.AddOrder(ctx, e.ID, e.ProductID, e.Qty, ts)
-		if err != nil {
+		if err := ch.Inject(ctx, chaos.Handler); err != nil {
+			logging.From(ctx).Warn("skipping event", "orderId", e.ID, "eventId", e.EventID, "error", err)
+			return
+		}
+
+		if err := addOrder(ctx, mo, e, ts); err != nil {
 			logging.From(ctx).Error("failed to add order to mongodb", "error", err)
 			return
 		}
 
-		logging.From(ctx).Info("order created", "event", e, "error", err)
+		logging.From(ctx).Info("order created", "event", e)
 	})
 	return sub, err
 }
 
-func SubscribeToOrdersRequested(ctx context.Context, nc *nats.Conn, mo *db.Store, ff *flags.Flags) (*nats.Subscription, error) {
+func SubscribeToOrdersRequested(ctx context.Context, nc *nats.Conn, mo db.OrderRepository, ff *flags.Flags) (*nats.Subscription, error) {
 	ctx = logging.With(ctx, "fn", "SubscribeToOrdersRequested", "pkg", "NATS")
 	sub, err := nc.Subscribe("orders.all", func(m *nats.Msg) {
 		res, err := mo.GetAllOrders(ctx)
@@ -80,3 +76,96 @@ func SubscribeToOrdersRequested(ctx context.Context, nc *nats.Conn, mo *db.Store
 	})
 	return sub, err
 }
+
+func SubscribeToOrderRequested(ctx context.Context, nc *nats.Conn, mo db.OrderRepository) (*nats.Subscription, error) {
+	ctx = logging.With(ctx, "fn", "SubscribeToOrderRequested", "pkg", "NATS")
+	sub, err := nc.Subscribe("orders.get", func(m *nats.Msg) {
+		id := string(m.Data)
+		res, err := mo.GetOrder(ctx, id)
+		if err != nil {
+			logging.From(ctx).Error("failed to get order", "orderID", id, "error", err)
+			return
+		}
+
+		// A missing order marshals to null, which the gateway maps to a null field.
+		b, err := json.Marshal(res)
+		if err != nil {
+			logging.From(ctx).Error("failed to marshal order", "error", err)
+			return
+		}
+
+		logging.From(ctx).Info("responding to orders.get", "orderID", id, "found", res != nil)
+
+		if err := m.Respond(b); err != nil {
+			logging.From(ctx).Error("failed to respond to orders.get", "error", err)
+			return
+		}
+	})
+	return sub, err
+}
+
+// SubscribeToOrderTransitions appends order.confirmed, order.rejected and
+// order.canceled events to the order's history. Events for unknown orders,
+// or that do not apply to the order's status, are logged and dropped.
+func SubscribeToOrderTransitions(ctx context.Context, nc *nats.Conn, mo db.OrderRepository, ch *chaos.Injector) (*nats.Subscription, error) {
+	sub, err := nc.Subscribe("order.*", func(m *nats.Msg) {
+		if _, ok := transitionSubjects[m.Subject]; !ok {
+			return // order.created has its own handler
+		}
+
+		e, err := decodeTransition(m.Subject, m.Data)
+		if err != nil {
+			logging.From(ctx).Error("skipping event", "subject", m.Subject, "error", err, "data", string(m.Data))
+			return
+		}
+
+		ctx := logging.With(ctx, "subject", m.Subject, "orderId", e.OrderID, "eventId", e.EventID)
+
+		if err := ch.Inject(ctx, chaos.Handler); err != nil {
+			logging.From(ctx).Warn("skipping event", "error", err)
+			return
+		}
+
+		err = mo.AppendEvent(ctx, e)
+		switch {
+		case errors.Is(err, db.ErrOrderNotFound), errors.Is(err, db.ErrInvalidTransition):
+			logging.From(ctx).Warn("dropping order event", "error", err)
+		case err != nil:
+			logging.From(ctx).Error("failed to append order event", "error", err)
+		default:
+			logging.From(ctx).Info("order event appended", "type", e.Type)
+		}
+	})
+	return sub, err
+}
+
+func SubscribeToOrderHistoryRequested(ctx context.Context, nc *nats.Conn, mo db.OrderRepository) (*nats.Subscription, error) {
+	ctx = logging.With(ctx, "fn", "SubscribeToOrderHistoryRequested", "pkg", "NATS")
+	sub, err := nc.Subscribe("orders.history", func(m *nats.Msg) {
+		id := string(m.Data)
+		events, err := mo.GetHistory(ctx, id)
+		if err != nil {
+			logging.From(ctx).Error("failed to get order history", "orderID", id, "error", err)
+			return
+		}
+
+		// An unknown order has no history: an empty list, not null.
+		res := make([]model.OrderEvent, len(events))
+		for i, e := range events {
+			res[i] = e.Model()
+		}
+		b, err := json.Marshal(res)
+		if err != nil {
+			logging.From(ctx).Error("failed to marshal order history", "error", err)
+			return
+		}
+
+		logging.From(ctx).Info("responding to orders.history", "orderID", id, "count", len(res))
+
+		if err := m.Respond(b); err != nil {
+			logging.From(ctx).Error("failed to respond to orders.history", "error", err)
+			return
+		}
+	})
+	return sub, err
+}
@@ -0,0 +1,397 @@
+package handle_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"rxw1/flags/flagstest"
+	"rxw1/model"
+	"rxw1/ordersvc/internal/db"
+	"rxw1/ordersvc/internal/handle"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+func runNATS(t *testing.T) *nats.Conn {
+	t.Helper()
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	s := natsserver.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+func publish(t *testing.T, nc *nats.Conn, subject string, v any) {
+	t.Helper()
+	b, ok := v.([]byte)
+	if !ok {
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := nc.Publish(subject, b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handled publishes a sentinel event after the ones under test and returns
+// the stored orders once it lands. Messages on a subscription are handled in
+// order, so everything published before it has been processed.
+func handled(t *testing.T, nc *nats.Conn, repo db.OrderRepository) []model.Order {
+	t.Helper()
+	publish(t, nc, "order.created", handle.Event{ID: "sentinel", ProductID: "p0", Qty: 1, CreatedAt: time.Now().Format(time.RFC3339)})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		orders, err := repo.GetAllOrders(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(orders); n > 0 && orders[n-1].EventID == "sentinel" {
+			return orders[:n-1]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("events not handled")
+	return nil
+}
+
+func TestSubscribeToOrdersCreated(t *testing.T) {
+	ctx := context.Background()
+	const createdAt = "2025-03-04T05:06:07Z"
+	at := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	valid := handle.Event{ID: "o1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, CreatedAt: createdAt}
+	// valid as published before orders had items: one item, price unknown.
+	legacy := []*model.OrderItem{{ProductID: "p1", Qty: 2}}
+
+	tests := []struct {
+		name   string
+		events []any
+		want   []model.Order
+	}{
+		{
+			name:   "materializes",
+			events: []any{valid},
+			want:   []model.Order{{ID: "o1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, CreatedAt: at, Status: model.OrderStatusCreated, Items: legacy}},
+		},
+		{
+			name:   "redelivery stores once",
+			events: []any{valid, valid},
+			want:   []model.Order{{ID: "o1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, CreatedAt: at, Status: model.OrderStatusCreated, Items: legacy}},
+		},
+		{
+			name:   "same order with another event id stores once",
+			events: []any{valid, handle.Event{ID: "o1", EventID: "ev9", ProductID: "p2", UserID: "u1", Qty: 1, CreatedAt: createdAt}},
+			want:   []model.Order{{ID: "o1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, CreatedAt: at, Status: model.OrderStatusCreated, Items: legacy}},
+		},
+		{
+			name:   "skips event without id",
+			events: []any{handle.Event{EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, CreatedAt: createdAt}},
+		},
+		{
+			name:   "skips malformed json",
+			events: []any{[]byte("{"), valid},
+			want:   []model.Order{{ID: "o1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, CreatedAt: at, Status: model.OrderStatusCreated, Items: legacy}},
+		},
+		{
+			name: "items",
+			events: []any{handle.Event{ID: "o1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, CreatedAt: createdAt, Items: []handle.Item{
+				{ProductID: "p1", Name: "Widget", Price: ptr[int32](250), Qty: 2},
+				{ProductID: "p2", Name: "Gadget", Price: ptr[int32](100), Qty: 1},
+			}}},
+			want: []model.Order{{ID: "o1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, Price: ptr[int32](250), CreatedAt: at, Status: model.OrderStatusCreated,
+				Items: []*model.OrderItem{
+					{ProductID: "p1", Name: "Widget", Price: ptr[int32](250), Qty: 2, Subtotal: ptr[int32](500)},
+					{ProductID: "p2", Name: "Gadget", Price: ptr[int32](100), Qty: 1, Subtotal: ptr[int32](100)},
+				},
+				Total: ptr[int32](600),
+			}},
+		},
+		{
+			name: "skips invalid items",
+			events: []any{
+				handle.Event{ID: "ev1", UserID: "u1", CreatedAt: createdAt, Items: []handle.Item{{ProductID: "p1", Qty: 1}, {ProductID: "p1", Qty: 1}}},
+				handle.Event{ID: "ev2", UserID: "u1", CreatedAt: createdAt, Items: []handle.Item{{ProductID: "p1", Qty: 0}}},
+			},
+		},
+		{
+			name:   "skips bad timestamp",
+			events: []any{handle.Event{ID: "ev2", CreatedAt: "yesterday"}},
+		},
+		{
+			name: "idempotency key dedupes retries",
+			events: []any{
+				handle.Event{ID: "ev1", ProductID: "p1", UserID: "u1", Qty: 1, CreatedAt: createdAt, IdempotencyKey: "k1"},
+				handle.Event{ID: "ev2", ProductID: "p1", UserID: "u1", Qty: 1, CreatedAt: createdAt, IdempotencyKey: "k1"},
+			},
+			want: []model.Order{{ID: "ev1", EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 1, CreatedAt: at, Status: model.OrderStatusCreated,
+				Items: []*model.OrderItem{{ProductID: "p1", Qty: 1}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := runNATS(t)
+			ff, _ := flagstest.New(t, nil)
+			repo := db.NewMemory()
+
+			sub, err := handle.SubscribeToOrdersCreated(ctx, nc, repo, ff, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sub.Unsubscribe()
+
+			for _, e := range tt.events {
+				publish(t, nc, "order.created", e)
+			}
+			got := handled(t, nc, repo)
+			if len(got) != len(tt.want) {
+				t.Fatalf("stored %+v, want %+v", got, tt.want)
+			}
+			for i, w := range tt.want {
+				if !reflect.DeepEqual(got[i], w) {
+					t.Errorf("order %d = %+v, want %+v", i, got[i], w)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscribeToOrdersRequested(t *testing.T) {
+	ctx := context.Background()
+	nc := runNATS(t)
+	ff, _ := flagstest.New(t, nil)
+	repo := db.NewMemory()
+	_ = repo.AddOrder(ctx, "o1", "ev1", "", "u1", []db.Item{{ProductID: "p1", Qty: 1}}, time.Now())
+	_ = repo.AddOrder(ctx, "o2", "ev2", "", "u2", []db.Item{{ProductID: "p2", Qty: 2}}, time.Now())
+
+	sub, err := handle.SubscribeToOrdersRequested(ctx, nc, repo, ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	msg, err := nc.Request("orders.all", nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []model.Order
+	if err := json.Unmarshal(msg.Data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].EventID != "ev1" || got[1].EventID != "ev2" {
+		t.Errorf("orders.all = %+v", got)
+	}
+}
+
+func TestSubscribeToOrderRequested(t *testing.T) {
+	ctx := context.Background()
+	nc := runNATS(t)
+	repo := db.NewMemory()
+	_ = repo.AddOrder(ctx, "o1", "ev1", "", "u1", []db.Item{{ProductID: "p1", Qty: 1}}, time.Now())
+	orders, _ := repo.GetAllOrders(ctx)
+
+	sub, err := handle.SubscribeToOrderRequested(ctx, nc, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	tests := []struct {
+		name string
+		id   string
+		want *model.Order
+	}{
+		{name: "found", id: orders[0].ID, want: &orders[0]},
+		{name: "missing is null", id: "nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := nc.Request("orders.get", []byte(tt.id), time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got *model.Order
+			if err := json.Unmarshal(msg.Data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !reflect.DeepEqual(*got, *tt.want)) {
+				t.Errorf("orders.get %s = %+v, want %+v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscribeToOrderTransitions(t *testing.T) {
+	ctx := context.Background()
+	at := "2025-03-04T05:06:07Z"
+
+	tests := []struct {
+		name   string
+		events func(id string) []any // subject, payload pairs
+		want   []string
+	}{
+		{
+			name: "confirm then cancel",
+			events: func(id string) []any {
+				return []any{
+					"order.confirmed", handle.Transition{ID: id, EventID: "ev2", CreatedAt: at},
+					"order.canceled", handle.Transition{ID: id, EventID: "ev3", CreatedAt: at, Reason: "changed mind"},
+				}
+			},
+			want: []string{"CREATED", "CONFIRMED", "CANCELED"},
+		},
+		{
+			name: "redelivery appends once",
+			events: func(id string) []any {
+				e := handle.Transition{ID: id, EventID: "ev2", CreatedAt: at}
+				return []any{"order.rejected", e, "order.rejected", e}
+			},
+			want: []string{"CREATED", "REJECTED"},
+		},
+		{
+			name: "drops invalid transitions",
+			events: func(id string) []any {
+				return []any{
+					"order.canceled", handle.Transition{ID: id, EventID: "ev2", CreatedAt: at},
+					"order.confirmed", handle.Transition{ID: id, EventID: "ev3", CreatedAt: at},
+				}
+			},
+			want: []string{"CREATED", "CANCELED"},
+		},
+		{
+			name: "skips malformed and unknown orders",
+			events: func(id string) []any {
+				return []any{
+					"order.canceled", []byte("{"),
+					"order.canceled", handle.Transition{ID: id, CreatedAt: at},
+					"order.canceled", handle.Transition{ID: id, EventID: "ev2", CreatedAt: "yesterday"},
+					"order.canceled", handle.Transition{ID: "missing", EventID: "ev3", CreatedAt: at},
+					"order.confirmed", handle.Transition{ID: id, EventID: "ev4", CreatedAt: at},
+				}
+			},
+			want: []string{"CREATED", "CONFIRMED"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := runNATS(t)
+			repo := db.NewMemory()
+			_ = repo.AddOrder(ctx, "o1", "ev1", "", "u1", []db.Item{{ProductID: "p1", Qty: 1}}, time.Now())
+			_ = repo.AddOrder(ctx, "sentinel", "sentinel", "", "u1", []db.Item{{ProductID: "p1", Qty: 1}}, time.Now())
+			orders, _ := repo.GetAllOrders(ctx)
+			id, sentinel := orders[0].ID, orders[1].ID
+
+			sub, err := handle.SubscribeToOrderTransitions(ctx, nc, repo, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sub.Unsubscribe()
+
+			events := tt.events(id)
+			for i := 0; i < len(events); i += 2 {
+				publish(t, nc, events[i].(string), events[i+1])
+			}
+			// Handled in order, so the sentinel order lands last.
+			publish(t, nc, "order.canceled", handle.Transition{ID: sentinel, EventID: "sentinel-cancel", CreatedAt: at})
+			waitFor(t, func() bool {
+				h, _ := repo.GetHistory(ctx, sentinel)
+				return len(h) == 2
+			})
+
+			history, err := repo.GetHistory(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range history {
+				got = append(got, e.Type)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("history = %v, want %v", got, tt.want)
+			}
+			o, _ := repo.GetOrder(ctx, id)
+			if want := tt.want[len(tt.want)-1]; string(o.Status) != want {
+				t.Errorf("status = %s, want %s", o.Status, want)
+			}
+		})
+	}
+}
+
+func TestSubscribeToOrderHistoryRequested(t *testing.T) {
+	ctx := context.Background()
+	nc := runNATS(t)
+	repo := db.NewMemory()
+	at := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	_ = repo.AddOrder(ctx, "o1", "ev1", "", "u1", []db.Item{{ProductID: "p1", Qty: 1}}, at)
+	orders, _ := repo.GetAllOrders(ctx)
+	id := orders[0].ID
+	_ = repo.AppendEvent(ctx, db.OrderEvent{OrderID: id, Type: db.EventCanceled, EventID: "ev2", At: at, Reason: "changed mind"})
+
+	sub, err := handle.SubscribeToOrderHistoryRequested(ctx, nc, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	reason := "changed mind"
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{
+			name: "found",
+			id:   id,
+			want: mustJSON(t, []model.OrderEvent{
+				{Seq: 1, Type: model.OrderEventTypeCreated, EventID: "ev1", At: at},
+				{Seq: 2, Type: model.OrderEventTypeCanceled, EventID: "ev2", At: at, Reason: &reason},
+			}),
+		},
+		{name: "missing is empty", id: "nope", want: "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := nc.Request("orders.history", []byte(tt.id), time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(msg.Data); got != tt.want {
+				t.Errorf("orders.history %s = %s, want %s", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,41 @@
+package handle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// throttleInterval spaces order events while the throttleEnabled flag is on.
+const throttleInterval = 200 * time.Millisecond
+
+// pacer lets callers through at most once per interval.
+type pacer struct {
+	mu       sync.Mutex
+	next     time.Time
+	interval time.Duration
+}
+
+// wait blocks until the caller's slot or until ctx is done.
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	d := p.next.Sub(now)
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
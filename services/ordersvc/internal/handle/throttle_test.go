@@ -0,0 +1,31 @@
+package handle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPacer_Wait(t *testing.T) {
+	p := &pacer{interval: 20 * time.Millisecond}
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 4 {
+		if err := p.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// First call passes immediately, the next three wait one interval each.
+	if got := time.Since(start); got < 60*time.Millisecond {
+		t.Errorf("4 calls took %v, want >= 60ms", got)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	p = &pacer{interval: time.Hour}
+	_ = p.wait(ctx)
+	if err := p.wait(ctx); err != context.Canceled {
+		t.Errorf("wait() on canceled ctx = %v, want context.Canceled", err)
+	}
+}
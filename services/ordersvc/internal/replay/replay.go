@@ -0,0 +1,196 @@
+// Package replay reads past order events back, from the handle.Stream
+// JetStream stream or an NDJSON export of it, so ordersctl can run them
+// through the handlers again.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"rxw1/logging"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrSkip, returned by an apply func, counts the record as skipped rather
+// than failed.
+var ErrSkip = errors.New("replay: skip")
+
+// Record is one published order event. It is also one line of the NDJSON
+// export format:
+//
+//	{"subject":"order.created","time":"2025-03-04T05:06:07Z","data":{...}}
+type Record struct {
+	Subject string          `json:"subject"`
+	Time    time.Time       `json:"time"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Source yields records until it returns io.EOF.
+type Source interface {
+	Next(ctx context.Context) (Record, error)
+}
+
+// Filter selects records published in [Since, Until). Zero bounds are open.
+type Filter struct {
+	Since, Until time.Time
+}
+
+func (f Filter) Match(r Record) bool {
+	return (f.Since.IsZero() || !r.Time.Before(f.Since)) && (f.Until.IsZero() || r.Time.Before(f.Until))
+}
+
+// Stats counts what Run did with the records it read.
+type Stats struct {
+	Read    int // from the source
+	Skipped int // outside the filter, or skipped by apply
+	Applied int // including events the store already had
+	Failed  int
+}
+
+// Run passes every record of src that f matches to apply, in order. Failed
+// records are logged and counted and do not stop the run; a source error
+// does.
+func Run(ctx context.Context, src Source, f Filter, apply func(context.Context, Record) error) (Stats, error) {
+	var st Stats
+	for {
+		r, err := src.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return st, nil
+		}
+		if err != nil {
+			return st, err
+		}
+		st.Read++
+		if !f.Match(r) {
+			st.Skipped++
+			continue
+		}
+
+		switch err := apply(ctx, r); {
+		case errors.Is(err, ErrSkip):
+			st.Skipped++
+		case err != nil:
+			st.Failed++
+			logging.From(ctx).Warn("replay failed", "subject", r.Subject, "time", r.Time, "error", err, "data", string(r.Data))
+		default:
+			st.Applied++
+		}
+	}
+}
+
+// NDJSONWriter returns an apply func for Run that writes each record to w
+// in the format NDJSON reads.
+func NDJSONWriter(w io.Writer) func(context.Context, Record) error {
+	enc := json.NewEncoder(w)
+	return func(_ context.Context, r Record) error { return enc.Encode(r) }
+}
+
+type ndjson struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+// NDJSON reads records from r, one JSON object per line. A record without
+// a time gets the createdAt of its payload, so hand-written files can be
+// filtered too.
+func NDJSON(r io.Reader) Source {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	return &ndjson{sc: sc}
+}
+
+func (n *ndjson) Next(context.Context) (Record, error) {
+	for n.sc.Scan() {
+		n.line++
+		b := bytes.TrimSpace(n.sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(b, &r); err != nil {
+			return Record{}, fmt.Errorf("replay: line %d: %w", n.line, err)
+		}
+		if r.Subject == "" {
+			return Record{}, fmt.Errorf("replay: line %d: no subject", n.line)
+		}
+		if r.Time.IsZero() {
+			var p struct{ CreatedAt time.Time }
+			_ = json.Unmarshal(r.Data, &p)
+			r.Time = p.CreatedAt
+		}
+		return r, nil
+	}
+	if err := n.sc.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// StreamSource reads a JetStream stream through an ordered consumer.
+type StreamSource struct {
+	sub     *nats.Subscription
+	lastSeq uint64
+}
+
+// JetStream reads stream oldest first, from since or from the beginning
+// when since is zero. It ends at the last message stored when it was
+// opened, so a busy stream does not keep it running.
+func JetStream(nc *nats.Conn, stream string, since time.Time) (*StreamSource, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	info, err := js.StreamInfo(stream)
+	if err != nil {
+		return nil, fmt.Errorf("replay: stream %s: %w", stream, err)
+	}
+	s := &StreamSource{lastSeq: info.State.LastSeq}
+	if info.State.Msgs == 0 || !since.IsZero() && info.State.LastTime.Before(since) {
+		return s, nil
+	}
+
+	start := nats.DeliverAll()
+	if !since.IsZero() {
+		start = nats.StartTime(since)
+	}
+	s.sub, err = js.SubscribeSync("", nats.BindStream(stream), nats.OrderedConsumer(), start)
+	if err != nil {
+		return nil, fmt.Errorf("replay: stream %s: %w", stream, err)
+	}
+	return s, nil
+}
+
+func (s *StreamSource) Next(ctx context.Context) (Record, error) {
+	if s.sub == nil {
+		return Record{}, io.EOF
+	}
+	msg, err := s.sub.NextMsgWithContext(ctx)
+	if err != nil {
+		return Record{}, err
+	}
+	meta, err := msg.Metadata()
+	if err != nil {
+		return Record{}, err
+	}
+	if meta.Sequence.Stream >= s.lastSeq {
+		_ = s.Close()
+	}
+	return Record{Subject: msg.Subject, Time: meta.Timestamp.UTC(), Data: msg.Data}, nil
+}
+
+// Close stops the consumer. Next returns io.EOF afterwards.
+func (s *StreamSource) Close() error {
+	if s.sub == nil {
+		return nil
+	}
+	sub := s.sub
+	s.sub = nil
+	return sub.Unsubscribe()
+}
@@ -0,0 +1,248 @@
+package replay_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"rxw1/ordersvc/internal/db"
+	"rxw1/ordersvc/internal/handle"
+	"rxw1/ordersvc/internal/replay"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+var at = time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+
+func record(t *testing.T, subject string, ts time.Time, v any) replay.Record {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return replay.Record{Subject: subject, Time: ts, Data: b}
+}
+
+// slice is a Source over records.
+type slice []replay.Record
+
+func (s *slice) Next(context.Context) (replay.Record, error) {
+	if len(*s) == 0 {
+		return replay.Record{}, io.EOF
+	}
+	r := (*s)[0]
+	*s = (*s)[1:]
+	return r, nil
+}
+
+func TestNDJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		want     []replay.Record
+		wantFail bool
+	}{
+		{
+			name: "records",
+			in: `{"subject":"order.created","time":"2025-03-04T05:06:07Z","data":{"ID":"ev1"}}
+
+{"subject":"order.canceled","time":"2025-03-04T06:06:07Z","data":{"ID":"o1"}}
+`,
+			want: []replay.Record{
+				{Subject: "order.created", Time: at, Data: json.RawMessage(`{"ID":"ev1"}`)},
+				{Subject: "order.canceled", Time: at.Add(time.Hour), Data: json.RawMessage(`{"ID":"o1"}`)},
+			},
+		},
+		{
+			name: "time from createdAt",
+			in:   `{"subject":"order.created","data":{"ID":"ev1","CreatedAt":"2025-03-04T05:06:07Z"}}`,
+			want: []replay.Record{{Subject: "order.created", Time: at, Data: json.RawMessage(`{"ID":"ev1","CreatedAt":"2025-03-04T05:06:07Z"}`)}},
+		},
+		{name: "not json", in: "order.created {}\n", wantFail: true},
+		{name: "no subject", in: `{"data":{}}`, wantFail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := replay.NDJSON(strings.NewReader(tt.in))
+			var got []replay.Record
+			for {
+				r, err := src.Next(context.Background())
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					if !tt.wantFail {
+						t.Fatal(err)
+					}
+					return
+				}
+				got = append(got, r)
+			}
+			if tt.wantFail {
+				t.Fatalf("read %v, want an error", got)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("read %d records, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].Subject != tt.want[i].Subject || !got[i].Time.Equal(tt.want[i].Time) || !bytes.Equal(got[i].Data, tt.want[i].Data) {
+					t.Errorf("record %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	created := func(id string, ts time.Time) replay.Record {
+		return record(t, "order.created", ts, handle.Event{ID: id, ProductID: "p1", UserID: "u1", Qty: 1, CreatedAt: ts.Format(time.RFC3339)})
+	}
+	records := slice{
+		created("ev1", at),
+		created("ev2", at.Add(time.Hour)),
+		record(t, "order.shipped", at.Add(time.Hour), struct{}{}),
+		record(t, "order.created", at.Add(time.Hour), "not an event"),
+		created("ev3", at.Add(2*time.Hour)),
+	}
+	apply := func(repo db.OrderRepository) func(context.Context, replay.Record) error {
+		return func(ctx context.Context, r replay.Record) error {
+			err := handle.Handle(ctx, repo, r.Subject, r.Data)
+			if errors.Is(err, handle.ErrUnknownSubject) {
+				return replay.ErrSkip
+			}
+			return err
+		}
+	}
+
+	tests := []struct {
+		name       string
+		filter     replay.Filter
+		want       replay.Stats
+		wantOrders int
+	}{
+		{name: "all", want: replay.Stats{Read: 5, Skipped: 1, Applied: 3, Failed: 1}, wantOrders: 3},
+		{
+			name:       "since",
+			filter:     replay.Filter{Since: at.Add(time.Hour)},
+			want:       replay.Stats{Read: 5, Skipped: 2, Applied: 2, Failed: 1},
+			wantOrders: 2,
+		},
+		{
+			name:       "until",
+			filter:     replay.Filter{Until: at.Add(time.Hour)},
+			want:       replay.Stats{Read: 5, Skipped: 4, Applied: 1},
+			wantOrders: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := db.NewMemory()
+			// The second run finds every event stored and changes nothing.
+			for range 2 {
+				src := append(slice(nil), records...)
+				got, err := replay.Run(context.Background(), &src, tt.filter, apply(repo))
+				if err != nil || got != tt.want {
+					t.Fatalf("Run() = %+v, %v, want %+v", got, err, tt.want)
+				}
+			}
+			orders, err := repo.GetAllOrders(context.Background())
+			if err != nil || len(orders) != tt.wantOrders {
+				t.Errorf("GetAllOrders() = %v, %v, want %d orders", orders, err, tt.wantOrders)
+			}
+		})
+	}
+}
+
+func runJetStream(t *testing.T) *nats.Conn {
+	t.Helper()
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	s := natsserver.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	if err := handle.EnsureStream(nc, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	return nc
+}
+
+// TestJetStream publishes an order's events the way the services do, exports
+// them from the stream and replays the export into an empty store.
+func TestJetStream(t *testing.T) {
+	nc := runJetStream(t)
+	ctx := context.Background()
+
+	src, err := replay.JetStream(nc, handle.Stream, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Next(ctx); !errors.Is(err, io.EOF) {
+		t.Fatalf("Next() on an empty stream = %v, want EOF", err)
+	}
+
+	const orderID = "o1"
+	for _, r := range []replay.Record{
+		record(t, "order.created", at, handle.Event{ID: orderID, EventID: "ev1", ProductID: "p1", UserID: "u1", Qty: 2, CreatedAt: at.Format(time.RFC3339)}),
+		record(t, "order.canceled", at, handle.Transition{ID: orderID, EventID: "ev2", CreatedAt: at.Format(time.RFC3339), Reason: "changed my mind"}),
+	} {
+		if err := nc.Publish(r.Subject, r.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	js, _ := nc.JetStream()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, err := js.StreamInfo(handle.Stream)
+		if err == nil && info.State.Msgs == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stream has %+v, %v, want 2 messages", info, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if src, err = replay.JetStream(nc, handle.Stream, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Next(ctx); !errors.Is(err, io.EOF) {
+		t.Fatalf("Next() since after the last message = %v, want EOF", err)
+	}
+
+	if src, err = replay.JetStream(nc, handle.Stream, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	st, err := replay.Run(ctx, src, replay.Filter{}, replay.NDJSONWriter(&buf))
+	if err != nil || st.Applied != 2 {
+		t.Fatalf("export = %+v, %v, want 2 records", st, err)
+	}
+
+	repo := db.NewMemory()
+	st, err = replay.Run(ctx, replay.NDJSON(&buf), replay.Filter{}, func(ctx context.Context, r replay.Record) error {
+		return handle.Handle(ctx, repo, r.Subject, r.Data)
+	})
+	if err != nil || st != (replay.Stats{Read: 2, Applied: 2}) {
+		t.Fatalf("replay = %+v, %v", st, err)
+	}
+	history, err := repo.GetHistory(ctx, orderID)
+	if err != nil || len(history) != 2 || history[1].Type != db.EventCanceled {
+		t.Errorf("GetHistory() = %+v, %v, want CREATED then CANCELED", history, err)
+	}
+}
@@ -2,21 +2,27 @@ package main
 
 import (
 	"context"
+	"embed"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"rxw1/chaos"
 	"rxw1/flags"
 	"rxw1/logging"
 	"rxw1/ordersvc/internal/db"
 	"rxw1/ordersvc/internal/handle"
+	"rxw1/ordersvc/server"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/cors"
 	"github.com/nats-io/nats.go"
 )
 
+//go:embed migrations/*.json
+var migrationsFS embed.FS
+
 const (
 	port = 8082
 	name = "ordersvc"
@@ -24,7 +30,8 @@ const (
 
 func main() {
 	logger, err := logging.NewTint(logging.Config{
-		Service: name,
+		Service:  name,
+		Sampling: logging.DefaultSampling(),
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -32,16 +39,35 @@ func main() {
 	ctx := logging.Into(context.Background(), logger)
 	logging.From(ctx).Info("boot", "pid", os.Getpid())
 
-	// Flags
-	ff := flags.New("ordersvc")
-
 	// MongoDB
-	mo, err := db.Connect(ctx, os.Getenv("MONGO_URI"))
+	mo, err := db.Connect(ctx, db.Config{
+		URI:            os.Getenv("MONGO_URI"),
+		Database:       os.Getenv("MONGO_DATABASE"),
+		Collection:     os.Getenv("MONGO_COLLECTION"),
+		Events:         os.Getenv("MONGO_EVENTS_COLLECTION"),
+		ConnectTimeout: durationFromEnv("MONGO_CONNECT_TIMEOUT", 0),
+		Timeout:        durationFromEnv("MONGO_TIMEOUT", 0),
+		MaxPoolSize:    uint64(intFromEnv("MONGO_MAX_POOL_SIZE", 0)),
+		MinPoolSize:    uint64(intFromEnv("MONGO_MIN_POOL_SIZE", 0)),
+		PingAttempts:   intFromEnv("MONGO_PING_ATTEMPTS", 0),
+	})
 	if err != nil {
 		logging.From(ctx).Error("", "error", err.Error())
 		os.Exit(1)
 	}
 
+	// Migrations
+	if os.Getenv("AUTO_MIGRATE") == "true" {
+		if err := db.Migrate(ctx, mo, migrationsFS); err != nil {
+			logging.From(ctx).Error("mongo migration failed", "error", err)
+			os.Exit(1)
+		}
+	}
+	if err := mo.EnsureSchema(ctx); err != nil {
+		logging.From(ctx).Error("mongo schema", "error", err)
+		os.Exit(1)
+	}
+
 	// NATS
 	nc, err := nats.Connect(os.Getenv("NATS_URL"))
 	if err != nil {
@@ -50,44 +76,56 @@ func main() {
 	}
 	defer nc.Drain()
 
-	// Subscribers
-	sub, err := handle.SubscribeToOrdersCreated(ctx, nc, mo, ff)
-	if err != nil {
-		logging.From(ctx).Error("", "error", err.Error())
-		os.Exit(1)
+	// Keep order events in JetStream for ordersctl replay
+	if err := handle.EnsureStream(nc, durationFromEnv("ORDERS_STREAM_MAX_AGE", 30*24*time.Hour)); err != nil {
+		logging.From(ctx).Warn("order event stream unavailable, events will not be kept for replay", "error", err)
+	}
+
+	// Flags, with runtime overrides shared over NATS KV
+	var flagOpts []flags.Option
+	if ov, err := flags.NewOverrides(ctx, nc); err != nil {
+		logging.From(ctx).Warn("flag overrides unavailable, flags are read-only", "error", err)
+	} else {
+		flagOpts = append(flagOpts, flags.WithOverrides(ov))
 	}
-	defer sub.Unsubscribe()
+	flagOpts = append(flagOpts, flags.WithEnvironment(os.Getenv("ENVIRONMENT")))
+	ff := flags.New(name, flagOpts...)
+
+	// Fault injection, off unless the chaos flag is set
+	ch := chaos.New(name, func(ctx context.Context) chaos.Config {
+		return flags.Object[chaos.Config](ctx, ff, flags.Chaos, nil)
+	})
+	mo.CH = ch
 
-	sub2, err := handle.SubscribeToOrdersRequested(ctx, nc, mo, ff)
+	srv, err := server.New(ctx, nc, mo, ff, ch)
 	if err != nil {
 		logging.From(ctx).Error("", "error", err.Error())
 		os.Exit(1)
 	}
-	defer sub2.Unsubscribe()
-
-	// Chi
-	r := chi.NewRouter()
-
-	// CORS
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300,
-	}))
-
-	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	})
+	defer srv.Close()
 
 	// Start server
-	err = http.ListenAndServe(fmt.Sprintf(":%d", port), r)
+	err = http.ListenAndServe(fmt.Sprintf(":%d", port), srv)
 	if err != nil {
 		logging.From(ctx).Error("server startup failed", "port", port, "svc", name)
 		os.Exit(1)
 	}
 	logging.From(ctx).Info("server ready", "port", port, "svc", name)
 }
+
+// intFromEnv parses the env var key as an int or returns def.
+func intFromEnv(key string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
+
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,90 @@
+// Package server wires ordersvc's NATS handlers and HTTP routes so the
+// service can run from main or in-process in integration tests.
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"rxw1/chaos"
+	"rxw1/flags"
+	"rxw1/ordersvc/internal/db"
+	"rxw1/ordersvc/internal/handle"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/cors"
+	"github.com/nats-io/nats.go"
+)
+
+// Repository is the order storage the service runs on. main uses MongoDB.
+type Repository = db.OrderRepository
+
+// Memory is an in-process Repository, for tests and local runs.
+type Memory = db.Memory
+
+// NewMemory returns an empty Memory.
+func NewMemory() *Memory { return db.NewMemory() }
+
+// Server appends order events to a store, answers order and history
+// requests over NATS and serves the health endpoint.
+type Server struct {
+	http.Handler
+	subs []*nats.Subscription
+}
+
+// New subscribes the order handlers against store. A nil ch injects no
+// faults.
+func New(ctx context.Context, nc *nats.Conn, store Repository, ff *flags.Flags, ch *chaos.Injector) (*Server, error) {
+	s := &Server{}
+	add := func(sub *nats.Subscription, err error) error {
+		if err != nil {
+			s.Close()
+			return err
+		}
+		s.subs = append(s.subs, sub)
+		return nil
+	}
+
+	if err := add(handle.SubscribeToOrdersCreated(ctx, nc, store, ff, ch)); err != nil {
+		return nil, err
+	}
+	if err := add(handle.SubscribeToOrdersRequested(ctx, nc, store, ff)); err != nil {
+		return nil, err
+	}
+	if err := add(handle.SubscribeToOrderRequested(ctx, nc, store)); err != nil {
+		return nil, err
+	}
+	if err := add(handle.SubscribeToOrderTransitions(ctx, nc, store, ch)); err != nil {
+		return nil, err
+	}
+	if err := add(handle.SubscribeToOrderHistoryRequested(ctx, nc, store)); err != nil {
+		return nil, err
+	}
+
+	r := chi.NewRouter()
+
+	// CORS
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: false,
+		MaxAge:           300,
+	}))
+
+	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	s.Handler = r
+	return s, nil
+}
+
+// Close unsubscribes the handlers.
+func (s *Server) Close() {
+	for _, sub := range s.subs {
+		_ = sub.Unsubscribe()
+	}
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"rxw1/model"
+)
+
+// Memory is an in-process ProductRepository for tests and local runs. It
+// lists products in insertion order.
+type Memory struct {
+	mu       sync.Mutex
+	products []model.Product
+}
+
+func NewMemory(products ...model.Product) *Memory {
+	m := &Memory{}
+	for _, p := range products {
+		m.Put(p)
+	}
+	return m
+}
+
+// Put adds p, replacing any product with the same id.
+func (m *Memory) Put(p model.Product) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := slices.IndexFunc(m.products, func(x model.Product) bool { return x.ID == p.ID }); i >= 0 {
+		m.products[i] = p
+		return
+	}
+	m.products = append(m.products, p)
+}
+
+func (m *Memory) GetProduct(_ context.Context, id string) (*model.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.products {
+		if p.ID == id {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetProducts(context.Context) ([]*model.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	products := make([]*model.Product, 0, len(m.products))
+	for _, p := range m.products {
+		products = append(products, &p)
+	}
+	return products, nil
+}
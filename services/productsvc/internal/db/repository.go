@@ -0,0 +1,20 @@
+package db
+
+import (
+	"context"
+
+	"rxw1/model"
+)
+
+// ProductRepository reads products. PG implements it on Postgres and Memory
+// in process; both pass the same contract tests.
+type ProductRepository interface {
+	// GetProduct returns the product with the given id, or nil if there is none.
+	GetProduct(ctx context.Context, id string) (*model.Product, error)
+	GetProducts(ctx context.Context) ([]*model.Product, error)
+}
+
+var (
+	_ ProductRepository = (*PG)(nil)
+	_ ProductRepository = (*Memory)(nil)
+)
@@ -0,0 +1,99 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"rxw1/model"
+	"rxw1/productsvc/internal/db"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// testProductRepository is the contract every ProductRepository must meet.
+// newRepo returns a repository holding at least the given products; it may
+// hold others too.
+func testProductRepository(t *testing.T, newRepo func(t *testing.T, products ...model.Product) db.ProductRepository) {
+	ctx := context.Background()
+	id := func() string { return "test-" + ulid.Make().String() }
+	a := model.Product{ID: id(), Name: "Widget " + ulid.Make().String(), Price: 100}
+	b := model.Product{ID: id(), Name: "Gadget " + ulid.Make().String(), Price: 250}
+	r := newRepo(t, a, b)
+
+	tests := []struct {
+		name string
+		id   string
+		want *model.Product
+	}{
+		{name: "found", id: a.ID, want: &a},
+		{name: "found other", id: b.ID, want: &b},
+		{name: "missing is nil", id: id()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.GetProduct(ctx, tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("GetProduct(%s) = %+v, want %+v", tt.id, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("list", func(t *testing.T) {
+		all, err := r.GetProducts(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := map[string]model.Product{}
+		for _, p := range all {
+			found[p.ID] = *p
+		}
+		for _, want := range []model.Product{a, b} {
+			if found[want.ID] != want {
+				t.Errorf("GetProducts() has %+v, want %+v", found[want.ID], want)
+			}
+		}
+	})
+
+	t.Run("results are copies", func(t *testing.T) {
+		p, _ := r.GetProduct(ctx, a.ID)
+		p.Price = 1
+		if again, _ := r.GetProduct(ctx, a.ID); again.Price != a.Price {
+			t.Errorf("price after mutating a result = %d, want %d", again.Price, a.Price)
+		}
+	})
+}
+
+func TestMemory(t *testing.T) {
+	testProductRepository(t, func(_ *testing.T, products ...model.Product) db.ProductRepository {
+		return db.NewMemory(products...)
+	})
+}
+
+// TestPG runs the contract against a migrated Postgres at DATABASE_URL. Its
+// rows are removed afterwards.
+func TestPG(t *testing.T) {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pg, err := db.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pg.Pool.Close)
+
+	testProductRepository(t, func(t *testing.T, products ...model.Product) db.ProductRepository {
+		for _, p := range products {
+			if _, err := pg.Pool.Exec(ctx, `insert into products (id, name, price) values ($1, $2, $3)`, p.ID, p.Name, p.Price); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _, _ = pg.Pool.Exec(ctx, `delete from products where id=$1`, p.ID) })
+		}
+		return pg
+	})
+}
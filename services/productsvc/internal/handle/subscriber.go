@@ -10,10 +10,10 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
-func AllProducts(ctx context.Context, nc *nats.Conn, db *db.PG) (*nats.Subscription, error) {
+func AllProducts(ctx context.Context, nc *nats.Conn, repo db.ProductRepository) (*nats.Subscription, error) {
 	ctx = logging.With(ctx, "fn", "AllProducts", "pkg", "NATS")
 	sub, err := nc.Subscribe("products.all", func(m *nats.Msg) {
-		res, err := db.GetProducts(ctx)
+		res, err := repo.GetProducts(ctx)
 		if err != nil {
 			logging.From(ctx).Error("failed to get all products", "error", err)
 			return
@@ -34,3 +34,30 @@ func AllProducts(ctx context.Context, nc *nats.Conn, db *db.PG) (*nats.Subscript
 	})
 	return sub, err
 }
+
+func ProductByID(ctx context.Context, nc *nats.Conn, repo db.ProductRepository) (*nats.Subscription, error) {
+	ctx = logging.With(ctx, "fn", "ProductByID", "pkg", "NATS")
+	sub, err := nc.Subscribe("products.get", func(m *nats.Msg) {
+		id := string(m.Data)
+		res, err := repo.GetProduct(ctx, id)
+		if err != nil {
+			logging.From(ctx).Error("failed to get product", "productID", id, "error", err)
+			return
+		}
+
+		// A missing product marshals to null so the gateway can cache the miss.
+		b, err := json.Marshal(res)
+		if err != nil {
+			logging.From(ctx).Error("failed to marshal product", "error", err)
+			return
+		}
+
+		logging.From(ctx).Info("responding to products.get", "productID", id, "found", res != nil)
+
+		if err := m.Respond(b); err != nil {
+			logging.From(ctx).Error("failed to respond to products.get", "error", err)
+			return
+		}
+	})
+	return sub, err
+}
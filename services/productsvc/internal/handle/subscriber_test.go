@@ -0,0 +1,85 @@
+package handle_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"rxw1/model"
+	"rxw1/productsvc/internal/db"
+	"rxw1/productsvc/internal/handle"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+func runNATS(t *testing.T) *nats.Conn {
+	t.Helper()
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	s := natsserver.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+var (
+	widget = model.Product{ID: "p1", Name: "Widget", Price: 100}
+	gadget = model.Product{ID: "p2", Name: "Gadget", Price: 250}
+)
+
+func TestAllProducts(t *testing.T) {
+	nc := runNATS(t)
+	sub, err := handle.AllProducts(context.Background(), nc, db.NewMemory(widget, gadget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	msg, err := nc.Request("products.all", nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []model.Product
+	if err := json.Unmarshal(msg.Data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != widget || got[1] != gadget {
+		t.Errorf("products.all = %+v", got)
+	}
+}
+
+func TestProductByID(t *testing.T) {
+	nc := runNATS(t)
+	sub, err := handle.ProductByID(context.Background(), nc, db.NewMemory(widget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{name: "found", id: "p1", want: `{"id":"p1","price":100,"name":"Widget"}`},
+		{name: "missing is null", id: "nope", want: "null"}, // the gateway caches the miss
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := nc.Request("products.get", []byte(tt.id), time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(msg.Data) != tt.want {
+				t.Errorf("products.get %s = %s, want %s", tt.id, msg.Data, tt.want)
+			}
+		})
+	}
+}
@@ -11,10 +11,8 @@ import (
 
 	"rxw1/logging"
 	"rxw1/productsvc/internal/db"
-	"rxw1/productsvc/internal/handle"
+	"rxw1/productsvc/server"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/cors"
 	"github.com/nats-io/nats.go"
 )
 
@@ -28,7 +26,8 @@ const (
 
 func main() {
 	logger, err := logging.NewTint(logging.Config{
-		Service: name,
+		Service:  name,
+		Sampling: logging.DefaultSampling(),
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -60,33 +59,15 @@ func main() {
 	}
 	defer nc.Drain()
 
-	// Subscribers
-	sub, err := handle.AllProducts(ctx, nc, pg)
+	srv, err := server.New(ctx, nc, pg)
 	if err != nil {
+		logging.From(ctx).Error("subscribe failed", "error", err)
 		os.Exit(1)
 	}
-	defer sub.Unsubscribe()
-
-	// Chi
-	r := chi.NewRouter()
-
-	// CORS
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300,
-	}))
-
-	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
-	})
+	defer srv.Close()
 
 	// Start server
-	err = http.ListenAndServe(fmt.Sprintf(":%d", port), r)
+	err = http.ListenAndServe(fmt.Sprintf(":%d", port), srv)
 	if err != nil {
 		logging.From(ctx).Error("server startup failed", "port", port, "svc", name)
 		os.Exit(1)
@@ -0,0 +1,78 @@
+// Package server wires productsvc's NATS handlers and HTTP routes so the
+// service can run from main or in-process in integration tests.
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"rxw1/model"
+	"rxw1/productsvc/internal/db"
+	"rxw1/productsvc/internal/handle"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/cors"
+	"github.com/nats-io/nats.go"
+)
+
+// Repository is the product storage the service runs on. main uses Postgres.
+type Repository = db.ProductRepository
+
+// Memory is an in-process Repository, for tests and local runs.
+type Memory = db.Memory
+
+// NewMemory returns a Memory holding products.
+func NewMemory(products ...model.Product) *Memory { return db.NewMemory(products...) }
+
+// Server answers product requests over NATS and serves the health endpoint.
+type Server struct {
+	http.Handler
+	subs []*nats.Subscription
+}
+
+// New subscribes the product handlers, reading from store.
+func New(ctx context.Context, nc *nats.Conn, store Repository) (*Server, error) {
+	s := &Server{}
+	add := func(sub *nats.Subscription, err error) error {
+		if err != nil {
+			s.Close()
+			return err
+		}
+		s.subs = append(s.subs, sub)
+		return nil
+	}
+
+	if err := add(handle.AllProducts(ctx, nc, store)); err != nil {
+		return nil, err
+	}
+	if err := add(handle.ProductByID(ctx, nc, store)); err != nil {
+		return nil, err
+	}
+
+	r := chi.NewRouter()
+
+	// CORS
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: false,
+		MaxAge:           300,
+	}))
+
+	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	s.Handler = r
+	return s, nil
+}
+
+// Close unsubscribes the handlers.
+func (s *Server) Close() {
+	for _, sub := range s.subs {
+		_ = sub.Unsubscribe()
+	}
+}
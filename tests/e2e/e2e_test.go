@@ -2,6 +2,10 @@ package e2e
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"os"
 	"testing"
 	"time"
@@ -21,8 +25,9 @@ func Test_CreateOrder_MaterializesInMongo(t *testing.T) {
 
 	// 1) Mutation ausführen
 	req := graphql.NewRequest(`mutation($pid:ID!,$qty:Int!){ createOrder(productId:$pid, qty:$qty){ id productId qty createdAt } }`)
-	req.Var("pid", "p1")
+	req.Var("pid", seededProduct(t, client))
 	req.Var("qty", 1)
+	req.Header.Set("Authorization", "Bearer "+token(t, "e2e-user"))
 	var resp struct {
 		CreateOrder struct {
 			ID, ProductID, CreatedAt string
@@ -57,6 +62,52 @@ func Test_CreateOrder_MaterializesInMongo(t *testing.T) {
 	}
 }
 
+func Test_CreateOrder_IdempotencyKeyReplays(t *testing.T) {
+	graphqlURL := getenv("GRAPHQL_URL", "http://localhost:8080/graphql")
+
+	ctx := context.Background()
+	client := graphql.NewClient(graphqlURL)
+	key := "e2e-" + time.Now().Format(time.RFC3339Nano)
+	bearer := "Bearer " + token(t, "e2e-user")
+	pid := seededProduct(t, client)
+
+	create := func() string {
+		req := graphql.NewRequest(`mutation($pid:ID!,$qty:Int!,$key:String){ createOrder(productId:$pid, qty:$qty, idempotencyKey:$key){ id } }`)
+		req.Var("pid", pid)
+		req.Var("qty", 1)
+		req.Var("key", key)
+		req.Header.Set("Authorization", bearer)
+		var resp struct {
+			CreateOrder struct{ ID string }
+		}
+		if err := client.Run(ctx, req, &resp); err != nil {
+			t.Fatalf("graphql mutation failed: %v", err)
+		}
+		return resp.CreateOrder.ID
+	}
+
+	first, retry := create(), create()
+	if first == "" || first != retry {
+		t.Fatalf("retry returned order %q, want %q", retry, first)
+	}
+}
+
+// seededProduct returns the id of a product from productsvc's seed data.
+// The gateway only accepts ULIDs, so ids cannot be made up.
+func seededProduct(t *testing.T, client *graphql.Client) string {
+	t.Helper()
+	var resp struct {
+		Products []struct{ ID string }
+	}
+	if err := client.Run(context.Background(), graphql.NewRequest(`{ products { id } }`), &resp); err != nil {
+		t.Fatalf("graphql products query failed: %v", err)
+	}
+	if len(resp.Products) == 0 {
+		t.Fatal("no products seeded")
+	}
+	return resp.Products[0].ID
+}
+
 func getenv(k, def string) string {
 	if v := os.Getenv(k); v != "" {
 		return v
@@ -64,6 +115,22 @@ func getenv(k, def string) string {
 	return def
 }
 
+// token mints an HS256 token signed with the gateway's AUTH_HS256_SECRET.
+func token(t *testing.T, sub string) string {
+	t.Helper()
+	enc := base64.RawURLEncoding
+	hdr, _ := json.Marshal(map[string]any{"alg": "HS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"sub":  sub,
+		"name": sub,
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	})
+	s := enc.EncodeToString(hdr) + "." + enc.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte(getenv("AUTH_HS256_SECRET", "dev-secret")))
+	mac.Write([]byte(s))
+	return s + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
 // package e2e
 
 // import (
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/machinebox/graphql"
 )
 
 type wsMsg struct {
@@ -21,6 +22,7 @@ type wsMsg struct {
 func Test_Subscription_LastOrderCreated_Works(t *testing.T) {
 	wsURL := getenv("GRAPHQL_WS_URL", "ws://localhost:8080/graphql")
 	httpURL := getenv("GRAPHQL_URL", "http://localhost:8080/graphql")
+	pid := seededProduct(t, graphql.NewClient(httpURL))
 
 	u, _ := url.Parse(wsURL)
 	hdr := http.Header{}
@@ -65,10 +67,11 @@ func Test_Subscription_LastOrderCreated_Works(t *testing.T) {
 
 	// trigger mutation over HTTP
 	mut := `mutation($pid:ID!,$qty:Int!){ createOrder(productId:$pid, qty:$qty){ id } }`
-	body := map[string]any{"query": mut, "variables": map[string]any{"pid": "p1", "qty": 1}}
+	body := map[string]any{"query": mut, "variables": map[string]any{"pid": pid, "qty": 1}}
 	bb, _ := json.Marshal(body)
 	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, httpURL, bytes.NewReader(bb))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token(t, "e2e-user"))
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatalf("mutation http: %v", err)
@@ -0,0 +1,270 @@
+// Package harness runs the gateway, productsvc and ordersvc in-process against
+// an embedded NATS server, miniredis, in-memory flags and storage fakes, so
+// end-to-end flows run under go test without Docker or network access.
+package harness
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"rxw1/chaos"
+	"rxw1/flags"
+	"rxw1/flags/flagstest"
+	gateway "rxw1/gatewaysvc/server"
+	"rxw1/logging"
+	orders "rxw1/ordersvc/server"
+	products "rxw1/productsvc/server"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+// Secret signs the HS256 tokens the gateway accepts.
+const Secret = "harness-secret"
+
+// Stack is a running set of services. Everything is torn down when the test
+// that started it ends.
+type Stack struct {
+	URL      string // gateway base URL
+	NATS     *natsserver.Server
+	NC       *nats.Conn
+	Redis    *miniredis.Miniredis
+	Flags    *flagstest.Provider
+	Orders   *orders.Memory
+	Products *products.Memory
+}
+
+// Start runs the services for t. The cache flag is on as flagd ships it;
+// other flags resolve to their code defaults until set through s.Flags.
+func Start(t testing.TB) *Stack {
+	t.Helper()
+
+	// Service logs only show up with -v. Request contexts fall back to the
+	// default logger, so it is replaced for the test binary.
+	var h slog.Handler = slog.DiscardHandler
+	if testing.Verbose() {
+		h = slog.NewTextHandler(os.Stderr, nil)
+	}
+	slog.SetDefault(slog.New(h))
+	ctx := logging.Into(t.Context(), slog.Default())
+
+	s := &Stack{
+		Redis:    miniredis.RunT(t),
+		Orders:   orders.NewMemory(),
+		Products: products.NewMemory(),
+	}
+
+	opts := natstest.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	s.NATS = natstest.RunServer(&opts)
+	t.Cleanup(s.NATS.Shutdown)
+
+	nc, err := nats.Connect(s.NATS.ClientURL())
+	if err != nil {
+		t.Fatalf("harness: connect nats: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	s.NC = nc
+
+	// All services share one provider, with overrides in NATS KV as in prod.
+	ov, err := flags.NewOverrides(ctx, nc)
+	if err != nil {
+		t.Fatalf("harness: flag overrides: %v", err)
+	}
+	ff, prov := flagstest.New(t, map[string]any{
+		string(flags.RedisCacheEnabled): true,
+	}, flags.WithOverrides(ov), flags.WithEnvironment("test"))
+	s.Flags = prov
+
+	psvc, err := products.New(ctx, nc, s.Products)
+	if err != nil {
+		t.Fatalf("harness: productsvc: %v", err)
+	}
+	t.Cleanup(psvc.Close)
+
+	ch := chaos.New("ordersvc", func(ctx context.Context) chaos.Config {
+		return flags.Object[chaos.Config](ctx, ff, flags.Chaos, nil)
+	})
+	osvc, err := orders.New(ctx, nc, s.Orders, ff, ch)
+	if err != nil {
+		t.Fatalf("harness: ordersvc: %v", err)
+	}
+	t.Cleanup(osvc.Close)
+
+	var cfg gateway.Config
+	cfg.Cache.Backend = "redis"
+	cfg.Cache.Redis.Addrs = []string{s.Redis.Addr()}
+	cfg.Cache.Size = 1000
+	cfg.L1Size = 100
+	cfg.L1TTL = time.Second
+	cfg.Auth.HMACSecret = []byte(Secret)
+	cfg.Introspection = true
+	gw, err := gateway.New(ctx, nc, ff, cfg)
+	if err != nil {
+		t.Fatalf("harness: gatewaysvc: %v", err)
+	}
+	t.Cleanup(gw.Close)
+
+	srv := httptest.NewServer(gw)
+	t.Cleanup(srv.Close)
+	s.URL = srv.URL
+	return s
+}
+
+// Token mints an HS256 token for sub with the given roles.
+func (s *Stack) Token(sub string, roles ...string) string {
+	enc := base64.RawURLEncoding
+	hdr, _ := json.Marshal(map[string]any{"alg": "HS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"sub":   sub,
+		"name":  sub,
+		"roles": roles,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	msg := enc.EncodeToString(hdr) + "." + enc.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte(Secret))
+	mac.Write([]byte(msg))
+	return msg + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+// Response is a GraphQL response.
+type Response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// Decode unmarshals the data into v and fails t on any GraphQL error.
+func (r Response) Decode(t testing.TB, v any) {
+	t.Helper()
+	if len(r.Errors) > 0 {
+		t.Fatalf("graphql errors: %+v", r.Errors)
+	}
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		t.Fatalf("decode data: %v", err)
+	}
+}
+
+// Do posts a GraphQL operation to the gateway. An empty token sends an
+// anonymous request.
+func (s *Stack) Do(t testing.TB, token, query string, vars map[string]any) Response {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": vars})
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, s.URL+"/graphql", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("graphql request: %v", err)
+	}
+	defer res.Body.Close()
+
+	b, _ := io.ReadAll(res.Body)
+	var r Response
+	if err := json.Unmarshal(b, &r); err != nil {
+		t.Fatalf("graphql response %s: %s", res.Status, b)
+	}
+	return r
+}
+
+type wsMsg struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Subscribe starts a subscription over graphql-transport-ws and returns the
+// payload of every "next" message. It returns once the gateway is subscribed
+// in NATS, so events published afterwards are not missed. The channel closes
+// with the connection.
+func (s *Stack) Subscribe(t testing.TB, token, query string, vars map[string]any) <-chan Response {
+	t.Helper()
+	before := s.NATS.NumSubscriptions()
+	conn := s.SubscribeConn(t, token, query, vars)
+
+	out := make(chan Response, 16)
+	go func() {
+		defer close(out)
+		for {
+			var m wsMsg
+			if err := conn.ReadJSON(&m); err != nil {
+				return
+			}
+			if m.Type != "next" {
+				continue
+			}
+			var r Response
+			if json.Unmarshal(m.Payload, &r) != nil {
+				continue
+			}
+			select {
+			case out <- r:
+			case <-t.Context().Done():
+				return
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.NATS.NumSubscriptions() <= before {
+		if time.Now().After(deadline) {
+			t.Fatal("ws subscription never reached NATS")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return out
+}
+
+// SubscribeConn starts a subscription over graphql-transport-ws and returns
+// the connection, for reading the gateway's messages directly.
+func (s *Stack) SubscribeConn(t testing.TB, token, query string, vars map[string]any) *websocket.Conn {
+	t.Helper()
+	d := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+	conn, _, err := d.DialContext(t.Context(), "ws"+strings.TrimPrefix(s.URL, "http")+"/graphql", nil)
+	if err != nil {
+		t.Fatalf("ws dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	init, _ := json.Marshal(map[string]any{"Authorization": "Bearer " + token})
+	if token == "" {
+		init = nil
+	}
+	if err := conn.WriteJSON(wsMsg{Type: "connection_init", Payload: init}); err != nil {
+		t.Fatalf("ws init: %v", err)
+	}
+	var ack wsMsg
+	if err := conn.ReadJSON(&ack); err != nil || ack.Type != "connection_ack" {
+		t.Fatalf("ws ack: %+v %v", ack, err)
+	}
+
+	payload, _ := json.Marshal(map[string]any{"query": query, "variables": vars})
+	if err := conn.WriteJSON(wsMsg{Type: "subscribe", ID: "1", Payload: payload}); err != nil {
+		t.Fatalf("ws subscribe: %v", err)
+	}
+	return conn
+}
@@ -0,0 +1,565 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"rxw1/flags"
+	"rxw1/model"
+
+	"integration/harness"
+)
+
+// waitFor polls cond until it holds or a few seconds pass.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// Product ids are ULIDs, as productsvc assigns them; the gateway rejects
+// anything else.
+const (
+	p1      = "01JQ0000000000000000000001"
+	p2      = "01JQ0000000000000000000002"
+	missing = "01JQ00000000000000000000ZZ"
+)
+
+const createOrder = `mutation($pid: ID!, $qty: Int!, $key: String) {
+	createOrder(productId: $pid, qty: $qty, idempotencyKey: $key) { id productId qty userId }
+}`
+
+func TestCreateOrder_MaterializesAndNotifies(t *testing.T) {
+	s := harness.Start(t)
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 100})
+	tok := s.Token("u1")
+
+	events := s.Subscribe(t, tok, `subscription { lastOrderCreated { id productId qty } }`, nil)
+
+	var created struct{ CreateOrder model.Order }
+	s.Do(t, tok, createOrder, map[string]any{"pid": p1, "qty": 2}).Decode(t, &created)
+	if created.CreateOrder.UserID != "u1" || created.CreateOrder.Qty != 2 {
+		t.Fatalf("createOrder = %+v", created.CreateOrder)
+	}
+
+	select {
+	case r := <-events:
+		var ev struct{ LastOrderCreated model.Order }
+		r.Decode(t, &ev)
+		if ev.LastOrderCreated.ID != created.CreateOrder.ID || ev.LastOrderCreated.ProductID != p1 {
+			t.Errorf("lastOrderCreated = %+v, want order %s", ev.LastOrderCreated, created.CreateOrder.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no lastOrderCreated event")
+	}
+
+	// ordersvc materializes the event; the gateway reads it back over NATS.
+	var stored []model.Order
+	waitFor(t, "order in store", func() bool {
+		var res struct{ Orders []model.Order }
+		s.Do(t, tok, `{ orders { id eventId productId qty userId } }`, nil).Decode(t, &res)
+		stored = res.Orders
+		return len(stored) > 0
+	})
+	if got := stored[0]; got.ID != created.CreateOrder.ID || got.UserID != "u1" || got.Qty != 2 {
+		t.Errorf("stored order = %+v", got)
+	}
+}
+
+func TestCreateOrder_IdempotencyKeyReplays(t *testing.T) {
+	s := harness.Start(t)
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 100})
+	tok := s.Token("u1")
+	vars := map[string]any{"pid": p1, "qty": 1, "key": "k-1"}
+
+	var first, second struct{ CreateOrder model.Order }
+	s.Do(t, tok, createOrder, vars).Decode(t, &first)
+	s.Do(t, tok, createOrder, vars).Decode(t, &second)
+	if first.CreateOrder.ID != second.CreateOrder.ID {
+		t.Errorf("replayed id = %s, want %s", second.CreateOrder.ID, first.CreateOrder.ID)
+	}
+
+	waitFor(t, "order in store", func() bool {
+		orders, _ := s.Orders.GetAllOrders(t.Context())
+		return len(orders) > 0
+	})
+	time.Sleep(100 * time.Millisecond) // let a duplicate event land, if any
+	if orders, _ := s.Orders.GetAllOrders(t.Context()); len(orders) != 1 {
+		t.Errorf("stored %d orders, want 1", len(orders))
+	}
+}
+
+func TestCreateOrder_IdempotencyKeyNeedsRedis(t *testing.T) {
+	s := harness.Start(t)
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 100})
+	tok := s.Token("u1")
+	s.Redis.Close()
+
+	r := s.Do(t, tok, createOrder, map[string]any{"pid": p1, "qty": 1, "key": "k-1"})
+	if len(r.Errors) != 1 || r.Errors[0].Extensions["code"] != "INTERNAL" {
+		t.Errorf("errors = %+v, want INTERNAL while keys cannot be stored", r.Errors)
+	}
+
+	// Without a key the order goes through on the memory fallbacks.
+	var created struct{ CreateOrder model.Order }
+	s.Do(t, tok, createOrder, map[string]any{"pid": p1, "qty": 1}).Decode(t, &created)
+	waitFor(t, "order in store", func() bool {
+		orders, _ := s.Orders.GetAllOrders(t.Context())
+		return len(orders) == 1
+	})
+}
+
+func TestCreateOrder_RequiresAuth(t *testing.T) {
+	s := harness.Start(t)
+
+	r := s.Do(t, "", createOrder, map[string]any{"pid": p1, "qty": 1})
+	if len(r.Errors) == 0 || r.Errors[0].Extensions["code"] != "UNAUTHENTICATED" {
+		t.Errorf("errors = %+v, want UNAUTHENTICATED", r.Errors)
+	}
+}
+
+const placeOrder = `mutation($items: [OrderItemInput!]!) {
+	placeOrder(input: {items: $items}) { id items { productId name price qty subtotal } total }
+}`
+
+func TestPlaceOrder_ItemsAndTotal(t *testing.T) {
+	s := harness.Start(t)
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 250})
+	s.Products.Put(model.Product{ID: p2, Name: "Gadget", Price: 100})
+	tok := s.Token("u1")
+
+	var placed struct{ PlaceOrder model.Order }
+	s.Do(t, tok, placeOrder, map[string]any{"items": []map[string]any{
+		{"productId": p1, "qty": 2},
+		{"productId": p2, "qty": 1},
+	}}).Decode(t, &placed)
+	want := []*model.OrderItem{
+		{ProductID: p1, Name: "Widget", Price: ptr[int32](250), Qty: 2, Subtotal: ptr[int32](500)},
+		{ProductID: p2, Name: "Gadget", Price: ptr[int32](100), Qty: 1, Subtotal: ptr[int32](100)},
+	}
+	if !reflect.DeepEqual(placed.PlaceOrder.Items, want) || !reflect.DeepEqual(placed.PlaceOrder.Total, ptr[int32](600)) {
+		t.Errorf("placeOrder = %+v, want items %+v and total 600", placed.PlaceOrder, want)
+	}
+
+	// A later price change does not touch the order: the price is the one
+	// resolved when it was placed.
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 999})
+
+	var stored []model.Order
+	waitFor(t, "order in store", func() bool {
+		var res struct{ Orders []model.Order }
+		s.Do(t, tok, `{ orders { items { productId name price qty subtotal } total } }`, nil).Decode(t, &res)
+		stored = res.Orders
+		return len(stored) > 0
+	})
+	if got := stored[0]; !reflect.DeepEqual(got.Items, want) || !reflect.DeepEqual(got.Total, ptr[int32](600)) {
+		t.Errorf("stored order = %+v, want items %+v and total 600", got, want)
+	}
+}
+
+// TestOrders_UnknownPrice reads an order placed before prices were recorded:
+// its prices are null rather than 0.
+func TestOrders_UnknownPrice(t *testing.T) {
+	s := harness.Start(t)
+	tok := s.Token("u1")
+	const legacy = `{"ID":"o1","ProductID":"` + p1 + `","UserID":"u1","Qty":2,"CreatedAt":"2025-03-04T05:06:07Z"}`
+	if err := s.NC.Publish("order.created", []byte(legacy)); err != nil {
+		t.Fatal(err)
+	}
+
+	var res struct {
+		Orders []struct {
+			Price      *int32
+			Total      *int32
+			TotalPrice *map[string]any
+			Items      []map[string]any
+		}
+	}
+	waitFor(t, "order in store", func() bool {
+		s.Do(t, tok, `{ orders { price total totalPrice items { price unitPrice subtotal subtotalPrice } } }`, nil).Decode(t, &res)
+		return len(res.Orders) > 0
+	})
+	got := res.Orders[0]
+	want := []map[string]any{{"price": nil, "unitPrice": nil, "subtotal": nil, "subtotalPrice": nil}}
+	if got.Price != nil || got.Total != nil || got.TotalPrice != nil || !reflect.DeepEqual(got.Items, want) {
+		t.Errorf("orders = %+v, want null prices", got)
+	}
+}
+
+func TestPlaceOrder_Scalars(t *testing.T) {
+	s := harness.Start(t)
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 250})
+	tok := s.Token("u1")
+	const q = `mutation($items: [OrderItemInput!]!) {
+		placeOrder(input: {items: $items}) {
+			id createdAt totalPrice
+			items { productId unitPrice subtotalPrice }
+		}
+	}`
+
+	type money struct {
+		Amount   int64
+		Currency string
+	}
+	var res struct {
+		PlaceOrder struct {
+			ID         string
+			CreatedAt  string
+			TotalPrice money
+			Items      []struct {
+				ProductID                string
+				UnitPrice, SubtotalPrice money
+			}
+		}
+	}
+	// ULIDs are accepted in lower case and returned in canonical form.
+	s.Do(t, tok, q, map[string]any{"items": []map[string]any{{"productId": strings.ToLower(p1), "qty": 2}}}).Decode(t, &res)
+	o := res.PlaceOrder
+	if len(o.ID) != 26 || o.ID != strings.ToUpper(o.ID) {
+		t.Errorf("id = %q, want a ULID", o.ID)
+	}
+	if at, err := time.Parse(time.RFC3339, o.CreatedAt); err != nil || !strings.HasSuffix(o.CreatedAt, "Z") || time.Since(at) > time.Minute {
+		t.Errorf("createdAt = %q, want a recent RFC3339 time in UTC", o.CreatedAt)
+	}
+	if want := (money{500, "USD"}); o.TotalPrice != want {
+		t.Errorf("totalPrice = %+v, want %+v", o.TotalPrice, want)
+	}
+	if len(o.Items) != 1 || o.Items[0].ProductID != p1 || o.Items[0].UnitPrice != (money{250, "USD"}) || o.Items[0].SubtotalPrice != (money{500, "USD"}) {
+		t.Errorf("items = %+v, want %s at 250 USD for 500 USD", o.Items, p1)
+	}
+
+	var product struct{ ProductByID struct{ UnitPrice money } }
+	s.Do(t, "", `query($id: ID!) { productById(productId: $id) { unitPrice } }`, map[string]any{"id": p1}).Decode(t, &product)
+	if want := (money{250, "USD"}); product.ProductByID.UnitPrice != want {
+		t.Errorf("productById.unitPrice = %+v, want %+v", product.ProductByID.UnitPrice, want)
+	}
+
+	r := s.Do(t, tok, q, map[string]any{"items": []map[string]any{{"productId": "p1", "qty": 1}}})
+	if len(r.Errors) != 1 || r.Errors[0].Message != "input.items[0].productId: must be a ULID" {
+		t.Errorf("errors = %+v, want the productId rejected", r.Errors)
+	}
+}
+
+func TestPlaceOrder_RejectsInvalidItems(t *testing.T) {
+	s := harness.Start(t)
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 250})
+	tok := s.Token("u1")
+
+	tooMany := make([]map[string]any, 21)
+	for i := range tooMany {
+		tooMany[i] = map[string]any{"productId": fmt.Sprintf("01JQ00000000000000000000%02d", i), "qty": 1}
+	}
+	tests := []struct {
+		name      string
+		items     []map[string]any
+		wantCode  string
+		wantField []any
+	}{
+		{name: "none", items: []map[string]any{}, wantCode: "BAD_USER_INPUT", wantField: []any{"input", "items"}},
+		{name: "too many", items: tooMany, wantCode: "BAD_USER_INPUT", wantField: []any{"input", "items"}},
+		{name: "zero qty", items: []map[string]any{{"productId": p1, "qty": 0}}, wantCode: "BAD_USER_INPUT", wantField: []any{"input", "items", 0.0, "qty"}},
+		{name: "negative qty", items: []map[string]any{{"productId": p1, "qty": -1}}, wantCode: "BAD_USER_INPUT", wantField: []any{"input", "items", 0.0, "qty"}},
+		{name: "not a ULID", items: []map[string]any{{"productId": "p1", "qty": 1}}, wantCode: "BAD_USER_INPUT", wantField: []any{"input", "items", 0.0, "productId"}},
+		{
+			name:      "duplicate product",
+			items:     []map[string]any{{"productId": p1, "qty": 1}, {"productId": p1, "qty": 2}},
+			wantCode:  "BAD_USER_INPUT",
+			wantField: []any{"input", "items", 1.0, "productId"},
+		},
+		{name: "unknown product", items: []map[string]any{{"productId": missing, "qty": 1}}, wantCode: "NOT_FOUND", wantField: []any{"input", "items", 0.0, "productId"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := s.Do(t, tok, placeOrder, map[string]any{"items": tt.items})
+			if len(r.Errors) != 1 {
+				t.Fatalf("errors = %+v, want one", r.Errors)
+			}
+			ext := r.Errors[0].Extensions
+			if ext["code"] != tt.wantCode || !reflect.DeepEqual(ext["field"], tt.wantField) {
+				t.Errorf("extensions = %v, want code %s and field %v", ext, tt.wantCode, tt.wantField)
+			}
+		})
+	}
+
+	time.Sleep(100 * time.Millisecond) // let a stray event land, if any
+	if orders, _ := s.Orders.GetAllOrders(t.Context()); len(orders) != 0 {
+		t.Errorf("stored %+v, want nothing", orders)
+	}
+}
+
+func TestCancelOrder_NotFound(t *testing.T) {
+	s := harness.Start(t)
+	tok := s.Token("u1")
+
+	r := s.Do(t, tok, `mutation($id: ID!) { cancelOrder(orderId: $id) { id } }`, map[string]any{"id": missing})
+	if len(r.Errors) != 1 || r.Errors[0].Extensions["code"] != "NOT_FOUND" {
+		t.Errorf("errors = %+v, want NOT_FOUND", r.Errors)
+	}
+}
+
+func TestOrderByID_RejectsMalformedID(t *testing.T) {
+	s := harness.Start(t)
+
+	r := s.Do(t, "", `query($id: ID!) { orderById(orderId: $id) { id } }`, map[string]any{"id": "../etc/passwd"})
+	if len(r.Errors) != 1 || r.Errors[0].Extensions["code"] != "BAD_USER_INPUT" || r.Errors[0].Message != "orderId: must be a ULID" {
+		t.Errorf("errors = %+v, want BAD_USER_INPUT on orderId", r.Errors)
+	}
+}
+
+func TestCancelOrder_RecordsHistory(t *testing.T) {
+	s := harness.Start(t)
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 100})
+	tok := s.Token("u1")
+
+	var created struct{ CreateOrder model.Order }
+	s.Do(t, tok, createOrder, map[string]any{"pid": p1, "qty": 1}).Decode(t, &created)
+	id := created.CreateOrder.ID
+	waitFor(t, "order in store", func() bool {
+		o, _ := s.Orders.GetOrder(t.Context(), id)
+		return o != nil
+	})
+
+	var canceled struct{ CancelOrder model.Order }
+	s.Do(t, tok, `mutation($id: ID!) { cancelOrder(orderId: $id) { id status createdAt } }`, map[string]any{"id": id}).Decode(t, &canceled)
+
+	var res struct {
+		OrderByID struct {
+			Status    model.OrderStatus
+			CreatedAt time.Time
+			History   []model.OrderEvent
+		}
+	}
+	waitFor(t, "order canceled", func() bool {
+		s.Do(t, tok, `query($id: ID!) { orderById(orderId: $id) { status createdAt history { seq type eventId at } } }`,
+			map[string]any{"id": id}).Decode(t, &res)
+		return res.OrderByID.Status == model.OrderStatusCanceled
+	})
+	if !canceled.CancelOrder.CreatedAt.Equal(res.OrderByID.CreatedAt) {
+		t.Errorf("cancelOrder createdAt = %v, want the order's %v", canceled.CancelOrder.CreatedAt, res.OrderByID.CreatedAt)
+	}
+	h := res.OrderByID.History
+	if len(h) != 2 || h[0].Type != model.OrderEventTypeCreated || h[1].Type != model.OrderEventTypeCanceled || h[1].Seq != 2 {
+		t.Errorf("history = %+v, want CREATED then CANCELED", h)
+	}
+
+	r := s.Do(t, tok, `mutation($id: ID!) { cancelOrder(orderId: $id) { id } }`, map[string]any{"id": id})
+	if len(r.Errors) != 1 || r.Errors[0].Extensions["code"] != "CONFLICT" || r.Errors[0].Message != "orderId: order is already canceled" {
+		t.Errorf("second cancelOrder errors = %+v, want CONFLICT on orderId", r.Errors)
+	}
+}
+
+func TestProductByID_ReadsThroughCache(t *testing.T) {
+	s := harness.Start(t)
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 100})
+	const q = `query($id: ID!) { productById(productId: $id) { id price } }`
+
+	var res struct{ ProductByID *model.Product }
+	s.Do(t, "", q, map[string]any{"id": p1}).Decode(t, &res)
+	if res.ProductByID == nil || res.ProductByID.Price != 100 {
+		t.Fatalf("productById = %+v", res.ProductByID)
+	}
+
+	// A price change in the store is not seen until the cache entry expires.
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 200})
+	s.Do(t, "", q, map[string]any{"id": p1}).Decode(t, &res)
+	if res.ProductByID.Price != 100 {
+		t.Errorf("price = %d, want cached 100", res.ProductByID.Price)
+	}
+
+	s.Do(t, "", q, map[string]any{"id": missing}).Decode(t, &res)
+	if res.ProductByID != nil {
+		t.Errorf("missing product = %+v, want null", res.ProductByID)
+	}
+}
+
+func TestClearCache_ReloadsProducts(t *testing.T) {
+	s := harness.Start(t)
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 100})
+	const q = `query($id: ID!) { productById(productId: $id) { id price } }`
+
+	var res struct{ ProductByID *model.Product }
+	s.Do(t, "", q, map[string]any{"id": p1}).Decode(t, &res)
+	s.Products.Put(model.Product{ID: p1, Name: "Widget", Price: 200})
+
+	if resp := s.Do(t, s.Token("u1"), `mutation { clearCache }`, nil); len(resp.Errors) == 0 || resp.Errors[0].Extensions["code"] != "FORBIDDEN" {
+		t.Errorf("clearCache as a user = %+v, want FORBIDDEN", resp.Errors)
+	}
+
+	var cleared struct{ ClearCache bool }
+	s.Do(t, s.Token("admin", model.RoleAdmin.String()), `mutation { clearCache }`, nil).Decode(t, &cleared)
+	if !cleared.ClearCache {
+		t.Fatal("clearCache = false")
+	}
+	s.Do(t, "", q, map[string]any{"id": p1}).Decode(t, &res)
+	if res.ProductByID == nil || res.ProductByID.Price != 200 {
+		t.Errorf("productById after clearCache = %+v, want price 200", res.ProductByID)
+	}
+}
+
+func TestCacheFlag_Overrides(t *testing.T) {
+	s := harness.Start(t)
+	const q = `{ isCacheEnabled }`
+
+	var res struct{ IsCacheEnabled bool }
+	s.Do(t, "", q, nil).Decode(t, &res)
+	if !res.IsCacheEnabled {
+		t.Fatal("cache disabled by the provider")
+	}
+
+	admin := s.Token("admin", model.RoleAdmin.String())
+	var set struct{ DisableCache bool }
+	s.Do(t, admin, `mutation { disableCache }`, nil).Decode(t, &set)
+	waitFor(t, "override", func() bool {
+		s.Do(t, "", q, nil).Decode(t, &res)
+		return !res.IsCacheEnabled
+	})
+
+	// Clearing the override hands the flag back to the provider.
+	var cleared struct{ ClearFlagOverride bool }
+	s.Do(t, admin, `mutation { clearFlagOverride(flag: "redisCacheEnabled") }`, nil).Decode(t, &cleared)
+	waitFor(t, "cleared override", func() bool {
+		s.Do(t, "", q, nil).Decode(t, &res)
+		return res.IsCacheEnabled
+	})
+
+	resp := s.Do(t, admin, `mutation { clearFlagOverride(flag: "chaos") }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != "BAD_USER_INPUT" {
+		t.Errorf("clearFlagOverride(chaos) errors = %+v, want BAD_USER_INPUT", resp.Errors)
+	}
+}
+
+func TestUsers_UpstreamTimeout(t *testing.T) {
+	s := harness.Start(t)
+
+	// No service answers users.* in the stack.
+	for _, q := range []string{`{ users { id } }`, `{ userById(userId: "u1") { id } }`} {
+		resp := s.Do(t, "", q, nil)
+		if len(resp.Errors) == 0 || resp.Errors[0].Extensions["code"] != "UPSTREAM_TIMEOUT" {
+			t.Errorf("%s errors = %+v, want UPSTREAM_TIMEOUT", q, resp.Errors)
+		}
+	}
+}
+
+func TestFlags_ProviderAndOverrides(t *testing.T) {
+	s := harness.Start(t)
+	const q = `{ isThrottlingEnabled }`
+
+	var res struct{ IsThrottlingEnabled bool }
+	s.Do(t, "", q, nil).Decode(t, &res)
+	if res.IsThrottlingEnabled {
+		t.Fatal("throttling enabled by default")
+	}
+
+	s.Flags.Set(string(flags.ThrottleEnabled), true)
+	s.Do(t, "", q, nil).Decode(t, &res)
+	if !res.IsThrottlingEnabled {
+		t.Error("provider value not applied")
+	}
+
+	// Overrides win over the provider and reach every service through NATS KV.
+	var set struct{ DisableThrottling bool }
+	s.Do(t, s.Token("admin", model.RoleAdmin.String()), `mutation { disableThrottling }`, nil).Decode(t, &set)
+	waitFor(t, "override", func() bool {
+		s.Do(t, "", q, nil).Decode(t, &res)
+		return !res.IsThrottlingEnabled
+	})
+}
+
+func TestRateLimit_RefundsRejectedOperations(t *testing.T) {
+	s := harness.Start(t)
+	s.Flags.Set(string(flags.RateLimits), map[string]any{
+		"currentTime":    map[string]any{"perMinute": 1, "burst": 3},
+		"isCacheEnabled": map[string]any{"perMinute": 1, "burst": 1},
+	})
+
+	s.Do(t, "", `{ currentTime { unixTime } isCacheEnabled }`, nil).Decode(t, new(any))
+	// isCacheEnabled is out of tokens, so currentTime gets its token back.
+	r := s.Do(t, "", `{ currentTime { unixTime } isCacheEnabled }`, nil)
+	if len(r.Errors) != 1 || r.Errors[0].Extensions["code"] != "RATE_LIMITED" {
+		t.Fatalf("errors = %+v, want RATE_LIMITED", r.Errors)
+	}
+	for i := range 2 {
+		if r := s.Do(t, "", `{ currentTime { unixTime } }`, nil); len(r.Errors) > 0 {
+			t.Fatalf("currentTime %d errors = %+v, want its refunded token", i, r.Errors)
+		}
+	}
+}
+
+func TestDebugVars_RequiresAdmin(t *testing.T) {
+	s := harness.Start(t)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "user", token: s.Token("u1"), want: http.StatusForbidden},
+		{name: "admin", token: s.Token("admin", model.RoleAdmin.String()), want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, s.URL+"/debug/vars", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.want {
+				t.Errorf("GET /debug/vars as %s = %s, want %d", tt.name, res.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagChanged_RequiresAdmin(t *testing.T) {
+	s := harness.Start(t)
+	const sub = `subscription { flagChanged { flag enabled changedBy } }`
+	type message struct {
+		Type    string
+		Payload json.RawMessage
+	}
+
+	conn := s.SubscribeConn(t, s.Token("u1"), sub, nil)
+	var m message
+	if err := conn.ReadJSON(&m); err != nil {
+		t.Fatal(err)
+	}
+	var r harness.Response
+	if err := json.Unmarshal(m.Payload, &r); err != nil || len(r.Errors) != 1 || r.Errors[0].Extensions["code"] != "FORBIDDEN" {
+		t.Fatalf("flagChanged as a user = %s %s, want a FORBIDDEN error", m.Type, m.Payload)
+	}
+
+	admin := s.Token("admin", model.RoleAdmin.String())
+	conn = s.SubscribeConn(t, admin, sub, nil)
+	enabled := false
+	waitFor(t, "flag change", func() bool {
+		// The subscription may not be watching yet; flip the flag until
+		// a change arrives.
+		enabled = !enabled
+		s.Do(t, admin, map[bool]string{true: `mutation { enableCache }`, false: `mutation { disableCache }`}[enabled], nil).Decode(t, new(map[string]any))
+		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		return conn.ReadJSON(&m) == nil
+	})
+	if m.Type != "next" || !strings.Contains(string(m.Payload), `"changedBy":"admin"`) {
+		t.Errorf("flagChanged as an admin = %s %s, want the change", m.Type, m.Payload)
+	}
+}